@@ -0,0 +1,369 @@
+// Package sdk builds chatroom bots: it registers the commands the bot handles, gets them from its commands topic,
+// or from its rooms websocket with BOT_COMMAND_DELIVERY=websocket, dispatches them to their handlers and
+// publishes the replies through the broker.
+//
+//	bot, err := sdk.New("stock")
+//	bot.Handle("stock", getQuote, sdk.WithHelp("Gets the quote of a stock"), sdk.WithArg("code", `[\w.]+`))
+//	err = bot.Run(context.Background())
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/sebastianreh/chatroom-bots/sdk/broker"
+	"github.com/sebastianreh/chatroom-bots/sdk/chatroom"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom-bots/sdk/health"
+	"github.com/sebastianreh/chatroom-bots/sdk/logging"
+	"github.com/sebastianreh/chatroom-bots/sdk/websocket"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultRoomsRefresh = 30 * time.Second
+
+// HandlerFunc handles a command, the returned error is logged.
+type HandlerFunc func(ctx *Context) error
+
+type Bot struct {
+	name       string
+	config     config.Config
+	logs       logger.Logger
+	socket     websocket.Websocket
+	publisher  broker.Publisher
+	subscriber broker.Subscriber
+	chatroom   chatroom.Client
+	source     commandSource
+	health     *health.Server
+	roomIDs    []string
+	commands   []entities.CommandDefinition
+	handlers   map[string]HandlerFunc
+	inFlight   sync.WaitGroup
+}
+
+type Option func(*Bot)
+
+// CommandOption describes a command to the server, which validates its arguments and lists it in /help.
+type CommandOption func(*entities.CommandDefinition)
+
+// New returns a bot reading its configuration from the environment.
+func New(name string, options ...Option) (*Bot, error) {
+	bot := &Bot{
+		name:     name,
+		handlers: make(map[string]HandlerFunc),
+	}
+
+	bot.config = config.NewConfig()
+	for _, option := range options {
+		option(bot)
+	}
+
+	if bot.logs == nil {
+		logs, err := logging.NewLogger(bot.config.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+		bot.logs = logs
+	}
+
+	if bot.publisher == nil {
+		publisher, err := broker.NewPublisher(bot.logs, bot.config)
+		if err != nil {
+			return nil, err
+		}
+		bot.publisher = publisher
+	}
+
+	if bot.chatroom == nil {
+		bot.chatroom = chatroom.NewClient(bot.config, bot.logs, resty.New())
+	}
+
+	return bot, nil
+}
+
+// WithConfig replaces the configuration read from the environment.
+func WithConfig(cfg config.Config) Option {
+	return func(b *Bot) {
+		b.config = cfg
+	}
+}
+
+func WithLogger(logs logger.Logger) Option {
+	return func(b *Bot) {
+		b.logs = logs
+	}
+}
+
+// WithRooms pins the bot to the rooms, by default it serves every room enabling it. Commands delivered through
+// the broker from other rooms are skipped.
+func WithRooms(roomIDs ...string) Option {
+	return func(b *Bot) {
+		b.roomIDs = roomIDs
+	}
+}
+
+func WithPublisher(publisher broker.Publisher) Option {
+	return func(b *Bot) {
+		b.publisher = publisher
+	}
+}
+
+// WithSubscriber reads the commands topic of the bot with subscriber instead of the BROKER_TYPE one.
+func WithSubscriber(subscriber broker.Subscriber) Option {
+	return func(b *Bot) {
+		b.subscriber = subscriber
+	}
+}
+
+func WithWebsocket(socket websocket.Websocket) Option {
+	return func(b *Bot) {
+		b.socket = socket
+	}
+}
+
+func WithChatroomClient(client chatroom.Client) Option {
+	return func(b *Bot) {
+		b.chatroom = client
+	}
+}
+
+// WithHelp sets the text listed by /help.
+func WithHelp(help string) CommandOption {
+	return func(command *entities.CommandDefinition) {
+		command.Help = help
+	}
+}
+
+// WithArg adds a positional argument, the server rejects the values not matching pattern when it is set.
+func WithArg(name, pattern string) CommandOption {
+	return func(command *entities.CommandDefinition) {
+		command.Args = append(command.Args, entities.CommandArgument{Name: name, Pattern: pattern})
+	}
+}
+
+// WithOptionalArg adds an optional positional argument.
+func WithOptionalArg(name, pattern string) CommandOption {
+	return func(command *entities.CommandDefinition) {
+		command.Args = append(command.Args, entities.CommandArgument{Name: name, Pattern: pattern, Optional: true})
+	}
+}
+
+// WithVariadicArg adds a last argument taking every remaining value, at least one of them.
+func WithVariadicArg(name, pattern string) CommandOption {
+	return func(command *entities.CommandDefinition) {
+		command.Args = append(command.Args, entities.CommandArgument{Name: name, Pattern: pattern, Variadic: true})
+	}
+}
+
+// Handle registers the handler of the command, it must be called before Run.
+func (b *Bot) Handle(command string, handler HandlerFunc, options ...CommandOption) {
+	definition := entities.CommandDefinition{Name: command}
+	for _, option := range options {
+		option(&definition)
+	}
+
+	b.commands = append(b.commands, definition)
+	b.handlers[command] = handler
+}
+
+func (b *Bot) Name() string {
+	return b.name
+}
+
+func (b *Bot) Config() config.Config {
+	return b.config
+}
+
+func (b *Bot) Logger() logger.Logger {
+	return b.logs
+}
+
+// Run handles the commands of the bot until ctx is done or the process gets SIGINT or SIGTERM, then shuts the
+// bot down gracefully.
+func (b *Bot) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	switch b.config.Bot.CommandDelivery {
+	case BrokerDelivery:
+		if err := b.listenCommands(); err != nil {
+			return err
+		}
+	case WebsocketDelivery:
+		if b.socket == nil {
+			b.socket = websocket.NewWebsocket(b.logs, b.config, b.name, b.commands)
+		}
+		b.source = b.socket
+		go b.watchRooms(ctx)
+	default:
+		return fmt.Errorf("unknown command delivery %q", b.config.Bot.CommandDelivery)
+	}
+
+	b.health = health.NewServer(b.config, b.source, b.logs)
+	go b.health.Start()
+
+	handlersCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		b.processMessages(handlersCtx)
+	}()
+
+	b.logs.Info(fmt.Sprintf("bot %s started", b.name), "Run")
+	<-ctx.Done()
+
+	return b.shutdown(processed, cancel)
+}
+
+// shutdown leaves the rooms, waits for the handlers in flight and flushes the replies still queued in the
+// publisher, all within SHUTDOWN_TIMEOUT. The handlers still running then have their context canceled.
+func (b *Bot) shutdown(processed <-chan struct{}, cancelHandlers context.CancelFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.ShutdownTimeout)
+	defer cancel()
+
+	b.source.Close()
+	<-processed
+
+	handled := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(handled)
+	}()
+
+	var shutdownErr error
+	fail := func(err error) {
+		b.logs.Error(err.Error(), "shutdown")
+		if shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	select {
+	case <-handled:
+	case <-ctx.Done():
+		cancelHandlers()
+		fail(fmt.Errorf("waiting for the command handlers: %w", ctx.Err()))
+	}
+
+	if err := b.publisher.Close(ctx); err != nil {
+		fail(fmt.Errorf("closing publisher: %w", err))
+	}
+
+	if err := b.health.Shutdown(ctx); err != nil {
+		fail(fmt.Errorf("closing health server: %w", err))
+	}
+
+	return shutdownErr
+}
+
+// listenCommands registers the commands of the bot on the server, which publishes them on the commands topic
+// of the bot, and subscribes to it. The instances of the bot share the topic as members of BOT_GROUP_ID, the
+// bot name when empty.
+func (b *Bot) listenCommands() error {
+	if err := b.chatroom.RegisterCommands(b.name, b.commands); err != nil {
+		return fmt.Errorf("registering commands: %w", err)
+	}
+
+	if b.subscriber == nil {
+		groupID := b.config.Bot.GroupID
+		if groupID == "" {
+			groupID = b.name
+		}
+
+		topic := b.config.Kafka.CommandsTopic + "." + b.name
+		subscriber, err := broker.NewSubscriber(b.logs, b.config, topic, groupID, b.publisher)
+		if err != nil {
+			return fmt.Errorf("subscribing to the commands topic: %w", err)
+		}
+		b.subscriber = subscriber
+	}
+
+	b.source = newBrokerSource(b.subscriber, b.roomIDs, b.logs)
+	return nil
+}
+
+// watchRooms keeps the bot connected to its rooms, the pinned ones or else the rooms enabling it, refreshing
+// them every BOT_ROOMS_REFRESH_INTERVAL so rooms enabling or disabling the bot are followed.
+func (b *Bot) watchRooms(ctx context.Context) {
+	refresh := b.config.Websocket.RoomsRefresh
+	if refresh <= 0 {
+		refresh = defaultRoomsRefresh
+	}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		if len(b.roomIDs) > 0 {
+			b.socket.SetRooms(b.roomIDs)
+		} else if discovered, err := b.chatroom.GetRooms(b.name); err != nil {
+			b.logs.Error(fmt.Sprintf("error getting bot rooms: %s", err.Error()), "watchRooms")
+		} else {
+			b.socket.SetRooms(discovered)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processMessages dispatches the commands to their handlers, running up to BOT_HANDLER_CONCURRENCY of them at
+// once, until the command source is closed.
+func (b *Bot) processMessages(ctx context.Context) {
+	concurrency := b.config.Bot.HandlerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	slots := make(chan struct{}, concurrency)
+
+	for {
+		message, err := b.source.ReadMessage()
+		if errors.Is(err, websocket.ErrClosed) || errors.Is(err, errSourceClosed) {
+			return
+		}
+
+		if err != nil {
+			b.logs.Error(fmt.Sprintf("error reading message: %s", err.Error()), "processMessages")
+			continue
+		}
+
+		handler, ok := b.handlers[message.Command]
+		if !ok {
+			b.logs.Warn(fmt.Sprintf("no handler for command '%s'", message.Command), "processMessages")
+			continue
+		}
+
+		slots <- struct{}{}
+		b.inFlight.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				b.inFlight.Done()
+			}()
+			b.handle(ctx, handler, message)
+		}()
+	}
+}
+
+func (b *Bot) handle(ctx context.Context, handler HandlerFunc, message entities.BotMessage) {
+	commandCtx := newContext(ctx, b, message)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			commandCtx.Log().Error(fmt.Sprintf("command handler panicked: %v", recovered), "handle")
+		}
+	}()
+
+	if err := handler(commandCtx); err != nil {
+		commandCtx.Log().Error(fmt.Sprintf("command handler failed: %s", err.Error()), "handle")
+	}
+}
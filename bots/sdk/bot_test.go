@@ -0,0 +1,301 @@
+package sdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sebastianreh/chatroom-bots/sdk"
+	"github.com/sebastianreh/chatroom-bots/sdk/broker"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom-bots/sdk/websocket"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebsocket delivers the queued commands and records the rooms it was given.
+type fakeWebsocket struct {
+	messages chan entities.BotMessage
+	done     chan struct{}
+	once     sync.Once
+	mutex    sync.Mutex
+	rooms    []string
+}
+
+func newFakeWebsocket() *fakeWebsocket {
+	return &fakeWebsocket{messages: make(chan entities.BotMessage, 8), done: make(chan struct{})}
+}
+
+func (w *fakeWebsocket) ReadMessage() (entities.BotMessage, error) {
+	select {
+	case message := <-w.messages:
+		return message, nil
+	case <-w.done:
+		return entities.BotMessage{}, websocket.ErrClosed
+	}
+}
+
+func (w *fakeWebsocket) SetRooms(roomIDs []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.rooms = roomIDs
+}
+
+func (w *fakeWebsocket) Rooms() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.rooms
+}
+
+func (w *fakeWebsocket) Status() []websocket.RoomStatus {
+	return nil
+}
+
+func (w *fakeWebsocket) Close() {
+	w.once.Do(func() { close(w.done) })
+}
+
+// fakeChatroom records the commands registered by the bot.
+type fakeChatroom struct {
+	mutex    sync.Mutex
+	commands []entities.CommandDefinition
+}
+
+func (c *fakeChatroom) GetRooms(_ string) ([]string, error) {
+	return nil, nil
+}
+
+func (c *fakeChatroom) RegisterCommands(_ string, commands []entities.CommandDefinition) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commands = commands
+	return nil
+}
+
+func (c *fakeChatroom) Commands() []entities.CommandDefinition {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.commands
+}
+
+func newBot(t *testing.T, socket websocket.Websocket, publisher broker.Publisher) *sdk.Bot {
+	var cfg config.Config
+	cfg.Kafka.RepliesTopic = "stocks"
+	cfg.HealthAddress = "127.0.0.1:0"
+	cfg.ShutdownTimeout = time.Second
+	cfg.Bot.HandlerConcurrency = 2
+	cfg.Bot.CommandDelivery = sdk.WebsocketDelivery
+
+	bot, err := sdk.New("stock", sdk.WithConfig(cfg), sdk.WithLogger(logger.NewLogger()),
+		sdk.WithWebsocket(socket), sdk.WithPublisher(publisher), sdk.WithRooms("room1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bot
+}
+
+func run(bot *sdk.Bot) (context.CancelFunc, <-chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- bot.Run(ctx)
+	}()
+
+	return cancel, stopped
+}
+
+func Test_Bot_Handle(t *testing.T) {
+	t.Run("command is dispatched to its handler and the reply published to its room", func(t *testing.T) {
+		socket := newFakeWebsocket()
+		publisher := broker.NewMemoryPublisher(8)
+		bot := newBot(t, socket, publisher)
+		bot.Handle("stock", func(ctx *sdk.Context) error {
+			return ctx.Reply(ctx.Arg(0) + " quote is $93.42 per share")
+		}, sdk.WithArg("code", `[\w.]+`))
+		cancel, stopped := run(bot)
+		defer cancel()
+
+		socket.messages <- entities.BotMessage{RoomID: "room2", Command: "stock", Args: []string{"AAPL.US"}}
+
+		select {
+		case message := <-publisher.Messages("stocks"):
+			var reply entities.ReplyMessage
+			if err := json.Unmarshal(message, &reply); err != nil {
+				t.Fatal(err)
+			}
+			if reply.RoomID != "room2" || reply.Message != "AAPL.US quote is $93.42 per share" {
+				t.Fatalf("unexpected reply %+v", reply)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("reply was not published")
+		}
+
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		if rooms := socket.Rooms(); len(rooms) != 1 || rooms[0] != "room1" {
+			t.Fatalf("expected the pinned rooms, got %v", rooms)
+		}
+	})
+
+	t.Run("handler errors and unknown commands don't stop the bot", func(t *testing.T) {
+		socket := newFakeWebsocket()
+		publisher := broker.NewMemoryPublisher(8)
+		bot := newBot(t, socket, publisher)
+		bot.Handle("fail", func(ctx *sdk.Context) error {
+			return errors.New("upstream unavailable")
+		})
+		bot.Handle("echo", func(ctx *sdk.Context) error {
+			return ctx.Reply(ctx.Arg(0))
+		})
+		cancel, stopped := run(bot)
+		defer cancel()
+
+		socket.messages <- entities.BotMessage{RoomID: "room1", Command: "fail"}
+		socket.messages <- entities.BotMessage{RoomID: "room1", Command: "weather"}
+		socket.messages <- entities.BotMessage{RoomID: "room1", Command: "echo", Value: "hello"}
+
+		select {
+		case message := <-publisher.Messages("stocks"):
+			var reply entities.ReplyMessage
+			_ = json.Unmarshal(message, &reply)
+			if reply.Message != "hello" {
+				t.Fatalf("unexpected reply %+v", reply)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("reply was not published")
+		}
+
+		cancel()
+		<-stopped
+	})
+}
+
+func Test_Bot_Run(t *testing.T) {
+	t.Run("commands are read from the commands topic and replied with their correlation id", func(t *testing.T) {
+		var cfg config.Config
+		cfg.Kafka.RepliesTopic = "stocks"
+		cfg.Kafka.CommandsTopic = "commands"
+		cfg.HealthAddress = "127.0.0.1:0"
+		cfg.ShutdownTimeout = time.Second
+		cfg.Bot.HandlerConcurrency = 2
+		cfg.Bot.CommandDelivery = sdk.BrokerDelivery
+		cfg.Broker.Type = broker.MemoryType
+		cfg.Broker.Memory.BufferSize = 8
+
+		publisher := broker.NewMemoryPublisher(8)
+		chatroom := &fakeChatroom{}
+		bot, err := sdk.New("stock", sdk.WithConfig(cfg), sdk.WithLogger(logger.NewLogger()),
+			sdk.WithPublisher(publisher), sdk.WithChatroomClient(chatroom), sdk.WithRooms("room1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bot.Handle("stock", func(ctx *sdk.Context) error {
+			return ctx.Reply(ctx.UserID() + " asked for " + ctx.Arg(0))
+		}, sdk.WithArg("code", `[\w.]+`))
+		cancel, stopped := run(bot)
+		defer cancel()
+
+		for _, request := range []entities.CommandRequest{
+			{CorrelationID: "corr0", RoomID: "room2", UserID: "user1", Command: "stock", Args: []string{"MSFT.US"}},
+			{CorrelationID: "corr1", RoomID: "room1", UserID: "user1", Command: "stock", Args: []string{"AAPL.US"}},
+		} {
+			value, _ := json.Marshal(request)
+			_ = publisher.Send("commands.stock", value)
+		}
+
+		select {
+		case message := <-publisher.Messages("stocks"):
+			var reply entities.ReplyMessage
+			if err = json.Unmarshal(message, &reply); err != nil {
+				t.Fatal(err)
+			}
+			expected := entities.ReplyMessage{CorrelationID: "corr1", RoomID: "room1", Message: "user1 asked for AAPL.US"}
+			reply.CreatedAt = time.Time{}
+			if reply != expected {
+				t.Fatalf("unexpected reply %+v", reply)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("reply was not published")
+		}
+
+		cancel()
+		if err = <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		if commands := chatroom.Commands(); len(commands) != 1 || commands[0].Name != "stock" {
+			t.Fatalf("expected the stock command to be registered, got %+v", commands)
+		}
+		select {
+		case message := <-publisher.Messages("stocks"):
+			t.Fatalf("the command of a room out of the pinned ones was handled: %s", message)
+		default:
+		}
+	})
+
+	t.Run("shutdown waits for the handlers in flight", func(t *testing.T) {
+		socket := newFakeWebsocket()
+		publisher := broker.NewMemoryPublisher(8)
+		bot := newBot(t, socket, publisher)
+		started := make(chan struct{})
+		bot.Handle("slow", func(ctx *sdk.Context) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return ctx.Reply("done")
+		})
+		cancel, stopped := run(bot)
+
+		socket.messages <- entities.BotMessage{RoomID: "room1", Command: "slow"}
+		<-started
+		cancel()
+
+		if err := <-stopped; err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-publisher.Messages("stocks"):
+		default:
+			t.Fatal("the reply of the handler in flight was lost")
+		}
+	})
+
+	t.Run("handlers still running when the shutdown times out are canceled", func(t *testing.T) {
+		var cfg config.Config
+		cfg.HealthAddress = "127.0.0.1:0"
+		cfg.ShutdownTimeout = 50 * time.Millisecond
+		cfg.Bot.HandlerConcurrency = 1
+		cfg.Bot.CommandDelivery = sdk.WebsocketDelivery
+		socket := newFakeWebsocket()
+		bot, err := sdk.New("stock", sdk.WithConfig(cfg), sdk.WithLogger(logger.NewLogger()),
+			sdk.WithWebsocket(socket), sdk.WithPublisher(broker.NewMemoryPublisher(8)), sdk.WithRooms("room1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		started := make(chan struct{})
+		canceled := make(chan struct{})
+		bot.Handle("stuck", func(ctx *sdk.Context) error {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		})
+		cancel, stopped := run(bot)
+
+		socket.messages <- entities.BotMessage{RoomID: "room1", Command: "stuck"}
+		<-started
+		cancel()
+
+		if err = <-stopped; err == nil {
+			t.Fatal("expected the shutdown to time out")
+		}
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("the handler context was not canceled")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/kafka"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+)
+
+const (
+	KafkaType  = "kafka"
+	MemoryType = "memory"
+	RedisType  = "redis"
+)
+
+// Publisher sends the bot replies to the server, Send returns once the broker confirmed the delivery.
+type Publisher interface {
+	Send(topic string, message []byte) error
+	Close(ctx context.Context) error
+}
+
+// Subscriber delivers the messages of its topic to process until Close is called, the message being processed
+// at that moment is always finished.
+type Subscriber interface {
+	Listen(process func([]byte)) error
+	Close(ctx context.Context) error
+}
+
+// NewPublisher returns the publisher selected by BROKER_TYPE, it must match the broker the server listens to.
+func NewPublisher(logs logger.Logger, cfg config.Config) (Publisher, error) {
+	switch cfg.Broker.Type {
+	case KafkaType:
+		return kafka.NewProducer(logs, cfg.Kafka.Server,
+			kafka.WithMaxRetries(cfg.Kafka.MaxRetries),
+			kafka.WithBackoff(cfg.Kafka.InitialBackoff, cfg.Kafka.MaxBackoff),
+			kafka.WithDeliveryTimeout(cfg.Kafka.DeliveryTimeout),
+		)
+	case MemoryType:
+		return NewMemoryPublisher(cfg.Broker.Memory.BufferSize), nil
+	case RedisType:
+		return NewRedisPublisher(logs, cfg)
+	default:
+		return nil, fmt.Errorf("unknown broker type %q", cfg.Broker.Type)
+	}
+}
+
+// NewSubscriber returns the subscriber to topic of the BROKER_TYPE broker, reading as a member of groupID. The
+// memory subscriber reads the topic of publisher, the only place its messages exist.
+func NewSubscriber(logs logger.Logger, cfg config.Config, topic, groupID string,
+	publisher Publisher) (Subscriber, error) {
+	switch cfg.Broker.Type {
+	case KafkaType:
+		return kafka.NewConsumer(cfg.Kafka.Server, groupID, topic)
+	case MemoryType:
+		memory, ok := publisher.(*MemoryPublisher)
+		if !ok {
+			return nil, errors.New("the memory subscriber needs the memory publisher")
+		}
+		return memory.Subscriber(topic), nil
+	case RedisType:
+		return NewRedisSubscriber(logs, cfg, topic, groupID)
+	default:
+		return nil, fmt.Errorf("unknown broker type %q", cfg.Broker.Type)
+	}
+}
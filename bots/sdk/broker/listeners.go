@@ -0,0 +1,58 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// listeners tracks the Listen calls of a subscriber so Close can wait for them. The mutex orders the calls
+// registering with Close, so no Listen call is added while Close waits.
+type listeners struct {
+	mutex     sync.Mutex
+	done      chan struct{}
+	closed    bool
+	listening sync.WaitGroup
+}
+
+func newListeners() *listeners {
+	return &listeners{done: make(chan struct{})}
+}
+
+// start registers a Listen call, it returns false once the subscriber is closed. Registered calls end with stop.
+func (l *listeners) start() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return false
+	}
+
+	l.listening.Add(1)
+	return true
+}
+
+func (l *listeners) stop() {
+	l.listening.Done()
+}
+
+// close stops the Listen calls and waits for them to return, or ctx to be done.
+func (l *listeners) close(ctx context.Context) error {
+	l.mutex.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	l.mutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		l.listening.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
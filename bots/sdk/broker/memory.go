@@ -0,0 +1,103 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errPublisherClosed = errors.New("the publisher is closed")
+
+// MemoryPublisher keeps the messages in process, a buffered channel per topic, so the bot runs without an
+// external broker. Messages are read back with Messages.
+type MemoryPublisher struct {
+	mutex      sync.Mutex
+	bufferSize int
+	topics     map[string]chan []byte
+	closed     bool
+}
+
+func NewMemoryPublisher(bufferSize int) *MemoryPublisher {
+	return &MemoryPublisher{
+		bufferSize: bufferSize,
+		topics:     make(map[string]chan []byte),
+	}
+}
+
+// Send queues the message, the oldest one of the topic is dropped when its buffer is full.
+func (p *MemoryPublisher) Send(topic string, message []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errPublisherClosed
+	}
+
+	messages := p.topic(topic)
+	for {
+		select {
+		case messages <- message:
+			return nil
+		default:
+			<-messages
+		}
+	}
+}
+
+// Messages returns the channel the messages of topic are queued on.
+func (p *MemoryPublisher) Messages(topic string) <-chan []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.topic(topic)
+}
+
+func (p *MemoryPublisher) Close(_ context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+
+	return nil
+}
+
+func (p *MemoryPublisher) topic(name string) chan []byte {
+	messages, ok := p.topics[name]
+	if !ok {
+		messages = make(chan []byte, p.bufferSize)
+		p.topics[name] = messages
+	}
+
+	return messages
+}
+
+// Subscriber returns a subscriber reading the messages queued on topic.
+func (p *MemoryPublisher) Subscriber(topic string) Subscriber {
+	return &memorySubscriber{
+		messages:  p.Messages(topic),
+		listeners: newListeners(),
+	}
+}
+
+type memorySubscriber struct {
+	messages  <-chan []byte
+	listeners *listeners
+}
+
+func (s *memorySubscriber) Listen(process func([]byte)) error {
+	if !s.listeners.start() {
+		return nil
+	}
+	defer s.listeners.stop()
+
+	for {
+		select {
+		case <-s.listeners.done:
+			return nil
+		case message := <-s.messages:
+			process(message)
+		}
+	}
+}
+
+func (s *memorySubscriber) Close(ctx context.Context) error {
+	return s.listeners.close(ctx)
+}
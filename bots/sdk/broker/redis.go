@@ -0,0 +1,153 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	rd "github.com/go-redis/redis/v8"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/logging"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// valueField is the stream entry field holding the message, the server writes and reads the same one.
+	valueField = "value"
+
+	readCount = 10
+)
+
+type redisPublisher struct {
+	logs   logger.Logger
+	client *rd.Client
+	maxLen int64
+}
+
+// NewRedisPublisher appends the messages to the Redis stream named after the topic.
+func NewRedisPublisher(logs logger.Logger, cfg config.Config) (Publisher, error) {
+	client := rd.NewClient(&rd.Options{Addr: cfg.Redis.Host})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+
+	return &redisPublisher{
+		logs:   logs,
+		client: client,
+		maxLen: cfg.Broker.Redis.MaxLen,
+	}, nil
+}
+
+func (p *redisPublisher) Send(topic string, message []byte) error {
+	logging.Debug(p.logs, fmt.Sprintf("sending -> stream [%s] message %s", topic, message), "Send")
+	return p.client.XAdd(context.Background(), &rd.XAddArgs{
+		Stream: topic,
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: map[string]interface{}{valueField: message},
+	}).Err()
+}
+
+func (p *redisPublisher) Close(_ context.Context) error {
+	return p.client.Close()
+}
+
+type redisSubscriber struct {
+	logs      logger.Logger
+	client    *rd.Client
+	stream    string
+	group     string
+	consumer  string
+	block     time.Duration
+	listeners *listeners
+}
+
+// NewRedisSubscriber reads the Redis stream named after the topic as a member of the consumer group, so the
+// instances of a bot share its messages as they do with a Kafka group. Each instance is a consumer named after
+// BROKER_REDIS_CONSUMER, or its hostname when empty.
+func NewRedisSubscriber(logs logger.Logger, cfg config.Config, topic, group string) (Subscriber, error) {
+	client := rd.NewClient(&rd.Options{Addr: cfg.Redis.Host})
+	err := client.XGroupCreateMkStream(context.Background(), topic, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create the consumer group: %w", err)
+	}
+
+	consumer := cfg.Broker.Redis.Consumer
+	if consumer == "" {
+		if consumer, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to name the consumer: %w", err)
+		}
+	}
+
+	return &redisSubscriber{
+		logs:      logs,
+		client:    client,
+		stream:    topic,
+		group:     group,
+		consumer:  consumer,
+		block:     cfg.Broker.Redis.Block,
+		listeners: newListeners(),
+	}, nil
+}
+
+// Listen acknowledges each entry once processed. Reading errors are returned so the caller decides whether
+// to listen again.
+func (s *redisSubscriber) Listen(process func([]byte)) error {
+	if !s.listeners.start() {
+		return nil
+	}
+	defer s.listeners.stop()
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-s.listeners.done:
+			return nil
+		default:
+		}
+
+		streams, err := s.client.XReadGroup(ctx, &rd.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    readCount,
+			Block:    s.block,
+		}).Result()
+		if err == rd.Nil {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		for _, entries := range streams {
+			for _, entry := range entries.Messages {
+				process(streamValue(entry.Values))
+				if err = s.client.XAck(ctx, s.stream, s.group, entry.ID).Err(); err != nil {
+					s.logs.Error(fmt.Sprintf("failed to ack entry %s: %s", entry.ID, err.Error()), "Listen")
+				}
+			}
+		}
+	}
+}
+
+// Close stops Listen after the entries being processed, it waits up to the read block time.
+func (s *redisSubscriber) Close(ctx context.Context) error {
+	if err := s.listeners.close(ctx); err != nil {
+		return err
+	}
+
+	return s.client.Close()
+}
+
+func streamValue(values map[string]interface{}) []byte {
+	switch value := values[valueField].(type) {
+	case string:
+		return []byte(value)
+	case []byte:
+		return value
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package chatroom
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+)
+
+const (
+	GetRoomsMethodName         = "GetRooms"
+	RegisterCommandsMethodName = "RegisterCommands"
+	chatroomClientName         = "chatroom_client"
+)
+
+type (
+	Client interface {
+		GetRooms(botName string) ([]string, error)
+		RegisterCommands(botName string, commands []entities.CommandDefinition) error
+	}
+
+	chatroomClient struct {
+		configs    config.Config
+		logger     logger.Logger
+		restClient *resty.Client
+	}
+
+	roomsResponse struct {
+		Rooms []string `json:"rooms"`
+	}
+)
+
+func NewClient(cfg config.Config, logger logger.Logger, restClient *resty.Client) Client {
+	return &chatroomClient{
+		configs:    cfg,
+		logger:     logger,
+		restClient: restClient,
+	}
+}
+
+// GetRooms returns the rooms the bot is enabled in, authenticating with the bot API key.
+func (client *chatroomClient) GetRooms(botName string) ([]string, error) {
+	response := new(roomsResponse)
+	resp, err := client.restClient.R().
+		SetAuthToken(client.configs.Websocket.APIKey).
+		SetQueryParam("bot_name", botName).
+		SetResult(response).
+		Get(client.configs.Websocket.RoomsEndpoint)
+	if err != nil {
+		client.logger.Error(str.ErrorConcat(err, chatroomClientName, GetRoomsMethodName))
+		return nil, err
+	}
+
+	if !resp.IsSuccess() {
+		err = fmt.Errorf("error getting bot rooms with http status code: %d, body %s",
+			resp.StatusCode(), string(resp.Body()))
+		client.logger.Error(str.ErrorConcat(err, chatroomClientName, GetRoomsMethodName))
+		return nil, err
+	}
+
+	return response.Rooms, nil
+}
+
+// RegisterCommands stores the commands the bot handles, so the server publishes them on the commands topic of
+// the bot.
+func (client *chatroomClient) RegisterCommands(botName string, commands []entities.CommandDefinition) error {
+	resp, err := client.restClient.R().
+		SetAuthToken(client.configs.Websocket.APIKey).
+		SetQueryParam("bot_name", botName).
+		SetBody(entities.CommandRegistration{Commands: commands}).
+		Put(client.configs.Websocket.CommandsEndpoint)
+	if err != nil {
+		client.logger.Error(str.ErrorConcat(err, chatroomClientName, RegisterCommandsMethodName))
+		return err
+	}
+
+	if !resp.IsSuccess() {
+		err = fmt.Errorf("error registering bot commands with http status code: %d, body %s",
+			resp.StatusCode(), string(resp.Body()))
+		client.logger.Error(str.ErrorConcat(err, chatroomClientName, RegisterCommandsMethodName))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sebastianreh/chatroom-bots/sdk/broker"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom-bots/sdk/websocket"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
+	"time"
+)
+
+const (
+	// BrokerDelivery gets the commands from the commands topic of the bot, WebsocketDelivery from the rooms
+	// websocket.
+	BrokerDelivery    = "broker"
+	WebsocketDelivery = "websocket"
+
+	listenRetryInterval = time.Second
+)
+
+var errSourceClosed = errors.New("command source closed")
+
+// commandSource delivers the commands of the bot, ReadMessage returns errSourceClosed or websocket.ErrClosed
+// once it is closed.
+type commandSource interface {
+	ReadMessage() (entities.BotMessage, error)
+	Status() []websocket.RoomStatus
+	Close()
+}
+
+// brokerSource reads the CommandRequest published by the server on the commands topic of the bot. The commands
+// of rooms out of roomIDs are skipped when the bot is pinned to some rooms.
+type brokerSource struct {
+	subscriber broker.Subscriber
+	logs       logger.Logger
+	roomIDs    map[string]bool
+	messages   chan entities.BotMessage
+	done       chan struct{}
+	closeOnce  sync.Once
+	listening  sync.WaitGroup
+}
+
+func newBrokerSource(subscriber broker.Subscriber, roomIDs []string, logs logger.Logger) *brokerSource {
+	source := &brokerSource{
+		subscriber: subscriber,
+		logs:       logs,
+		messages:   make(chan entities.BotMessage),
+		done:       make(chan struct{}),
+	}
+
+	if len(roomIDs) > 0 {
+		source.roomIDs = make(map[string]bool, len(roomIDs))
+		for _, roomID := range roomIDs {
+			source.roomIDs[roomID] = true
+		}
+	}
+
+	source.listening.Add(1)
+	go source.listen()
+
+	return source
+}
+
+// listen keeps the subscriber listening until the source is closed, it listens again after reading errors.
+func (s *brokerSource) listen() {
+	defer s.listening.Done()
+
+	for {
+		err := s.subscriber.Listen(s.process)
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		if err != nil {
+			s.logs.Error(fmt.Sprintf("error listening for commands: %s", err.Error()), "listen")
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func (s *brokerSource) process(value []byte) {
+	var request entities.CommandRequest
+	if err := json.Unmarshal(value, &request); err != nil {
+		s.logs.Error(fmt.Sprintf("error reading command request: %s", err.Error()), "process")
+		return
+	}
+
+	if s.roomIDs != nil && !s.roomIDs[request.RoomID] {
+		return
+	}
+
+	select {
+	case s.messages <- request.BotMessage():
+	case <-s.done:
+	}
+}
+
+func (s *brokerSource) ReadMessage() (entities.BotMessage, error) {
+	select {
+	case message := <-s.messages:
+		return message, nil
+	case <-s.done:
+		return entities.BotMessage{}, errSourceClosed
+	}
+}
+
+// Status is empty, the bot is not connected to its rooms.
+func (s *brokerSource) Status() []websocket.RoomStatus {
+	return nil
+}
+
+// Close stops listening, the subscriber is given up to a second to finish.
+func (s *brokerSource) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), listenRetryInterval)
+	defer cancel()
+	if err := s.subscriber.Close(ctx); err != nil {
+		s.logs.Error(fmt.Sprintf("error closing subscriber: %s", err.Error()), "Close")
+	}
+	s.listening.Wait()
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"time"
+)
+
+type (
+	Config struct {
+		ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"15s"`
+		HealthAddress   string        `envconfig:"HEALTH_ADDRESS" default:":8001"`
+		LogLevel        string        `envconfig:"LOG_LEVEL" default:"info"`
+		Bot             struct {
+			HandlerConcurrency int    `envconfig:"BOT_HANDLER_CONCURRENCY" default:"8"`
+			CommandDelivery    string `envconfig:"BOT_COMMAND_DELIVERY" default:"broker"`
+			GroupID            string `envconfig:"BOT_GROUP_ID"`
+		}
+		Broker struct {
+			Type   string `envconfig:"BROKER_TYPE" default:"kafka"`
+			Memory struct {
+				BufferSize int `envconfig:"BROKER_MEMORY_BUFFER_SIZE" default:"256"`
+			}
+			Redis struct {
+				MaxLen   int64         `envconfig:"BROKER_REDIS_MAX_LEN" default:"10000"`
+				Consumer string        `envconfig:"BROKER_REDIS_CONSUMER"`
+				Block    time.Duration `envconfig:"BROKER_REDIS_BLOCK" default:"1s"`
+			}
+		}
+		Redis struct {
+			Host string `envconfig:"REDIS_HOST" default:"localhost:6379"`
+		}
+		Kafka struct {
+			Server          string        `envconfig:"KAFKA_SERVER" default:"localhost:9092"`
+			RepliesTopic    string        `envconfig:"KAFKA_REPLIES_TOPIC" default:"stocks"`
+			CommandsTopic   string        `envconfig:"KAFKA_COMMANDS_TOPIC" default:"commands"`
+			MaxRetries      int           `envconfig:"KAFKA_MAX_RETRIES" default:"3"`
+			InitialBackoff  time.Duration `envconfig:"KAFKA_RETRY_INITIAL_BACKOFF" default:"100ms"`
+			MaxBackoff      time.Duration `envconfig:"KAFKA_RETRY_MAX_BACKOFF" default:"5s"`
+			DeliveryTimeout time.Duration `envconfig:"KAFKA_DELIVERY_TIMEOUT" default:"10s"`
+		}
+		Websocket struct {
+			Endpoint                string        `envconfig:"WEBSOCKET_ENDPOINT" default:"ws://localhost:8000/chatroom/session/bot"`
+			APIKey                  string        `envconfig:"BOT_API_KEY"`
+			RoomsEndpoint           string        `envconfig:"BOT_ROOMS_ENDPOINT" default:"http://localhost:8000/chatroom/session/bot/rooms"`
+			CommandsEndpoint        string        `envconfig:"BOT_COMMANDS_ENDPOINT" default:"http://localhost:8000/chatroom/session/bot/commands"`
+			RoomsRefresh            time.Duration `envconfig:"BOT_ROOMS_REFRESH_INTERVAL" default:"30s"`
+			ReconnectInitialBackoff time.Duration `envconfig:"WEBSOCKET_RECONNECT_INITIAL_BACKOFF" default:"500ms"`
+			ReconnectMaxBackoff     time.Duration `envconfig:"WEBSOCKET_RECONNECT_MAX_BACKOFF" default:"30s"`
+			Compression             bool          `envconfig:"WEBSOCKET_COMPRESSION_ENABLED" default:"true"`
+			CompressionLevel        int           `envconfig:"WEBSOCKET_COMPRESSION_LEVEL" default:"1"`
+			ReadBufferSize          int           `envconfig:"WEBSOCKET_READ_BUFFER_SIZE" default:"1024"`
+			WriteBufferSize         int           `envconfig:"WEBSOCKET_WRITE_BUFFER_SIZE" default:"1024"`
+		}
+	}
+)
+
+var (
+	Configs Config
+)
+
+func NewConfig() Config {
+	if err := envconfig.Process("", &Configs); err != nil {
+		panic(err.Error())
+	}
+
+	return Configs
+}
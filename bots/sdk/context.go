@@ -0,0 +1,82 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"time"
+)
+
+// Context is the command being handled. It is canceled when the handler is still running once the bot shutdown
+// times out, by then its replies can no longer be published.
+type Context struct {
+	context.Context
+	Message entities.BotMessage
+	bot     *Bot
+	logs    logger.Logger
+}
+
+func newContext(ctx context.Context, bot *Bot, message entities.BotMessage) *Context {
+	return &Context{
+		Context: ctx,
+		Message: message,
+		bot:     bot,
+		logs: newFieldLogger(bot.logs, "bot", bot.name, "room_id", message.RoomID,
+			"command", message.Command, "correlation_id", message.CorrelationID),
+	}
+}
+
+// RoomID is the room the command comes from, where the replies go.
+func (c *Context) RoomID() string {
+	return c.Message.RoomID
+}
+
+// UserID is the user who sent the command.
+func (c *Context) UserID() string {
+	return c.Message.UserID
+}
+
+func (c *Context) Command() string {
+	return c.Message.Command
+}
+
+// Args returns the command arguments, already validated by the server against the command definition.
+func (c *Context) Args() []string {
+	if len(c.Message.Args) == 0 && c.Message.Value != "" {
+		return []string{c.Message.Value}
+	}
+
+	return c.Message.Args
+}
+
+// Arg returns the argument at index, or an empty string when missing.
+func (c *Context) Arg(index int) string {
+	args := c.Args()
+	if index < 0 || index >= len(args) {
+		return ""
+	}
+
+	return args[index]
+}
+
+// Log returns a logger adding the bot, room and command to every entry.
+func (c *Context) Log() logger.Logger {
+	return c.logs
+}
+
+// Reply sends the message to the room of the command, correlated to it, it returns once the broker confirmed
+// the delivery.
+func (c *Context) Reply(message string) error {
+	reply, err := json.Marshal(entities.ReplyMessage{
+		CorrelationID: c.Message.CorrelationID,
+		RoomID:        c.Message.RoomID,
+		Message:       message,
+		CreatedAt:     time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.bot.publisher.Send(c.bot.config.Kafka.RepliesTopic, reply)
+}
@@ -0,0 +1,87 @@
+package entities
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ProtocolVersion              = 1
+	BotCommandFrameType          = "bot_command"
+	CommandRegistrationFrameType = "command_registration"
+)
+
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`
+	RoomID    string          `json:"room_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// BotMessage is a command received from a room, the reply is sent back to RoomID with the same CorrelationID.
+type BotMessage struct {
+	CorrelationID string   `json:"correlation_id,omitempty"`
+	RoomID        string   `json:"room_id"`
+	UserID        string   `json:"user_id,omitempty"`
+	Command       string   `json:"command"`
+	Value         string   `json:"value"`
+	Args          []string `json:"args,omitempty"`
+}
+
+// CommandRequest is a command delivered through the broker, on the commands topic of the bot.
+type CommandRequest struct {
+	CorrelationID string    `json:"correlation_id"`
+	RoomID        string    `json:"room_id"`
+	UserID        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	Bot           string    `json:"bot"`
+	Command       string    `json:"command"`
+	Args          []string  `json:"args,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ReplyMessage is a bot reply, published to the topic the server reads the bot messages from.
+type ReplyMessage struct {
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	RoomID        string    `json:"room_id"`
+	Message       string    `json:"bot_message"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BotMessage returns the request as the command the handlers get, Value being its first argument.
+func (r CommandRequest) BotMessage() BotMessage {
+	message := BotMessage{
+		CorrelationID: r.CorrelationID,
+		RoomID:        r.RoomID,
+		UserID:        r.UserID,
+		Command:       r.Command,
+		Args:          r.Args,
+	}
+	if len(r.Args) > 0 {
+		message.Value = r.Args[0]
+	}
+
+	return message
+}
+
+// CommandArgument describes a positional argument of a command, the server rejects values not matching Pattern.
+// A Variadic argument, only allowed last, takes every remaining value.
+type CommandArgument struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	Variadic bool   `json:"variadic,omitempty"`
+}
+
+// CommandDefinition is a command the bot handles, the server only routes registered commands to the bot.
+type CommandDefinition struct {
+	Name string            `json:"name"`
+	Args []CommandArgument `json:"args,omitempty"`
+	Help string            `json:"help"`
+}
+
+type CommandRegistration struct {
+	Commands []CommandDefinition `json:"commands"`
+}
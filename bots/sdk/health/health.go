@@ -0,0 +1,104 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/websocket"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"net/http"
+)
+
+const (
+	OkStatus       = "ok"
+	DegradedStatus = "degraded"
+	DownStatus     = "down"
+)
+
+// Health is the bot health, the status is degraded while some rooms are reconnecting and down when none is
+// connected.
+type Health struct {
+	Status string                 `json:"status"`
+	Rooms  []websocket.RoomStatus `json:"rooms"`
+}
+
+// Reporter returns the connection state of the bot rooms, a bot getting its commands through the broker has
+// none.
+type Reporter interface {
+	Status() []websocket.RoomStatus
+}
+
+type Server struct {
+	server   *http.Server
+	reporter Reporter
+	logs     logger.Logger
+}
+
+// NewServer returns the server answering GET /health with the connection state of the bot rooms, and
+// GET /debug/vars with the metrics the bot publishes through expvar.
+func NewServer(cfg config.Config, reporter Reporter, logs logger.Logger) *Server {
+	server := &Server{
+		reporter: reporter,
+		logs:     logs,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", server.health)
+	mux.Handle("/debug/vars", expvar.Handler())
+	server.server = &http.Server{Addr: cfg.HealthAddress, Handler: mux}
+
+	return server
+}
+
+func (s *Server) Start() {
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logs.Error("error starting health server", "Start", err.Error())
+	}
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Check returns the bot health from the state of its rooms.
+func Check(rooms []websocket.RoomStatus) Health {
+	connected := 0
+	for _, room := range rooms {
+		if room.State == websocket.ConnectedState {
+			connected++
+		}
+	}
+
+	status := OkStatus
+	if connected < len(rooms) {
+		status = DegradedStatus
+	}
+
+	if connected == 0 && len(rooms) > 0 {
+		status = DownStatus
+	}
+
+	return Health{Status: status, Rooms: rooms}
+}
+
+func (s *Server) health(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	health := Check(s.reporter.Status())
+	code := http.StatusOK
+	if health.Status == DownStatus {
+		code = http.StatusServiceUnavailable
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	if err := json.NewEncoder(writer).Encode(health); err != nil {
+		s.logs.Error("error writing health", "health", err.Error())
+	}
+}
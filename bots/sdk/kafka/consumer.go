@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom/pkg/strings"
+	"sync"
+)
+
+const pollTimeoutMs = 100
+
+type Consumer interface {
+	Listen(process func([]byte)) error
+	Close(ctx context.Context) error
+}
+
+type consumer struct {
+	topic    string
+	listener *kafka.Consumer
+	// mutex orders the Listen calls registering in listening with Close closing done, so no Listen call is
+	// added while Close waits for them.
+	mutex     sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	listening sync.WaitGroup
+}
+
+// NewConsumer reads the topic as a member of groupID, so the instances of a bot share its messages.
+func NewConsumer(serverAddress, groupID, topic string) (Consumer, error) {
+	if strings.IsEmpty(serverAddress) {
+		return nil, errors.New("error, the serverAddress variable is empty")
+	}
+
+	listener, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers": serverAddress,
+		"group.id":          groupID,
+		"auto.offset.reset": "latest",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &consumer{
+		topic:    topic,
+		listener: listener,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Listen polls the topic until Close is called, the message being processed at that moment is always finished.
+func (c *consumer) Listen(process func([]byte)) error {
+	if !c.startListening() {
+		return nil
+	}
+	defer c.listening.Done()
+
+	if err := c.listener.Subscribe(c.topic, nil); err != nil {
+		return fmt.Errorf("failed to subscribe to topic: %w", err)
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return nil
+		default:
+		}
+
+		switch event := c.listener.Poll(pollTimeoutMs).(type) {
+		case *kafka.Message:
+			process(event.Value)
+		case kafka.Error:
+			return fmt.Errorf("consumer error: %w", event)
+		default:
+		}
+	}
+}
+
+// Close stops Listen, waits for the in-flight message, commits the processed offsets and closes the consumer.
+func (c *consumer) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.mutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.listening.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if _, err := c.listener.Commit(); err != nil {
+		if kafkaErr, ok := err.(kafka.Error); !ok || kafkaErr.Code() != kafka.ErrNoOffset {
+			return fmt.Errorf("failed to commit offsets: %w", err)
+		}
+	}
+
+	return c.listener.Close()
+}
+
+// startListening registers a Listen call, it returns false once the consumer is closed.
+func (c *consumer) startListening() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	c.listening.Add(1)
+	return true
+}
@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom-bots/sdk/logging"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialBackoff  = 100 * time.Millisecond
+	defaultMaxBackoff      = 5 * time.Second
+	defaultDeliveryTimeout = 10 * time.Second
+	defaultFlushTimeout    = 5 * time.Second
+	defaultMaxRetries      = 10
+)
+
+var errProducerClosed = errors.New("the kafka producer is closed")
+
+type Producer interface {
+	Send(topic string, message []byte) (err error)
+	Close(ctx context.Context) error
+}
+
+// Client is the part of the confluent producer used to send the messages.
+type Client interface {
+	Produce(message *kafka.Message, deliveryChan chan kafka.Event) error
+	Events() chan kafka.Event
+	Flush(timeoutMs int) int
+	Close()
+}
+
+type producer struct {
+	logs            logger.Logger
+	client          Client
+	serverAddress   string
+	initialBackoff  time.Duration
+	maxBackoff      time.Duration
+	deliveryTimeout time.Duration
+	maxRetries      int
+	// lifecycle guards closed, so no Send is added to sending once Close began waiting for them. It is held
+	// for writing while the client is closed, so no message is produced on a closed client.
+	lifecycle sync.RWMutex
+	closed    bool
+	sending   sync.WaitGroup
+	// stopped is closed with the client, the sends still in flight give up their retries and delivery reports.
+	stopped chan struct{}
+}
+
+type ProducerOption func(*producer)
+
+// NewProducer creates the producer and its client, which is kept for the whole process and shared by every
+// Send until Close.
+func NewProducer(logger logger.Logger, serverAddress string, opts ...ProducerOption) (Producer, error) {
+	if strings.IsEmpty(serverAddress) {
+		return &producer{}, errors.New("error, the serverAddress variable is empty")
+	}
+
+	producer := &producer{
+		logs:            logger,
+		serverAddress:   serverAddress,
+		initialBackoff:  defaultInitialBackoff,
+		maxBackoff:      defaultMaxBackoff,
+		deliveryTimeout: defaultDeliveryTimeout,
+		maxRetries:      defaultMaxRetries,
+		stopped:         make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(producer)
+	}
+
+	if producer.maxRetries < 1 {
+		return nil, fmt.Errorf("error, the max retries must be at least 1, got %d", producer.maxRetries)
+	}
+
+	if producer.client == nil {
+		client, err := kafka.NewProducer(&kafka.ConfigMap{
+			"bootstrap.servers":   producer.serverAddress,
+			"delivery.timeout.ms": int(producer.deliveryTimeout.Milliseconds()),
+		})
+		if err != nil {
+			return nil, err
+		}
+		producer.client = client
+	}
+
+	go producer.logEvents()
+
+	return producer, nil
+}
+
+// Send produces the message and waits for its delivery report, retrying with an exponential backoff until
+// it is delivered or the retries run out.
+func (producer *producer) Send(topic string, message []byte) (err error) {
+	producer.lifecycle.RLock()
+	if producer.closed {
+		producer.lifecycle.RUnlock()
+		return errProducerClosed
+	}
+	producer.sending.Add(1)
+	producer.lifecycle.RUnlock()
+	defer producer.sending.Done()
+
+	backoff := producer.initialBackoff
+	for retries := 1; retries <= producer.maxRetries; retries++ {
+		err = producer.sendMessage(topic, message)
+		if err == nil {
+			return nil
+		}
+
+		producer.logs.Error(fmt.Sprintf("error sending message, attempt %d: %s", retries, err.Error()), "Send")
+		if retries == producer.maxRetries {
+			break
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-producer.stopped:
+			return err
+		}
+		backoff *= 2
+		if backoff > producer.maxBackoff {
+			backoff = producer.maxBackoff
+		}
+	}
+
+	return err
+}
+
+func (producer *producer) sendMessage(topic string, message []byte) error {
+	logging.Debug(producer.logs, fmt.Sprintf("sending -> topic [%s] message %s", topic, message), "sendMessage")
+	deliveries, err := producer.produce(topic, message)
+	if err != nil {
+		return err
+	}
+
+	var event kafka.Event
+	select {
+	case event = <-deliveries:
+	case <-producer.stopped:
+		return errProducerClosed
+	}
+
+	delivered, ok := event.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery event: %s", event.String())
+	}
+
+	if delivered.TopicPartition.Error != nil {
+		return delivered.TopicPartition.Error
+	}
+
+	logging.Debug(producer.logs, "Sent kafka message", string(message))
+	return nil
+}
+
+// produce queues the message on the client unless it is closed, its delivery report is sent to the returned
+// channel.
+func (producer *producer) produce(topic string, message []byte) (chan kafka.Event, error) {
+	producer.lifecycle.RLock()
+	defer producer.lifecycle.RUnlock()
+	select {
+	case <-producer.stopped:
+		return nil, errProducerClosed
+	default:
+	}
+
+	deliveries := make(chan kafka.Event, 1)
+	err := producer.client.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: kafka.PartitionAny,
+		},
+		Value: message,
+	}, deliveries)
+
+	return deliveries, err
+}
+
+// Close waits for the in-flight sends and flushes the queued messages until ctx is done, then closes the client.
+// The sends still in flight at the deadline fail and Close returns the ctx error.
+func (producer *producer) Close(ctx context.Context) error {
+	producer.lifecycle.Lock()
+	if producer.closed {
+		producer.lifecycle.Unlock()
+		return nil
+	}
+	producer.closed = true
+	producer.lifecycle.Unlock()
+
+	sent := make(chan struct{})
+	go func() {
+		producer.sending.Wait()
+		close(sent)
+	}()
+
+	var err error
+	select {
+	case <-sent:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	timeout := defaultFlushTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	remaining := producer.client.Flush(int(timeout.Milliseconds()))
+	producer.lifecycle.Lock()
+	close(producer.stopped)
+	producer.client.Close()
+	producer.lifecycle.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if remaining > 0 {
+		return fmt.Errorf("%d messages were not delivered before closing the producer", remaining)
+	}
+
+	return nil
+}
+
+// logEvents drains the client events that are not delivery reports until the client is closed.
+func (producer *producer) logEvents() {
+	for event := range producer.client.Events() {
+		if err, ok := event.(kafka.Error); ok {
+			producer.logs.Error(fmt.Sprintf("kafka producer error: %s", err.Error()), "logEvents")
+		}
+	}
+}
+
+func WithMaxRetries(maxRetries int) ProducerOption {
+	return func(h *producer) {
+		h.maxRetries = maxRetries
+	}
+}
+
+func WithBackoff(initialBackoff, maxBackoff time.Duration) ProducerOption {
+	return func(h *producer) {
+		h.initialBackoff = initialBackoff
+		h.maxBackoff = maxBackoff
+	}
+}
+
+func WithDeliveryTimeout(deliveryTimeout time.Duration) ProducerOption {
+	return func(h *producer) {
+		h.deliveryTimeout = deliveryTimeout
+	}
+}
+
+// WithClient sends the messages through the given client instead of connecting to serverAddress.
+func WithClient(client Client) ProducerOption {
+	return func(h *producer) {
+		h.client = client
+	}
+}
@@ -0,0 +1,83 @@
+package kafka_test
+
+import (
+	"context"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom-bots/sdk/kafka"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"testing"
+	"time"
+)
+
+const (
+	// connectLatency and deliveryLatency stand for the broker bootstrap and the acknowledgement round trips. They
+	// are simulated, so the benchmarks show what sharing the client saves for given latencies, not broker timings.
+	connectLatency  = time.Millisecond
+	deliveryLatency = 100 * time.Microsecond
+	benchmarkTopic  = "stocks"
+)
+
+var benchmarkMessage = []byte(`{"room_id":"room1","message":"AAPL.US quote is $93.42 per share"}`)
+
+// fakeClient acknowledges every message after deliveryLatency, creating it costs connectLatency.
+type fakeClient struct {
+	events chan confluent.Event
+}
+
+func newFakeClient() *fakeClient {
+	time.Sleep(connectLatency)
+	return &fakeClient{events: make(chan confluent.Event)}
+}
+
+func (c *fakeClient) Produce(message *confluent.Message, deliveryChan chan confluent.Event) error {
+	go func() {
+		time.Sleep(deliveryLatency)
+		deliveryChan <- message
+	}()
+	return nil
+}
+
+func (c *fakeClient) Events() chan confluent.Event {
+	return c.events
+}
+
+func (c *fakeClient) Flush(_ int) int {
+	return 0
+}
+
+func (c *fakeClient) Close() {
+	close(c.events)
+}
+
+// Benchmark_Producer_Send_ClientPerMessage measures the former behavior, a client created and closed per message.
+func Benchmark_Producer_Send_ClientPerMessage(b *testing.B) {
+	logs := logger.NewLogger()
+	for i := 0; i < b.N; i++ {
+		producer, err := kafka.NewProducer(logs, "localhost:9092", kafka.WithClient(newFakeClient()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = producer.Send(benchmarkTopic, benchmarkMessage); err != nil {
+			b.Fatal(err)
+		}
+		if err = producer.Close(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Producer_Send_SharedClient(b *testing.B) {
+	logs := logger.NewLogger()
+	producer, err := kafka.NewProducer(logs, "localhost:9092", kafka.WithClient(newFakeClient()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer producer.Close(context.Background())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = producer.Send(benchmarkTopic, benchmarkMessage); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom-bots/sdk/kafka"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errBrokerDown = confluent.NewError(confluent.ErrTransport, "broker transport failure", false)
+
+// scriptedClient fails the first failures delivery reports and the first produceFailures Produce calls. When
+// hold is set the delivery reports wait for it to be closed.
+type scriptedClient struct {
+	mutex           sync.Mutex
+	produced        int
+	failures        int
+	produceFailures int
+	hold            chan struct{}
+	closed          bool
+	events          chan confluent.Event
+}
+
+func newScriptedClient() *scriptedClient {
+	return &scriptedClient{events: make(chan confluent.Event)}
+}
+
+func (c *scriptedClient) Produce(message *confluent.Message, deliveryChan chan confluent.Event) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return errors.New("produce on a closed client")
+	}
+
+	c.produced++
+	if c.produced <= c.produceFailures {
+		return errBrokerDown
+	}
+
+	report := *message
+	if c.produced <= c.produceFailures+c.failures {
+		report.TopicPartition.Error = errBrokerDown
+	}
+
+	go func(hold chan struct{}) {
+		if hold != nil {
+			<-hold
+		}
+		deliveryChan <- &report
+	}(c.hold)
+	return nil
+}
+
+func (c *scriptedClient) Events() chan confluent.Event {
+	return c.events
+}
+
+func (c *scriptedClient) Flush(_ int) int {
+	return 0
+}
+
+func (c *scriptedClient) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	close(c.events)
+}
+
+func (c *scriptedClient) producedCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.produced
+}
+
+func newTestProducer(t *testing.T, client *scriptedClient, opts ...kafka.ProducerOption) kafka.Producer {
+	opts = append([]kafka.ProducerOption{
+		kafka.WithClient(client),
+		kafka.WithBackoff(time.Millisecond, 4*time.Millisecond),
+	}, opts...)
+	producer, err := kafka.NewProducer(logger.NewLogger(), "localhost:9092", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return producer
+}
+
+func Test_Producer_Send(t *testing.T) {
+	t.Run("failed delivery reports are retried until delivered", func(t *testing.T) {
+		client := newScriptedClient()
+		client.failures = 2
+		producer := newTestProducer(t, client, kafka.WithMaxRetries(3))
+		defer producer.Close(context.Background())
+
+		if err := producer.Send(benchmarkTopic, benchmarkMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		if produced := client.producedCount(); produced != 3 {
+			t.Fatalf("expected 3 attempts, got %d", produced)
+		}
+	})
+
+	t.Run("produce errors are retried", func(t *testing.T) {
+		client := newScriptedClient()
+		client.produceFailures = 1
+		producer := newTestProducer(t, client, kafka.WithMaxRetries(2))
+		defer producer.Close(context.Background())
+
+		if err := producer.Send(benchmarkTopic, benchmarkMessage); err != nil {
+			t.Fatal(err)
+		}
+
+		if produced := client.producedCount(); produced != 2 {
+			t.Fatalf("expected 2 attempts, got %d", produced)
+		}
+	})
+
+	t.Run("delivery error is returned once the retries run out", func(t *testing.T) {
+		client := newScriptedClient()
+		client.failures = 5
+		producer := newTestProducer(t, client, kafka.WithMaxRetries(2))
+		defer producer.Close(context.Background())
+
+		err := producer.Send(benchmarkTopic, benchmarkMessage)
+
+		var kafkaErr confluent.Error
+		if !errors.As(err, &kafkaErr) || kafkaErr.Code() != confluent.ErrTransport {
+			t.Fatalf("expected the delivery error, got %v", err)
+		}
+		if produced := client.producedCount(); produced != 2 {
+			t.Fatalf("expected 2 attempts, got %d", produced)
+		}
+	})
+
+	t.Run("max retries below one are rejected", func(t *testing.T) {
+		_, err := kafka.NewProducer(logger.NewLogger(), "localhost:9092",
+			kafka.WithClient(newScriptedClient()), kafka.WithMaxRetries(0))
+
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func Test_Producer_Close(t *testing.T) {
+	t.Run("in-flight send is delivered before closing", func(t *testing.T) {
+		client := newScriptedClient()
+		client.hold = make(chan struct{})
+		producer := newTestProducer(t, client)
+		sent := make(chan error, 1)
+		go func() {
+			sent <- producer.Send(benchmarkTopic, benchmarkMessage)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- producer.Close(context.Background())
+		}()
+		select {
+		case err := <-closed:
+			t.Fatalf("close returned before the in-flight send: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(client.hold)
+
+		if err := <-sent; err != nil {
+			t.Fatal(err)
+		}
+		if err := <-closed; err != nil {
+			t.Fatal(err)
+		}
+		if err := producer.Send(benchmarkTopic, benchmarkMessage); err == nil {
+			t.Fatal("expected an error sending on a closed producer")
+		}
+	})
+
+	t.Run("close gives up on the in-flight send at its deadline", func(t *testing.T) {
+		client := newScriptedClient()
+		client.hold = make(chan struct{})
+		defer close(client.hold)
+		producer := newTestProducer(t, client)
+		sent := make(chan error, 1)
+		go func() {
+			sent <- producer.Send(benchmarkTopic, benchmarkMessage)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := producer.Close(ctx)
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("close took %s", elapsed)
+		}
+		select {
+		case err = <-sent:
+			if err == nil {
+				t.Fatal("expected the in-flight send to fail")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("in-flight send is still blocked")
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package sdk
+
+import (
+	"fmt"
+	"github.com/sebastianreh/chatroom-bots/sdk/logging"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"strings"
+)
+
+// fieldLogger appends its fields, as key=value pairs, to every message of the wrapped logger.
+type fieldLogger struct {
+	logs   logger.Logger
+	fields string
+}
+
+func newFieldLogger(logs logger.Logger, keyValuePairs ...interface{}) logger.Logger {
+	fields := make([]string, 0, len(keyValuePairs)/2)
+	for i := 0; i+1 < len(keyValuePairs); i += 2 {
+		fields = append(fields, fmt.Sprintf("%v=%v", keyValuePairs[i], keyValuePairs[i+1]))
+	}
+
+	return &fieldLogger{logs: logs, fields: strings.Join(fields, " ")}
+}
+
+func (l *fieldLogger) Debug(msg string, keyValuePairs ...interface{}) {
+	logging.Debug(l.logs, l.with(msg), keyValuePairs...)
+}
+
+func (l *fieldLogger) Info(msg string, keyValuePairs ...interface{}) {
+	l.logs.Info(l.with(msg), keyValuePairs...)
+}
+
+func (l *fieldLogger) Warn(msg string, keyValuePairs ...interface{}) {
+	l.logs.Warn(l.with(msg), keyValuePairs...)
+}
+
+func (l *fieldLogger) Error(msg string, keyValuePairs ...interface{}) {
+	l.logs.Error(l.with(msg), keyValuePairs...)
+}
+
+func (l *fieldLogger) Fatal(msg string) {
+	l.logs.Fatal(l.with(msg))
+}
+
+func (l *fieldLogger) with(msg string) string {
+	return fmt.Sprintf("%s [%s]", msg, l.fields)
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger is the chatroom logger with a debug level, for the entries logged on every message.
+type Logger interface {
+	logger.Logger
+	Debug(msg string, keyValuePairs ...interface{})
+}
+
+type zapLogger struct {
+	sugaredLogger *zap.SugaredLogger
+}
+
+// NewLogger logs the entries of level and above in the format of the chatroom logger, level is one of debug,
+// info, warn or error.
+func NewLogger(level string) (Logger, error) {
+	var atomicLevel zap.AtomicLevel
+	if err := atomicLevel.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+
+	config := zap.NewDevelopmentConfig()
+	config.Level = atomicLevel
+	config.EncoderConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
+	config.EncoderConfig.CallerKey = ""
+	config.DisableStacktrace = true
+	log, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return &zapLogger{sugaredLogger: log.Sugar()}, nil
+}
+
+func (l *zapLogger) Debug(msg string, keyValuePairs ...interface{}) {
+	l.sugaredLogger.Debugf(msg+". origin: %s", keyValuePairs...)
+}
+
+func (l *zapLogger) Info(msg string, keyValuePairs ...interface{}) {
+	l.sugaredLogger.Infof(msg+" %s ", keyValuePairs...)
+}
+
+func (l *zapLogger) Warn(msg string, keyValuePairs ...interface{}) {
+	l.sugaredLogger.Warnf(msg+". origin: %s", keyValuePairs...)
+}
+
+func (l *zapLogger) Error(msg string, keyValuePairs ...interface{}) {
+	l.sugaredLogger.Errorf(msg+". origin: %s", keyValuePairs...)
+}
+
+func (l *zapLogger) Fatal(msg string) {
+	l.sugaredLogger.Fatalf(msg)
+}
+
+// Debug logs through logs when it has a debug level, the entry is dropped otherwise.
+func Debug(logs logger.Logger, msg string, keyValuePairs ...interface{}) {
+	if debugLogger, ok := logs.(Logger); ok {
+		debugLogger.Debug(msg, keyValuePairs...)
+	}
+}
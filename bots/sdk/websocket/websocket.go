@@ -0,0 +1,351 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	messagesBufferSize = 64
+
+	ConnectingState   = "connecting"
+	ConnectedState    = "connected"
+	ReconnectingState = "reconnecting"
+)
+
+// ErrClosed is returned by ReadMessage once the websocket is closed.
+var ErrClosed = errors.New("websocket closed")
+
+// Websocket holds one connection per room the bot serves and merges the commands received from all of them.
+// Lost connections are dialed again with a jittered exponential backoff until the room is left.
+type Websocket interface {
+	ReadMessage() (entities.BotMessage, error)
+	SetRooms(roomIDs []string)
+	Rooms() []string
+	Status() []RoomStatus
+	Close()
+}
+
+// RoomStatus is the connection state of a room.
+type RoomStatus struct {
+	RoomID    string    `json:"room_id"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+type websocket struct {
+	logger.Logger
+	config   config.Config
+	botName  string
+	commands []entities.CommandDefinition
+	// rooms routes every room the bot serves to its connection.
+	rooms    map[string]*room
+	messages chan entities.BotMessage
+	done     chan struct{}
+	mutex    sync.Mutex
+}
+
+// room keeps the connection of a room, left is closed once the bot leaves it.
+type room struct {
+	status RoomStatus
+	socket *ws.Conn
+	left   chan struct{}
+}
+
+// NewWebsocket returns a bot websocket without rooms, SetRooms connects it to the rooms it serves.
+func NewWebsocket(logs logger.Logger, cfg config.Config, botName string, commands []entities.CommandDefinition) Websocket {
+	return &websocket{
+		Logger:   logs,
+		config:   cfg,
+		botName:  botName,
+		commands: commands,
+		rooms:    make(map[string]*room),
+		messages: make(chan entities.BotMessage, messagesBufferSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// SetRooms starts connecting to the rooms the bot doesn't serve yet and leaves the ones missing from roomIDs.
+func (w *websocket) SetRooms(roomIDs []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed() {
+		return
+	}
+
+	wanted := make(map[string]bool, len(roomIDs))
+	for _, roomID := range roomIDs {
+		wanted[roomID] = true
+		if _, ok := w.rooms[roomID]; ok {
+			continue
+		}
+
+		joined := &room{
+			status: RoomStatus{RoomID: roomID, State: ConnectingState, Since: time.Now().UTC()},
+			left:   make(chan struct{}),
+		}
+		w.rooms[roomID] = joined
+		go w.maintain(joined)
+	}
+
+	for roomID, joined := range w.rooms {
+		if !wanted[roomID] {
+			w.leave(joined)
+			w.Logger.Info("left room", "roomID", roomID)
+		}
+	}
+}
+
+// Rooms returns the rooms the bot serves, connected or not.
+func (w *websocket) Rooms() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	roomIDs := make([]string, 0, len(w.rooms))
+	for roomID := range w.rooms {
+		roomIDs = append(roomIDs, roomID)
+	}
+
+	sort.Strings(roomIDs)
+	return roomIDs
+}
+
+// Status returns the connection state of every room, sorted by room.
+func (w *websocket) Status() []RoomStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	statuses := make([]RoomStatus, 0, len(w.rooms))
+	for _, joined := range w.rooms {
+		statuses = append(statuses, joined.status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RoomID < statuses[j].RoomID
+	})
+	return statuses
+}
+
+// ReadMessage returns the next command received from any room, its RoomID tells where to reply.
+func (w *websocket) ReadMessage() (entities.BotMessage, error) {
+	select {
+	case message := <-w.messages:
+		return message, nil
+	case <-w.done:
+		return entities.BotMessage{}, ErrClosed
+	}
+}
+
+// Close disconnects the bot from every room.
+func (w *websocket) Close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed() {
+		return
+	}
+
+	close(w.done)
+	for _, joined := range w.rooms {
+		w.leave(joined)
+	}
+}
+
+func (w *websocket) closed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// leave stops the room connection, the caller holds the mutex.
+func (w *websocket) leave(joined *room) {
+	delete(w.rooms, joined.status.RoomID)
+	close(joined.left)
+	if joined.socket != nil {
+		_ = joined.socket.Close()
+	}
+}
+
+// maintain connects to the room and reads its commands, dialing again after every disconnection until the bot
+// leaves the room. The commands are registered on every connection, so a restarted server gets them back.
+func (w *websocket) maintain(joined *room) {
+	roomID := joined.status.RoomID
+	attempt := 0
+	for {
+		socket, err := w.connect(roomID)
+		if err == nil && w.setConnected(joined, socket) {
+			attempt = 0
+			w.Logger.Info("joined room", "roomID", roomID)
+			err = w.read(roomID, socket)
+		} else if err == nil {
+			_ = socket.Close()
+			return
+		}
+
+		select {
+		case <-joined.left:
+			return
+		default:
+		}
+
+		attempt++
+		backoff := w.backoff(attempt)
+		w.setReconnecting(joined, attempt, err)
+		w.Logger.Warn("room connection lost, reconnecting", "roomID", roomID, "attempt", attempt,
+			"backoff", backoff.String(), "error", err.Error())
+
+		select {
+		case <-joined.left:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// setConnected records the room connection, unless the room was left while dialing.
+func (w *websocket) setConnected(joined *room, socket *ws.Conn) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	select {
+	case <-joined.left:
+		return false
+	default:
+	}
+
+	joined.socket = socket
+	joined.status = RoomStatus{RoomID: joined.status.RoomID, State: ConnectedState, Since: time.Now().UTC()}
+	return true
+}
+
+func (w *websocket) setReconnecting(joined *room, attempt int, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if joined.status.State == ConnectedState {
+		joined.status.Since = time.Now().UTC()
+	}
+
+	joined.socket = nil
+	joined.status.State = ReconnectingState
+	joined.status.Attempts = attempt
+	joined.status.LastError = err.Error()
+}
+
+// backoff doubles the initial backoff on every attempt up to the maximum, and picks a random duration between
+// half of it and all of it so the bots reconnecting after a server restart don't dial at the same time.
+func (w *websocket) backoff(attempt int) time.Duration {
+	backoff := w.config.Websocket.ReconnectInitialBackoff
+	for i := 1; i < attempt && backoff < w.config.Websocket.ReconnectMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > w.config.Websocket.ReconnectMaxBackoff {
+		backoff = w.config.Websocket.ReconnectMaxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// connect dials the room and registers the bot commands.
+func (w *websocket) connect(roomID string) (*ws.Conn, error) {
+	url := fmt.Sprintf("%s?bot_name=%s&room_id=%s", w.config.Websocket.Endpoint, w.botName, roomID)
+	socket, err := getSocket(url, w.config)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = registerCommands(socket, roomID, w.commands); err != nil {
+		_ = socket.Close()
+		return nil, err
+	}
+
+	return socket, nil
+}
+
+// read forwards the commands of the room until its connection fails.
+func (w *websocket) read(roomID string, socket *ws.Conn) error {
+	for {
+		_, msgBytes, err := socket.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		envelope := new(entities.Envelope)
+		if err = json.Unmarshal(msgBytes, envelope); err != nil {
+			w.Logger.Error("error reading message", "ReadMessage", err.Error())
+			continue
+		}
+
+		if envelope.Type != entities.BotCommandFrameType {
+			continue
+		}
+
+		botMessage := new(entities.BotMessage)
+		if err = json.Unmarshal(envelope.Payload, botMessage); err != nil {
+			w.Logger.Error("error reading message", "ReadMessage", err.Error())
+			continue
+		}
+
+		if botMessage.RoomID == "" {
+			botMessage.RoomID = roomID
+		}
+
+		select {
+		case w.messages <- *botMessage:
+		case <-w.done:
+			return ErrClosed
+		}
+	}
+}
+
+// getSocket dials the server authenticating with the bot API key and offering permessage-deflate when compression
+// is enabled, the server decides whether it is used.
+func getSocket(url string, cfg config.Config) (*ws.Conn, error) {
+	dialer := *ws.DefaultDialer
+	dialer.EnableCompression = cfg.Websocket.Compression
+	dialer.ReadBufferSize = cfg.Websocket.ReadBufferSize
+	dialer.WriteBufferSize = cfg.Websocket.WriteBufferSize
+
+	header := http.Header{"Authorization": []string{"Bearer " + cfg.Websocket.APIKey}}
+	conn, response, err := dialer.Dial(url, header)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusUnauthorized {
+			return conn, fmt.Errorf("bot rejected by the server, check BOT_API_KEY and that the room enables it: %w", err)
+		}
+		return conn, err
+	}
+
+	if err = conn.SetCompressionLevel(cfg.Websocket.CompressionLevel); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func registerCommands(socket *ws.Conn, roomID string, commands []entities.CommandDefinition) error {
+	payload, err := json.Marshal(entities.CommandRegistration{Commands: commands})
+	if err != nil {
+		return err
+	}
+
+	return socket.WriteJSON(entities.Envelope{
+		Type:      entities.CommandRegistrationFrameType,
+		Version:   entities.ProtocolVersion,
+		RoomID:    roomID,
+		Payload:   payload,
+		Timestamp: time.Now().UTC(),
+	})
+}
@@ -0,0 +1,155 @@
+package websocket_test
+
+import (
+	"encoding/json"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/entities"
+	"github.com/sebastianreh/chatroom-bots/sdk/websocket"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer accepts bot connections, hands every registered connection to the test and rejects the dials while
+// down is set.
+type fakeServer struct {
+	*httptest.Server
+	connections chan *ws.Conn
+	down        chan bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	server := &fakeServer{connections: make(chan *ws.Conn, 8), down: make(chan bool, 1)}
+	server.down <- false
+	upgrader := ws.Upgrader{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		down := <-server.down
+		server.down <- down
+		if down {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(writer, request, nil)
+		if err != nil {
+			t.Errorf("upgrading connection: %s", err.Error())
+			return
+		}
+
+		var registration entities.Envelope
+		if err = conn.ReadJSON(&registration); err != nil || registration.Type != entities.CommandRegistrationFrameType {
+			t.Errorf("expected a command registration, got %+v (%v)", registration, err)
+		}
+		server.connections <- conn
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *fakeServer) setDown(down bool) {
+	<-s.down
+	s.down <- down
+}
+
+func (s *fakeServer) accept(t *testing.T) *ws.Conn {
+	select {
+	case conn := <-s.connections:
+		return conn
+	case <-time.After(2 * time.Second):
+		t.Fatal("bot did not connect")
+		return nil
+	}
+}
+
+func newConfig(url string) config.Config {
+	var cfg config.Config
+	cfg.Websocket.Endpoint = "ws" + strings.TrimPrefix(url, "http")
+	cfg.Websocket.CompressionLevel = 1
+	cfg.Websocket.ReconnectInitialBackoff = 10 * time.Millisecond
+	cfg.Websocket.ReconnectMaxBackoff = 40 * time.Millisecond
+	return cfg
+}
+
+func waitState(t *testing.T, socket websocket.Websocket, state string) websocket.RoomStatus {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if statuses := socket.Status(); len(statuses) == 1 && statuses[0].State == state {
+			return statuses[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("room did not reach the %s state, status: %+v", state, socket.Status())
+	return websocket.RoomStatus{}
+}
+
+func Test_Websocket_Reconnect(t *testing.T) {
+	logs := logger.NewLogger()
+
+	t.Run("reconnects and registers the commands again after the server drops the connection", func(t *testing.T) {
+		server := newFakeServer(t)
+		socket := websocket.NewWebsocket(logs, newConfig(server.URL), "stock", []entities.CommandDefinition{{Name: "stock"}})
+		defer socket.Close()
+
+		socket.SetRooms([]string{"room1"})
+		first := server.accept(t)
+		waitState(t, socket, websocket.ConnectedState)
+
+		server.setDown(true)
+		_ = first.Close()
+		status := waitState(t, socket, websocket.ReconnectingState)
+		if status.Attempts == 0 || status.LastError == "" {
+			t.Fatalf("expected the failed attempts to be reported, status: %+v", status)
+		}
+
+		server.setDown(false)
+		second := server.accept(t)
+		waitState(t, socket, websocket.ConnectedState)
+
+		payload, _ := json.Marshal(entities.BotMessage{Command: "stock", Value: "aapl.us"})
+		err := second.WriteJSON(entities.Envelope{Type: entities.BotCommandFrameType, RoomID: "room1", Payload: payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, err := socket.ReadMessage()
+		if err != nil || message.RoomID != "room1" || message.Value != "aapl.us" {
+			t.Fatalf("unexpected message %+v (%v)", message, err)
+		}
+	})
+
+	t.Run("left rooms are not reconnected", func(t *testing.T) {
+		server := newFakeServer(t)
+		socket := websocket.NewWebsocket(logs, newConfig(server.URL), "stock", nil)
+		defer socket.Close()
+
+		socket.SetRooms([]string{"room1"})
+		server.accept(t)
+		socket.SetRooms(nil)
+
+		select {
+		case <-server.connections:
+			t.Fatal("bot reconnected to a room it left")
+		case <-time.After(100 * time.Millisecond):
+		}
+		if len(socket.Rooms()) != 0 {
+			t.Fatalf("expected no rooms, got %v", socket.Rooms())
+		}
+	})
+
+	t.Run("read message fails once closed", func(t *testing.T) {
+		socket := websocket.NewWebsocket(logs, newConfig("http://localhost:0"), "stock", nil)
+		socket.Close()
+
+		_, err := socket.ReadMessage()
+
+		if err != websocket.ErrClosed {
+			t.Fatalf("expected ErrClosed, got %v", err)
+		}
+	})
+}
@@ -1,6 +0,0 @@
-package entities
-
-type BotMessage struct {
-	Command string `json:"command"`
-	Value   string `json:"value"`
-}
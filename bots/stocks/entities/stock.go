@@ -5,44 +5,226 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
 const (
-	MessageFormat = "%s quote is $%v per share"
+	MessageFormat         = "%s quote is $%v per share"
+	NotFoundMessageFormat = "Symbol '%s' not found, check the code, like aapl.us"
+	ErrorMessageFormat    = "Could not get the quote of '%s', try again later"
+
+	// quoteError is the value of the average column for the quotes that could not be fetched.
+	quoteError = "error, try again later"
+
+	// notAvailable is the value of every column but the symbol for the symbols Stooq doesn't know.
+	notAvailable = "N/D"
+
+	symbolColumn = "symbol"
+	dateColumn   = "date"
+	timeColumn   = "time"
+	openColumn   = "open"
+	highColumn   = "high"
+	lowColumn    = "low"
+	closeColumn  = "close"
+	volumeColumn = "volume"
 )
 
+// requiredColumns are the columns a Stooq CSV must have, the other ones are read when present.
+var requiredColumns = []string{symbolColumn, openColumn, highColumn, lowColumn, closeColumn}
+
 type StockMessage struct {
 	RoomID    string    `json:"room_id"`
 	Message   string    `json:"bot_message"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
-func MapRecordsToStock(roomID string, records [][]string) (StockMessage, error) {
-	var stock StockMessage
-	if len(records) != 2 {
-		return stock, errors.New("records len is not 2")
+// Quote is a row of the Stooq CSV. Found is false for the symbols Stooq doesn't know, which only have Symbol, and
+// for the quotes that could not be fetched, which have the reason in Err.
+type Quote struct {
+	Symbol string
+	Date   string
+	Time   string
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+	Found  bool
+	Err    error
+}
+
+// QuoteColumns are the optional columns of the quotes table.
+type QuoteColumns struct {
+	Open   bool
+	Close  bool
+	Volume bool
+	Change bool
+}
+
+func (c QuoteColumns) Any() bool {
+	return c.Open || c.Close || c.Volume || c.Change
+}
+
+// Average is the average of the high and low prices, rounded to 2 decimals.
+func (q Quote) Average() float64 {
+	return roundTo2Decimals((q.High + q.Low) / 2)
+}
+
+// Change is the percent change of the close price versus the open price, rounded to 2 decimals.
+func (q Quote) Change() float64 {
+	if q.Open == 0 {
+		return 0
+	}
+
+	return roundTo2Decimals((q.Close - q.Open) / q.Open * 100)
+}
+
+// MapRecordsToQuotes maps the rows of a Stooq CSV to quotes, the columns are found by the header names in the
+// first record.
+func MapRecordsToQuotes(records [][]string) ([]Quote, error) {
+	if len(records) < 2 {
+		return nil, errors.New("the stock csv has no quotes")
+	}
+
+	columns := make(map[string]int, len(records[0]))
+	for index, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = index
+	}
+
+	for _, column := range requiredColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("the stock csv header has no %s column: %v", column, records[0])
+		}
+	}
+
+	quotes := make([]Quote, 0, len(records)-1)
+	for _, record := range records[1:] {
+		quote, err := mapRecordToQuote(columns, record)
+		if err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, quote)
+	}
+
+	return quotes, nil
+}
+
+func mapRecordToQuote(columns map[string]int, record []string) (Quote, error) {
+	value := func(column string) string {
+		index, ok := columns[column]
+		if !ok || index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	quote := Quote{Symbol: value(symbolColumn)}
+	if value(closeColumn) == notAvailable {
+		return quote, nil
+	}
+
+	quote.Date = value(dateColumn)
+	quote.Time = value(timeColumn)
+	prices := map[string]*float64{
+		openColumn:  &quote.Open,
+		highColumn:  &quote.High,
+		lowColumn:   &quote.Low,
+		closeColumn: &quote.Close,
+	}
+	for column, price := range prices {
+		parsed, err := strconv.ParseFloat(value(column), 64)
+		if err != nil {
+			return quote, fmt.Errorf("error parsing the %s price of %s: %w", column, quote.Symbol, err)
+		}
+		*price = parsed
 	}
 
-	data := records[1]
-	high, err := strconv.ParseFloat(data[4], 64)
-	if err != nil {
-		return stock, err
+	if volume := value(volumeColumn); volume != "" && volume != notAvailable {
+		parsed, err := strconv.ParseInt(volume, 10, 64)
+		if err != nil {
+			return quote, fmt.Errorf("error parsing the volume of %s: %w", quote.Symbol, err)
+		}
+		quote.Volume = parsed
 	}
 
-	low, err := strconv.ParseFloat(data[5], 64)
-	if err != nil {
-		return stock, err
+	quote.Found = true
+	return quote, nil
+}
+
+// MapQuoteToStock returns the message replying with the quote, or telling its symbol was not found or its quote
+// could not be fetched.
+func MapQuoteToStock(roomID string, quote Quote) StockMessage {
+	message := fmt.Sprintf(NotFoundMessageFormat, quote.Symbol)
+	if quote.Err != nil {
+		message = fmt.Sprintf(ErrorMessageFormat, quote.Symbol)
+	} else if quote.Found {
+		message = fmt.Sprintf(MessageFormat, quote.Symbol, quote.Average())
 	}
 
-	average := roundTo2Decimals((high + low) / 2)
-	stockMessage := StockMessage{
+	return StockMessage{
 		RoomID:    roomID,
-		Message:   fmt.Sprintf(MessageFormat, data[0], average),
+		Message:   message,
 		CreatedAt: time.Now().UTC(),
 	}
+}
 
-	return stockMessage, nil
+// MapQuotesToStock returns the message replying with the quotes. A single quote without optional columns gets the
+// usual sentence, otherwise the quotes are laid out as a table with the average price and the requested columns.
+func MapQuotesToStock(roomID string, quotes []Quote, columns QuoteColumns) StockMessage {
+	if len(quotes) == 1 && !columns.Any() {
+		return MapQuoteToStock(roomID, quotes[0])
+	}
+
+	header := []string{"Symbol", "Average"}
+	optional := []struct {
+		enabled bool
+		name    string
+		value   func(Quote) string
+	}{
+		{columns.Open, "Open", func(q Quote) string { return fmt.Sprintf("%.2f", q.Open) }},
+		{columns.Close, "Close", func(q Quote) string { return fmt.Sprintf("%.2f", q.Close) }},
+		{columns.Volume, "Volume", func(q Quote) string { return strconv.FormatInt(q.Volume, 10) }},
+		{columns.Change, "Change", func(q Quote) string { return fmt.Sprintf("%+.2f%%", q.Change()) }},
+	}
+	for _, column := range optional {
+		if column.enabled {
+			header = append(header, column.name)
+		}
+	}
+
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, strings.Join(header, "\t"))
+	for _, quote := range quotes {
+		row := []string{quote.Symbol, "not found"}
+		if quote.Err != nil {
+			row[1] = quoteError
+		} else if quote.Found {
+			row[1] = fmt.Sprintf("%.2f", quote.Average())
+		}
+		for _, column := range optional {
+			if column.enabled && quote.Found {
+				row = append(row, column.value(quote))
+			} else if column.enabled {
+				row = append(row, "")
+			}
+		}
+		_, _ = fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	_ = writer.Flush()
+
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+
+	return StockMessage{
+		RoomID:    roomID,
+		Message:   strings.Join(lines, "\n"),
+		CreatedAt: time.Now().UTC(),
+	}
 }
 
 func roundTo2Decimals(value float64) float64 {
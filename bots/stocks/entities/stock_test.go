@@ -0,0 +1,128 @@
+package entities_test
+
+import (
+	"errors"
+	"github.com/sebastianreh/chatroom-bots/stocks/entities"
+	"reflect"
+	"testing"
+)
+
+func Test_MapRecordsToQuotes(t *testing.T) {
+	t.Run("columns are mapped by their header name", func(t *testing.T) {
+		records := [][]string{
+			{"Symbol", "Date", "Time", "Open", "High", "Low", "Close", "Volume"},
+			{"AAPL.US", "2023-10-06", "22:00:09", "173.8", "177.99", "173.18", "177.49", "57266675"},
+		}
+
+		quotes, err := entities.MapRecordsToQuotes(records)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []entities.Quote{{
+			Symbol: "AAPL.US", Date: "2023-10-06", Time: "22:00:09", Open: 173.8, High: 177.99, Low: 173.18,
+			Close: 177.49, Volume: 57266675, Found: true,
+		}}
+		if !reflect.DeepEqual(expected, quotes) {
+			t.Fatalf("unexpected quotes %+v", quotes)
+		}
+		if average := quotes[0].Average(); average != 175.59 {
+			t.Fatalf("unexpected average %v", average)
+		}
+	})
+
+	t.Run("column order and missing optional columns don't matter", func(t *testing.T) {
+		records := [][]string{
+			{"Close", "Low", "High", "Open", "Symbol"},
+			{"1.07", "1.05", "1.08", "1.06", "EURUSD"},
+		}
+
+		quotes, err := entities.MapRecordsToQuotes(records)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []entities.Quote{{Symbol: "EURUSD", Open: 1.06, High: 1.08, Low: 1.05, Close: 1.07, Found: true}}
+		if !reflect.DeepEqual(expected, quotes) {
+			t.Fatalf("unexpected quotes %+v", quotes)
+		}
+	})
+
+	t.Run("unknown symbol is not found", func(t *testing.T) {
+		records := [][]string{
+			{"Symbol", "Date", "Time", "Open", "High", "Low", "Close", "Volume"},
+			{"FOO.US", "N/D", "N/D", "N/D", "N/D", "N/D", "N/D", "N/D"},
+		}
+
+		quotes, err := entities.MapRecordsToQuotes(records)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([]entities.Quote{{Symbol: "FOO.US"}}, quotes) {
+			t.Fatalf("unexpected quotes %+v", quotes)
+		}
+		message := entities.MapQuoteToStock("room1", quotes[0])
+		if message.Message != "Symbol 'FOO.US' not found, check the code, like aapl.us" {
+			t.Fatalf("unexpected message %q", message.Message)
+		}
+	})
+
+	t.Run("csv without the price columns is rejected", func(t *testing.T) {
+		records := [][]string{{"Exceeded the daily hits limit"}, {""}}
+
+		if _, err := entities.MapRecordsToQuotes(records); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func Test_MapQuotesToStock(t *testing.T) {
+	aapl := entities.Quote{Symbol: "AAPL.US", Open: 173.8, High: 177.99, Low: 173.18, Close: 177.49, Volume: 57266675,
+		Found: true}
+	foo := entities.Quote{Symbol: "FOO.US"}
+
+	t.Run("single quote without columns keeps the sentence", func(t *testing.T) {
+		message := entities.MapQuotesToStock("room1", []entities.Quote{aapl}, entities.QuoteColumns{})
+
+		if message.Message != "AAPL.US quote is $175.59 per share" {
+			t.Fatalf("unexpected message %q", message.Message)
+		}
+	})
+
+	t.Run("quotes are laid out as a table with the requested columns", func(t *testing.T) {
+		columns := entities.QuoteColumns{Close: true, Change: true}
+
+		message := entities.MapQuotesToStock("room1", []entities.Quote{aapl, foo}, columns)
+
+		expected := "Symbol   Average    Close   Change\n" +
+			"AAPL.US  175.59     177.49  +2.12%\n" +
+			"FOO.US   not found"
+		if message.Message != expected {
+			t.Fatalf("unexpected message %q", message.Message)
+		}
+	})
+
+	t.Run("quote that could not be fetched reports the error in its row", func(t *testing.T) {
+		msft := entities.Quote{Symbol: "MSFT.US", Err: errors.New("stooq unavailable")}
+
+		message := entities.MapQuotesToStock("room1", []entities.Quote{aapl, msft}, entities.QuoteColumns{})
+
+		expected := "Symbol   Average\n" +
+			"AAPL.US  175.59\n" +
+			"MSFT.US  error, try again later"
+		if message.Message != expected {
+			t.Fatalf("unexpected message %q", message.Message)
+		}
+	})
+
+	t.Run("single quote that could not be fetched is reported", func(t *testing.T) {
+		msft := entities.Quote{Symbol: "MSFT.US", Err: errors.New("stooq unavailable")}
+
+		message := entities.MapQuotesToStock("room1", []entities.Quote{msft}, entities.QuoteColumns{})
+
+		if message.Message != "Could not get the quote of 'MSFT.US', try again later" {
+			t.Fatalf("unexpected message %q", message.Message)
+		}
+	})
+}
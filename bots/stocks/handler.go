@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sebastianreh/chatroom-bots/sdk"
+	"github.com/sebastianreh/chatroom-bots/stocks/entities"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/csv"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/rest"
+	"strings"
+	"sync"
+)
+
+const (
+	maxSymbols   = 10
+	optionPrefix = "--"
+
+	// stockArgPattern matches the symbols and the options of the command.
+	stockArgPattern = `[\w.]+|--[a-z]+`
+	stockHelp       = "Gets the quotes of stocks, like /stock aapl.us msft.us, add --open, --close, --volume, " +
+		"--change or --all for more columns"
+)
+
+// stockRequest is a /stock command: the symbols to quote, in order and without repetitions, and the optional
+// columns of the reply.
+type stockRequest struct {
+	symbols []string
+	columns entities.QuoteColumns
+}
+
+type stockHandler struct {
+	client rest.StooqClient
+}
+
+// Handle replies to the room with the quotes of the stocks, the symbols Stooq doesn't know are reported as not
+// found. Usage errors are replied to the room too.
+func (h stockHandler) Handle(ctx *sdk.Context) error {
+	request, err := parseStockArgs(ctx.Args())
+	if err != nil {
+		return ctx.Reply(err.Error())
+	}
+
+	quotes := h.getQuotes(request.symbols)
+	for _, quote := range quotes {
+		if quote.Err != nil {
+			ctx.Log().Error(fmt.Sprintf("failed to get the quote of %s: %s", quote.Symbol, quote.Err.Error()), "Handle")
+		}
+	}
+
+	stockMessage := entities.MapQuotesToStock(ctx.RoomID(), quotes, request.columns)
+	return ctx.Reply(stockMessage.Message)
+}
+
+// getQuotes gets the quotes of the symbols concurrently, in the order of the symbols. A quote that could not be
+// fetched only has its symbol and the error, the others are still returned.
+func (h stockHandler) getQuotes(symbols []string) []entities.Quote {
+	quotes := make([]entities.Quote, len(symbols))
+
+	var requests sync.WaitGroup
+	for i, symbol := range symbols {
+		requests.Add(1)
+		go func(i int, symbol string) {
+			defer requests.Done()
+			quote, err := h.getQuote(symbol)
+			if err != nil {
+				quote = entities.Quote{Symbol: strings.ToUpper(symbol), Err: err}
+			}
+			quotes[i] = quote
+		}(i, symbol)
+	}
+	requests.Wait()
+
+	return quotes
+}
+
+func (h stockHandler) getQuote(symbol string) (entities.Quote, error) {
+	stockCSV, err := h.client.GetStockCSV(symbol)
+	if err != nil {
+		return entities.Quote{}, err
+	}
+
+	stockRecords, err := csv.ReadStockCsv(stockCSV)
+	if err != nil {
+		return entities.Quote{}, fmt.Errorf("error reading stock csv of %s: %w", symbol, err)
+	}
+
+	quotes, err := entities.MapRecordsToQuotes(stockRecords)
+	if err != nil {
+		return entities.Quote{}, fmt.Errorf("error mapping records for stock %s: %w", symbol, err)
+	}
+
+	return quotes[0], nil
+}
+
+// parseStockArgs splits the arguments into symbols and options, the error messages are meant for the room.
+func parseStockArgs(args []string) (stockRequest, error) {
+	var request stockRequest
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, optionPrefix) {
+			symbol := strings.ToLower(arg)
+			if !seen[symbol] {
+				seen[symbol] = true
+				request.symbols = append(request.symbols, symbol)
+			}
+			continue
+		}
+
+		switch strings.TrimPrefix(arg, optionPrefix) {
+		case "open":
+			request.columns.Open = true
+		case "close":
+			request.columns.Close = true
+		case "volume":
+			request.columns.Volume = true
+		case "change":
+			request.columns.Change = true
+		case "all":
+			request.columns = entities.QuoteColumns{Open: true, Close: true, Volume: true, Change: true}
+		default:
+			return request, fmt.Errorf("unknown option '%s', use --open, --close, --volume, --change or --all", arg)
+		}
+	}
+
+	if len(request.symbols) == 0 {
+		return request, errors.New("no stock code given, like /stock aapl.us")
+	}
+
+	if len(request.symbols) > maxSymbols {
+		return request, fmt.Errorf("up to %d stocks can be quoted at once", maxSymbols)
+	}
+
+	return request, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"github.com/sebastianreh/chatroom-bots/stocks/entities"
+	"reflect"
+	"testing"
+)
+
+// failingStooqClient fails to get the quotes of the symbols in failures.
+type failingStooqClient struct {
+	failures map[string]bool
+}
+
+func (c failingStooqClient) GetStockCSV(stockName string) ([]byte, error) {
+	if c.failures[stockName] {
+		return nil, errors.New("stooq unavailable")
+	}
+
+	return []byte("Symbol,Date,Time,Open,High,Low,Close,Volume\n" +
+		"AAPL.US,2023-10-06,22:00:09,173.8,177.99,173.18,177.49,57266675\n"), nil
+}
+
+func Test_parseStockArgs(t *testing.T) {
+	t.Run("symbols are deduplicated and options enable columns", func(t *testing.T) {
+		request, err := parseStockArgs([]string{"aapl.us", "--change", "MSFT.US", "AAPL.US", "--volume"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := stockRequest{
+			symbols: []string{"aapl.us", "msft.us"},
+			columns: entities.QuoteColumns{Volume: true, Change: true},
+		}
+		if !reflect.DeepEqual(expected, request) {
+			t.Fatalf("unexpected request %+v", request)
+		}
+	})
+
+	t.Run("usage errors are rejected", func(t *testing.T) {
+		cases := map[string][]string{
+			"unknown option '--price', use --open, --close, --volume, --change or --all": {"aapl.us", "--price"},
+			"no stock code given, like /stock aapl.us":                                   {"--all"},
+			"up to 10 stocks can be quoted at once":                                      {"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"},
+		}
+
+		for message, args := range cases {
+			_, err := parseStockArgs(args)
+
+			if err == nil || err.Error() != message {
+				t.Fatalf("expected error %q, got %v", message, err)
+			}
+		}
+	})
+}
+
+func Test_stockHandler_getQuotes(t *testing.T) {
+	t.Run("symbols that fail keep their row and the others are still quoted", func(t *testing.T) {
+		handler := stockHandler{client: failingStooqClient{failures: map[string]bool{"msft.us": true}}}
+
+		quotes := handler.getQuotes([]string{"aapl.us", "msft.us"})
+
+		if len(quotes) != 2 {
+			t.Fatalf("unexpected quotes %+v", quotes)
+		}
+		if !quotes[0].Found || quotes[0].Err != nil {
+			t.Fatalf("unexpected quote %+v", quotes[0])
+		}
+		if quotes[1].Symbol != "MSFT.US" || quotes[1].Found || quotes[1].Err == nil {
+			t.Fatalf("unexpected quote %+v", quotes[1])
+		}
+	})
+}
@@ -1,61 +1,93 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"expvar"
+	"flag"
 	"fmt"
-	"github.com/sebastianreh/chatroom-bots/stocks/entities"
-	ctr "github.com/sebastianreh/chatroom-bots/stocks/internal/container"
-	"github.com/sebastianreh/chatroom-bots/stocks/pkg/csv"
+	"github.com/go-resty/resty/v2"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sebastianreh/chatroom-bots/sdk"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/cache"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/rest"
+	"strings"
+	"time"
 )
 
-const (
-	BotName     = "stock"
-	emptyString = ""
-)
+const BotName = "stock"
 
-func main() {
-	container := ctr.Build(BotName)
-	ProcessMessages(container)
+type StockConfig struct {
+	Cache struct {
+		Type string        `envconfig:"STOOQ_CACHE_TYPE" default:"memory"`
+		TTL  time.Duration `envconfig:"STOOQ_CACHE_TTL" default:"1m"`
+	}
 }
 
-func ProcessMessages(container ctr.Container) {
-	for {
-		message, err := container.Socket.ReadMessage()
-		if err != nil {
-			container.Logs.Error(fmt.Sprintf("error reading message: %s", err.Error()), "ProcessMessages")
-			continue
-		}
+func main() {
+	bot, err := sdk.New(BotName, sdk.WithRooms(getRoomIDs()...))
+	if err != nil {
+		panic(err)
+	}
 
-		if message.Value == emptyString {
-			continue
-		}
+	client, err := newCachedStooqClient(bot)
+	if err != nil {
+		panic(err)
+	}
 
-		stockCSV, err := container.Client.GetStockCSV(message.Value)
-		if err != nil {
-			continue
-		}
+	stocks := stockHandler{client: client}
+	bot.Handle(BotName, stocks.Handle,
+		sdk.WithVariadicArg("code", stockArgPattern),
+		sdk.WithHelp(stockHelp),
+	)
 
-		stockRecords, err := csv.ReadStockCsv(stockCSV)
-		if err != nil {
-			container.Logs.Error(fmt.Sprintf("error reading stock csv: %s", err.Error()), "ProcessMessages")
-			continue
-		}
+	if err = bot.Run(context.Background()); err != nil {
+		bot.Logger().Error(fmt.Sprintf("error stopping bot: %s", err.Error()), "main")
+	}
+}
 
-		stockMessage, err := entities.MapRecordsToStock(container.RoomID, stockRecords)
-		if err != nil {
-			container.Logs.Error(fmt.Sprintf("error mapping records for stock: %s", err.Error()), "ProcessMessages")
-			continue
-		}
+// newCachedStooqClient caches the quotes for STOOQ_CACHE_TTL, in the STOOQ_CACHE_TYPE cache, and publishes the
+// cache stats as the stooq_cache expvar.
+func newCachedStooqClient(bot *sdk.Bot) (rest.StooqClient, error) {
+	var stockConfig StockConfig
+	if err := envconfig.Process("", &stockConfig); err != nil {
+		return nil, err
+	}
 
-		stockMessageBytes, err := json.Marshal(stockMessage)
+	var quotes cache.Cache
+	switch stockConfig.Cache.Type {
+	case cache.MemoryType:
+		quotes = cache.NewMemoryCache()
+	case cache.RedisType:
+		redisCache, err := cache.NewRedisCache(bot.Config().Redis.Host, BotName+":quote:")
 		if err != nil {
-			container.Logs.Error(fmt.Sprintf("error marshaling message: %s", err.Error()), "ProcessMessages")
-			continue
+			return nil, err
 		}
+		quotes = redisCache
+	default:
+		return nil, fmt.Errorf("unknown cache type %q", stockConfig.Cache.Type)
+	}
 
-		err = container.Producer.Send(container.Config.Kafka.StocksTopic, stockMessageBytes)
-		if err != nil {
-			container.Logs.Error(fmt.Sprintf("error initializing kafka producer: %s", err.Error()), "ProcessMessages")
+	client := rest.NewCachedStooqClient(rest.NewStooqClient(bot.Logger(), resty.New()), quotes,
+		stockConfig.Cache.TTL, bot.Logger())
+	expvar.Publish("stooq_cache", expvar.Func(func() interface{} {
+		return client.Stats()
+	}))
+
+	return client, nil
+}
+
+// getRoomIDs reads the comma separated rooms of the -room_id flag, which is optional.
+func getRoomIDs() []string {
+	roomID := flag.String("room_id", "", "Comma separated room IDs, all the rooms enabling the bot when empty")
+
+	flag.Parse()
+
+	var roomIDs []string
+	for _, id := range strings.Split(*roomID, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			roomIDs = append(roomIDs, id)
 		}
 	}
+
+	return roomIDs
 }
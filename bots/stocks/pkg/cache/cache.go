@@ -0,0 +1,103 @@
+// Package cache keeps upstream responses for a while, in process or in Redis so the instances of a bot share
+// them.
+package cache
+
+import (
+	"context"
+	"fmt"
+	rd "github.com/go-redis/redis/v8"
+	"sync"
+	"time"
+)
+
+const (
+	MemoryType = "memory"
+	RedisType  = "redis"
+)
+
+// Cache stores values by key until their TTL elapses, Get returns false for missing or expired keys.
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+}
+
+type entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryCache struct {
+	mutex   sync.Mutex
+	entries map[string]entry
+}
+
+// NewMemoryCache keeps the values in process, expired entries are dropped when read or when new values are set.
+func NewMemoryCache() Cache {
+	return &memoryCache{
+		entries: make(map[string]entry),
+	}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if time.Now().After(cached.expiresAt) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+
+	return cached.value, true, nil
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	for cachedKey, cached := range c.entries {
+		if now.After(cached.expiresAt) {
+			delete(c.entries, cachedKey)
+		}
+	}
+
+	c.entries[key] = entry{value: value, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+type redisCache struct {
+	client *rd.Client
+	prefix string
+}
+
+// NewRedisCache stores the values in Redis under prefix, so every instance of the bot reads them.
+func NewRedisCache(host, prefix string) (Cache, error) {
+	client := rd.NewClient(&rd.Options{Addr: host})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("error connecting to redis: %w", err)
+	}
+
+	return &redisCache{
+		client: client,
+		prefix: prefix,
+	}, nil
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool, error) {
+	value, err := c.client.Get(context.Background(), c.prefix+key).Bytes()
+	if err == rd.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return value, true, nil
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(context.Background(), c.prefix+key, value, ttl).Err()
+}
@@ -0,0 +1,45 @@
+package cache
+
+import "sync"
+
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// Group coalesces the concurrent calls for the same key into one, the callers arriving while it runs share
+// its result.
+type Group struct {
+	mutex sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn unless a call for key is already running, in which case it waits for it. shared is true when the
+// result comes from another caller's call.
+func (g *Group) Do(key string, fn func() ([]byte, error)) (value []byte, shared bool, err error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	if running, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		<-running.done
+		return running.value, true, running.err
+	}
+
+	current := &call{done: make(chan struct{})}
+	g.calls[key] = current
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(current.done)
+	}()
+
+	current.value, current.err = fn()
+	return current.value, false, current.err
+}
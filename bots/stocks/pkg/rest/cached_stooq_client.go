@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/cache"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const cachedClientName = "cached_stooq_client"
+
+// CacheStats counts how the quotes were served: Hits from the cache, Misses from Stooq, Coalesced by sharing
+// the Stooq call of a concurrent request for the same symbol.
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Coalesced int64 `json:"coalesced"`
+}
+
+type cachedStooqClient struct {
+	client    StooqClient
+	cache     cache.Cache
+	ttl       time.Duration
+	calls     cache.Group
+	logger    logger.Logger
+	hits      int64
+	misses    int64
+	coalesced int64
+}
+
+// CachedStooqClient is a StooqClient keeping the quotes for a while, Stats reports its cache usage.
+type CachedStooqClient interface {
+	StooqClient
+	Stats() CacheStats
+}
+
+// NewCachedStooqClient keeps the quotes of client in quotes for ttl, keyed by symbol. Concurrent requests for a
+// symbol missing from the cache make a single call to client. Cache errors are logged and the quote is fetched.
+func NewCachedStooqClient(client StooqClient, quotes cache.Cache, ttl time.Duration, logger logger.Logger) CachedStooqClient {
+	return &cachedStooqClient{
+		client: client,
+		cache:  quotes,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+func (client *cachedStooqClient) GetStockCSV(stockName string) ([]byte, error) {
+	key := strings.ToLower(stockName)
+	cached, ok, err := client.cache.Get(key)
+	if err != nil {
+		client.logger.Error(fmt.Sprintf("error reading cached quote of %s: %s", key, err.Error()), cachedClientName)
+	}
+
+	if ok {
+		atomic.AddInt64(&client.hits, 1)
+		return cached, nil
+	}
+
+	stockCSV, shared, err := client.calls.Do(key, func() ([]byte, error) {
+		stockCSV, err := client.client.GetStockCSV(stockName)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = client.cache.Set(key, stockCSV, client.ttl); err != nil {
+			client.logger.Error(fmt.Sprintf("error caching quote of %s: %s", key, err.Error()), cachedClientName)
+		}
+
+		return stockCSV, nil
+	})
+	if shared {
+		atomic.AddInt64(&client.coalesced, 1)
+	} else {
+		atomic.AddInt64(&client.misses, 1)
+	}
+
+	return stockCSV, err
+}
+
+func (client *cachedStooqClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadInt64(&client.hits),
+		Misses:    atomic.LoadInt64(&client.misses),
+		Coalesced: atomic.LoadInt64(&client.coalesced),
+	}
+}
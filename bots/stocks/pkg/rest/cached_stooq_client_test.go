@@ -0,0 +1,95 @@
+package rest_test
+
+import (
+	"errors"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/cache"
+	"github.com/sebastianreh/chatroom-bots/stocks/pkg/rest"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeStooqClient counts the quotes requested, each request waits for release when it is set.
+type fakeStooqClient struct {
+	calls   int64
+	release chan struct{}
+	err     error
+}
+
+func (c *fakeStooqClient) GetStockCSV(stockName string) ([]byte, error) {
+	atomic.AddInt64(&c.calls, 1)
+	if c.release != nil {
+		<-c.release
+	}
+
+	return []byte("Symbol,Date\n" + stockName + ",2023-10-09\n"), c.err
+}
+
+func Test_CachedStooqClient_GetStockCSV(t *testing.T) {
+	logs := logger.NewLogger()
+
+	t.Run("quote is served from the cache until its ttl elapses", func(t *testing.T) {
+		upstream := &fakeStooqClient{}
+		client := rest.NewCachedStooqClient(upstream, cache.NewMemoryCache(), 50*time.Millisecond, logs)
+
+		for _, symbol := range []string{"aapl.us", "AAPL.US"} {
+			if _, err := client.GetStockCSV(symbol); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(60 * time.Millisecond)
+		if _, err := client.GetStockCSV("aapl.us"); err != nil {
+			t.Fatal(err)
+		}
+
+		if calls := atomic.LoadInt64(&upstream.calls); calls != 2 {
+			t.Fatalf("expected 2 upstream calls, got %d", calls)
+		}
+		if stats := client.Stats(); stats != (rest.CacheStats{Hits: 1, Misses: 2}) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("concurrent requests for a symbol make a single upstream call", func(t *testing.T) {
+		upstream := &fakeStooqClient{release: make(chan struct{})}
+		client := rest.NewCachedStooqClient(upstream, cache.NewMemoryCache(), time.Minute, logs)
+
+		var requests sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			requests.Add(1)
+			go func() {
+				defer requests.Done()
+				if _, err := client.GetStockCSV("msft.us"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(upstream.release)
+		requests.Wait()
+
+		if calls := atomic.LoadInt64(&upstream.calls); calls != 1 {
+			t.Fatalf("expected 1 upstream call, got %d", calls)
+		}
+		if stats := client.Stats(); stats != (rest.CacheStats{Misses: 1, Coalesced: 4}) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("upstream errors are not cached", func(t *testing.T) {
+		upstream := &fakeStooqClient{err: errors.New("stooq unavailable")}
+		client := rest.NewCachedStooqClient(upstream, cache.NewMemoryCache(), time.Minute, logs)
+
+		for i := 0; i < 2; i++ {
+			if _, err := client.GetStockCSV("aapl.us"); err == nil {
+				t.Fatal("expected the upstream error")
+			}
+		}
+
+		if calls := atomic.LoadInt64(&upstream.calls); calls != 2 {
+			t.Fatalf("expected 2 upstream calls, got %d", calls)
+		}
+	})
+}
@@ -3,7 +3,7 @@ package rest
 import (
 	"fmt"
 	"github.com/go-resty/resty/v2"
-	"github.com/sebastianreh/chatroom-bots/stocks/internal/config"
+	"github.com/sebastianreh/chatroom-bots/sdk/config"
 	"github.com/sebastianreh/chatroom/pkg/logger"
 	str "github.com/sebastianreh/chatroom/pkg/strings"
 )
@@ -84,19 +84,11 @@ function Chat() {
     const wsRef = useRef(null);
     const navigate = useNavigate();
 
-    useEffect(() => {
-        const connectionString = `ws://localhost:8000/chatroom/session/chat?room_id=${room.room_id}&user_id=${user.user_id}&username=${user.username}`
-        const ws = new WebSocket(connectionString);
-        wsRef.current = ws;
-
-        ws.onopen = () => {
-            console.log('WebSocket connection opened');
-        };
-
-        ws.onerror = (error) => {
-            console.log('WebSocket Error:', error);
-        }
+    const lastSeqRef = useRef(null);
+    const onMessageRef = useRef(() => {});
+    const exitingRef = useRef(false);
 
+    const loadHistory = () => {
         fetch(`http://localhost:8000/chatroom/session/messages/${room.room_id}`)
             .then(response => response.json())
             .then(data => {
@@ -113,9 +105,41 @@ function Chat() {
                     setMessages(transformedMessages);
                 }
             });
+    };
+
+    useEffect(() => {
+        const connect = () => {
+            let connectionString = `ws://localhost:8000/chatroom/session/chat?room_id=${room.room_id}&user_id=${user.user_id}&username=${user.username}`
+            if (lastSeqRef.current !== null) {
+                connectionString += `&last_seq=${lastSeqRef.current}`
+            }
+            const ws = new WebSocket(connectionString);
+            wsRef.current = ws;
+
+            ws.onopen = () => {
+                console.log('WebSocket connection opened');
+            };
+
+            ws.onerror = (error) => {
+                console.log('WebSocket Error:', error);
+            }
+
+            ws.onmessage = (event) => onMessageRef.current(event);
+
+            // Reconnect with the last sequence seen so the server replays what was missed
+            ws.onclose = () => {
+                if (!exitingRef.current) {
+                    setTimeout(connect, 1000);
+                }
+            };
+        };
+
+        connect();
+        loadHistory();
     }, []);
 
     const exitChat = () => {
+        exitingRef.current = true;
         const payload = {
             room_id: room.room_id,
             user_id: user.user_id,
@@ -143,45 +167,48 @@ function Chat() {
     };
 
     useEffect(() => {
-        wsRef.current.onmessage = (event) => {
-            const messageData = JSON.parse(event.data);
-            console.log((messageData))
-            if (isChatMessage(messageData)) {
-                handleChatMessage(messageData)
-            } else if (isActionMessage(messageData)) {
-                handleActionMessage(messageData)
-            } else if (isStockMessage(messageData)) {
-                console.log((messageData))
-                handleStockMessage(messageData)
+        onMessageRef.current = (event) => {
+            const envelope = JSON.parse(event.data);
+            console.log((envelope))
+            if (envelope.seq) {
+                if (lastSeqRef.current !== null && envelope.seq <= lastSeqRef.current) {
+                    return
+                }
+                lastSeqRef.current = envelope.seq
+            }
+            switch (envelope.type) {
+                case 'chat_message':
+                    handleChatMessage({id: envelope.id, ...envelope.payload})
+                    break
+                case 'session_action':
+                    handleActionMessage(envelope.payload)
+                    break
+                case 'bot_message':
+                    handleStockMessage({id: envelope.id, ...envelope.payload})
+                    break
+                case 'resync':
+                    lastSeqRef.current = envelope.payload.last_seq
+                    loadHistory()
+                    break
+                case 'command_help':
+                    handleSystemMessage(envelope.id, envelope.payload.commands
+                        .map(command => `${command.usage}: ${command.help}`).join('\n'))
+                    break
+                case 'error':
+                    if (['unknown_command', 'invalid_command', 'bot_timeout', 'delivery_failed'].includes(envelope.payload.code)) {
+                        handleSystemMessage(envelope.id, envelope.payload.message)
+                        break
+                    }
+                    console.error('Server rejected frame:', envelope.payload)
+                    break
+                default:
             }
-        };
-
-        const isChatMessage = (data) => {
-            return data &&
-                data.hasOwnProperty('user_id') &&
-                data.hasOwnProperty('username') &&
-                data.hasOwnProperty('content') &&
-                data.hasOwnProperty('created_at')
-        };
-
-        const isActionMessage = (data) => {
-            return data &&
-                data.hasOwnProperty('type') &&
-                data.hasOwnProperty('username') &&
-                data.hasOwnProperty('user_id')
-        };
-
-        const isStockMessage = (data) => {
-            return data &&
-                data.hasOwnProperty('room_id') &&
-                data.hasOwnProperty('bot_message') &&
-                data.hasOwnProperty('created_at')
         };
 
         const handleChatMessage = (messageData) => {
             const formattedMessage = {
                 id: messageData.id || new Date().getTime(),
-                type: messageData.type || "message",
+                type: "message",
                 username: messageData.username,
                 text: messageData.content,
                 timestamp: messageData.created_at
@@ -206,6 +233,23 @@ function Chat() {
             }
         }
 
+        const handleSystemMessage = (id, text) => {
+            const formattedMessage = {
+                id: id || new Date().getTime(),
+                type: "message",
+                username: 'chatroom',
+                text: text,
+                timestamp: new Date().toISOString()
+            };
+            setMessages((prevMessages) => {
+                const newMessages = [...prevMessages, formattedMessage];
+                while (newMessages.length > 50) {
+                    newMessages.shift(); // Remove the oldest message
+                }
+                return newMessages;
+            });
+        }
+
         const handleStockMessage = (messageData) => {
             const formattedMessage = {
                 id: messageData.id || new Date().getTime(),
@@ -226,6 +270,7 @@ function Chat() {
 
     useEffect(() => {
         const handleUnload = () => {
+            exitingRef.current = true;
             if (wsRef.current) {
                 wsRef.current.close();
             }
@@ -241,10 +286,16 @@ function Chat() {
     const handleSend = (message, username, user_id, created_at) => {
         if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
             wsRef.current.send(JSON.stringify({
-                username: username,
-                user_id: user_id,
-                created_at: created_at,
-                content: message
+                type: 'chat_message',
+                version: 1,
+                room_id: room.room_id,
+                timestamp: created_at,
+                payload: {
+                    username: username,
+                    user_id: user_id,
+                    created_at: created_at,
+                    content: message
+                }
             }));
         }
     };
@@ -1,10 +1,14 @@
 package httpserver
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/sebastianreh/chatroom/cmd/httpserver/resterror"
+	"github.com/sebastianreh/chatroom/internal/app/user"
+	"github.com/sebastianreh/chatroom/internal/entities"
 	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
 	"net/http"
 	"strings"
 
@@ -13,6 +17,8 @@ import (
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
 )
 
+const AdminKeyHeader = "X-Admin-Key"
+
 type Middleware func(*Server)
 
 func (s *Server) Middlewares(middlewares ...Middleware) {
@@ -49,6 +55,44 @@ func WithCORS() Middleware {
 	}
 }
 
+// AdminKeyAuth guards the admin routes with the ADMIN_API_KEY sent in the X-Admin-Key header. Without a
+// configured key every admin request is rejected.
+func AdminKeyAuth(cfg config.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			if str.IsEmpty(cfg.AdminAPIKey) {
+				return resterror.NewUnauthorizedError("admin api key not configured")
+			}
+
+			key := ctx.Request().Header.Get(AdminKeyHeader)
+			if subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) != 1 {
+				return resterror.NewUnauthorizedError("invalid admin api key")
+			}
+
+			ctx.Set(entities.AdminContextKey, true)
+			return next(ctx)
+		}
+	}
+}
+
+// UserAuth authenticates the user with the username and password sent as HTTP basic auth, the same credentials
+// checked by the login, and keeps their ID in the request context under entities.UserContextKey.
+func UserAuth(users user.UserService) echo.MiddlewareFunc {
+	return echoMiddleware.BasicAuth(func(username, password string, ctx echo.Context) (bool, error) {
+		response, err := users.Login(ctx.Request().Context(), entities.User{Username: username, Password: password})
+		if err != nil {
+			switch err.(type) {
+			case exceptions.NotFoundException, exceptions.UnauthorizedException:
+				return false, nil
+			}
+			return false, err
+		}
+
+		ctx.Set(entities.UserContextKey, response.ID)
+		return true, nil
+	})
+}
+
 func HTTPErrorHandler(err error, ctx echo.Context) {
 	var apiError resterror.RestErr
 	switch value := err.(type) {
@@ -0,0 +1,145 @@
+package httpserver_test
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/sebastianreh/chatroom/cmd/httpserver"
+	"github.com/sebastianreh/chatroom/internal/app/user"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/container"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveAdmin(cfg config.Config, key string) (*httptest.ResponseRecorder, bool) {
+	server := httpserver.NewServer(container.Dependencies{})
+	server.Server.HTTPErrorHandler = httpserver.HTTPErrorHandler
+
+	var admin bool
+	server.Server.GET("/admin", func(ctx echo.Context) error {
+		admin, _ = ctx.Get(entities.AdminContextKey).(bool)
+		return ctx.NoContent(http.StatusOK)
+	}, httpserver.AdminKeyAuth(cfg))
+
+	request := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	if key != "" {
+		request.Header.Set(httpserver.AdminKeyHeader, key)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Server.ServeHTTP(recorder, request)
+
+	return recorder, admin
+}
+
+func Test_Middleware_AdminKeyAuth(t *testing.T) {
+	t.Run("request with the configured key is let through as admin", func(t *testing.T) {
+		cfg := config.Config{AdminAPIKey: "secret"}
+
+		recorder, admin := serveAdmin(cfg, "secret")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.True(t, admin)
+	})
+
+	t.Run("request with a wrong key is rejected", func(t *testing.T) {
+		cfg := config.Config{AdminAPIKey: "secret"}
+
+		recorder, admin := serveAdmin(cfg, "other")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.False(t, admin)
+	})
+
+	t.Run("request is rejected when no key is configured", func(t *testing.T) {
+		cfg := config.Config{}
+
+		recorder, admin := serveAdmin(cfg, "")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.False(t, admin)
+	})
+
+	t.Run("any key is rejected when no key is configured", func(t *testing.T) {
+		cfg := config.Config{}
+
+		recorder, admin := serveAdmin(cfg, "secret")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.False(t, admin)
+	})
+}
+
+func serveUser(users user.UserService, username, password string) (*httptest.ResponseRecorder, string) {
+	server := httpserver.NewServer(container.Dependencies{})
+	server.Server.HTTPErrorHandler = httpserver.HTTPErrorHandler
+
+	var userID string
+	server.Server.PUT("/room", func(ctx echo.Context) error {
+		userID, _ = ctx.Get(entities.UserContextKey).(string)
+		return ctx.NoContent(http.StatusOK)
+	}, httpserver.UserAuth(users))
+
+	request := httptest.NewRequest(http.MethodPut, "/room", nil)
+	if username != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Server.ServeHTTP(recorder, request)
+
+	return recorder, userID
+}
+
+func Test_Middleware_UserAuth(t *testing.T) {
+	credentials := entities.User{Username: "User1", Password: "password"}
+
+	t.Run("user with valid credentials is let through with their id", func(t *testing.T) {
+		usersMock := mocks.NewUserServiceMock()
+		usersMock.On("Login", mock.Anything, credentials).Return(entities.UserLoginResponse{ID: "id123"}, nil)
+
+		recorder, userID := serveUser(usersMock, "User1", "password")
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "id123", userID)
+	})
+
+	t.Run("user with wrong credentials is rejected", func(t *testing.T) {
+		usersMock := mocks.NewUserServiceMock()
+		usersMock.On("Login", mock.Anything, credentials).Return(entities.UserLoginResponse{},
+			exceptions.NewUnauthorizedException("user User1 credentials don't match"))
+
+		recorder, userID := serveUser(usersMock, "User1", "password")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Empty(t, userID)
+	})
+
+	t.Run("request without credentials is rejected", func(t *testing.T) {
+		usersMock := mocks.NewUserServiceMock()
+
+		recorder, userID := serveUser(usersMock, "", "")
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Empty(t, userID)
+		usersMock.AssertNotCalled(t, "Login", mock.Anything, mock.Anything)
+	})
+
+	t.Run("login failure is an internal error", func(t *testing.T) {
+		usersMock := mocks.NewUserServiceMock()
+		usersMock.On("Login", mock.Anything, credentials).Return(entities.UserLoginResponse{},
+			errors.New("mongo unavailable"))
+
+		recorder, userID := serveUser(usersMock, "User1", "password")
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Empty(t, userID)
+	})
+}
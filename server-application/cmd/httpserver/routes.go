@@ -4,6 +4,7 @@ package httpserver
 func (s *Server) Routes() {
 	root := s.Server.Group(s.dependencies.Config.Prefix)
 	root.GET("/ping", s.dependencies.PingHandler.Ping)
+	root.GET("/health", s.dependencies.PingHandler.Health)
 
 	userGroup := root.Group("/user")
 	userGroup.POST("", s.dependencies.UserHandler.Create)
@@ -15,11 +16,30 @@ func (s *Server) Routes() {
 	roomGroup.POST("", s.dependencies.RoomHandler.Create)
 	roomGroup.GET("", s.dependencies.RoomHandler.Get)
 	roomGroup.DELETE("/:id", s.dependencies.RoomHandler.Delete)
+	roomGroup.PUT("/:id/bots/:bot_name", s.dependencies.BotHandler.EnableInRoom, UserAuth(s.dependencies.UserService))
+	roomGroup.DELETE("/:id/bots/:bot_name", s.dependencies.BotHandler.DisableInRoom, UserAuth(s.dependencies.UserService))
 
 	sessionGroup := root.Group("/session")
 	sessionGroup.POST("/join", s.dependencies.SessionHandler.Join)
 	sessionGroup.POST("/exit", s.dependencies.SessionHandler.Exit)
 	sessionGroup.GET("/messages/:room_id", s.dependencies.SessionHandler.GetMessages)
+	sessionGroup.POST("/messages/:room_id", s.dependencies.SessionHandler.SendMessage)
+	sessionGroup.GET("/stream/:room_id", s.dependencies.SessionHandler.Stream)
+	sessionGroup.GET("/poll/:room_id", s.dependencies.SessionHandler.Poll)
 	sessionGroup.GET("/chat", s.dependencies.SessionHandler.HandleChatConnection)
+	sessionGroup.GET("/connect", s.dependencies.SessionHandler.HandleConnection)
 	sessionGroup.GET("/bot", s.dependencies.SessionHandler.HandleBotConnection)
+	sessionGroup.GET("/bot/rooms", s.dependencies.BotHandler.Rooms)
+	sessionGroup.PUT("/bot/commands", s.dependencies.BotHandler.RegisterCommands)
+
+	adminGroup := root.Group("/admin", AdminKeyAuth(s.dependencies.Config))
+	adminGroup.GET("/dead-letters", s.dependencies.DeadLetterHandler.Get)
+	adminGroup.POST("/dead-letters/:id/replay", s.dependencies.DeadLetterHandler.Replay)
+	adminGroup.POST("/bots", s.dependencies.BotHandler.Create)
+	adminGroup.GET("/bots", s.dependencies.BotHandler.Get)
+	adminGroup.PUT("/bots/:id", s.dependencies.BotHandler.Update)
+	adminGroup.DELETE("/bots/:id", s.dependencies.BotHandler.Delete)
+	adminGroup.POST("/bots/:id/api-key", s.dependencies.BotHandler.RotateKey)
+	adminGroup.PUT("/rooms/:id/bots/:bot_name", s.dependencies.BotHandler.EnableInRoom)
+	adminGroup.DELETE("/rooms/:id/bots/:bot_name", s.dependencies.BotHandler.DisableInRoom)
 }
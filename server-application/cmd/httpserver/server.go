@@ -1,6 +1,8 @@
 package httpserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"github.com/sebastianreh/chatroom/internal/container"
@@ -20,7 +22,15 @@ func NewServer(dependencies container.Dependencies) *Server {
 }
 
 func (s *Server) Start() {
-	s.Server.Logger.Fatal(s.Server.Start(fmt.Sprintf(":%s", s.dependencies.Config.Port)))
+	err := s.Server.Start(fmt.Sprintf(":%s", s.dependencies.Config.Port))
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.Server.Logger.Fatal(err)
+	}
+}
+
+// Shutdown stops accepting connections and waits for the in-flight requests until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.Server.Shutdown(ctx)
 }
 
 func (s *Server) SetErrorHandler(errorHandler echo.HTTPErrorHandler) {
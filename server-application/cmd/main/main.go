@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/sebastianreh/chatroom/cmd/httpserver"
 	"github.com/sebastianreh/chatroom/internal/container"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -15,9 +20,43 @@ func main() {
 	server.Routes()
 	server.SetErrorHandler(httpserver.HTTPErrorHandler)
 	runConsumers(dependencies)
-	server.Start()
+	go server.Start()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	shutdown(server, dependencies)
 }
 
 func runConsumers(dependencies container.Dependencies) {
 	go dependencies.SessionHandler.Listen()
 }
+
+// shutdown drains the server within the configured deadline: sockets are told the server is going away, HTTP
+// stops accepting connections, the in-flight broker message is finished and committed, and the clients are closed.
+func shutdown(server *httpserver.Server, dependencies container.Dependencies) {
+	logs := dependencies.Logs
+	ctx, cancel := context.WithTimeout(context.Background(), dependencies.Config.ShutdownTimeout)
+	defer cancel()
+
+	logs.Info("shutting down server", "main.shutdown")
+	if err := dependencies.Websocket.Shutdown(ctx); err != nil {
+		logs.Error(fmt.Sprintf("closing websocket: %s", err.Error()), "main.shutdown")
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logs.Error(fmt.Sprintf("closing http: %s", err.Error()), "main.shutdown")
+	}
+	if err := dependencies.Subscriber.Close(ctx); err != nil {
+		logs.Error(fmt.Sprintf("closing subscriber: %s", err.Error()), "main.shutdown")
+	}
+	if err := dependencies.Publisher.Close(ctx); err != nil {
+		logs.Error(fmt.Sprintf("closing publisher: %s", err.Error()), "main.shutdown")
+	}
+	if err := dependencies.MongoDB.Close(ctx); err != nil {
+		logs.Error(fmt.Sprintf("closing mongodb: %s", err.Error()), "main.shutdown")
+	}
+	if err := dependencies.Redis.Close(); err != nil {
+		logs.Error(fmt.Sprintf("closing redis: %s", err.Error()), "main.shutdown")
+	}
+	logs.Info("server stopped", "main.shutdown")
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/sebastianreh/chatroom/cmd/httpserver/resterror"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"net/http"
+)
+
+const handlerName = "bot.handler"
+
+type BotHandler interface {
+	Create(c echo.Context) error
+	Get(c echo.Context) error
+	Update(c echo.Context) error
+	Delete(c echo.Context) error
+	RotateKey(c echo.Context) error
+	Rooms(c echo.Context) error
+	RegisterCommands(c echo.Context) error
+	EnableInRoom(c echo.Context) error
+	DisableInRoom(c echo.Context) error
+}
+
+type botHandler struct {
+	config  config.Config
+	service BotService
+	logs    logger.Logger
+}
+
+func NewBotHandler(cfg config.Config, service BotService, logger logger.Logger) BotHandler {
+	return &botHandler{
+		config:  cfg,
+		service: service,
+		logs:    logger,
+	}
+}
+
+func (handler *botHandler) Create(ctx echo.Context) error {
+	request := new(entities.Bot)
+	if err := ctx.Bind(request); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Create"))
+		ctx.Error(err)
+		return nil
+	}
+
+	if err := validateBot(*request); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Create"))
+		ctx.Error(err)
+		return nil
+	}
+
+	response, err := handler.service.Create(ctx.Request().Context(), *request)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.JSON(http.StatusCreated, response)
+}
+
+func (handler *botHandler) Get(ctx echo.Context) error {
+	search := new(entities.BotSearch)
+	if err := ctx.Bind(search); err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Get"))
+		ctx.Error(err)
+		return nil
+	}
+
+	bots, err := handler.service.Get(ctx.Request().Context(), *search)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.JSON(http.StatusOK, bots)
+}
+
+func (handler *botHandler) Update(ctx echo.Context) error {
+	botID := ctx.Param("id")
+	request := new(entities.Bot)
+	if err := ctx.Bind(request); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Update"))
+		ctx.Error(err)
+		return nil
+	}
+
+	if err := request.ValidateScopes(); err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Update"))
+		ctx.Error(err)
+		return nil
+	}
+
+	err := handler.service.Update(ctx.Request().Context(), botID, *request)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (handler *botHandler) Delete(ctx echo.Context) error {
+	botID := ctx.Param("id")
+	if str.IsEmpty(botID) {
+		err := errors.New("error: empty id")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Delete"))
+		ctx.Error(err)
+		return nil
+	}
+
+	err := handler.service.Delete(ctx.Request().Context(), botID)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func (handler *botHandler) RotateKey(ctx echo.Context) error {
+	botID := ctx.Param("id")
+	if str.IsEmpty(botID) {
+		err := errors.New("error: empty id")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "RotateKey"))
+		ctx.Error(err)
+		return nil
+	}
+
+	response, err := handler.service.RotateKey(ctx.Request().Context(), botID)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// Rooms answers a bot, authenticated by its API key, with the rooms it is enabled in.
+func (handler *botHandler) Rooms(ctx echo.Context) error {
+	botName := ctx.QueryParam("bot_name")
+	if str.IsEmpty(botName) {
+		err := resterror.NewBadRequestError("bot_name is required")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Rooms"))
+		ctx.Error(err)
+		return nil
+	}
+
+	apiKey := entities.BearerToken(ctx.Request().Header.Get(echo.HeaderAuthorization))
+	response, err := handler.service.Rooms(ctx.Request().Context(), botName, apiKey)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// RegisterCommands stores the commands a bot, authenticated by its API key, gets through the broker.
+func (handler *botHandler) RegisterCommands(ctx echo.Context) error {
+	botName := ctx.QueryParam("bot_name")
+	if str.IsEmpty(botName) {
+		err := resterror.NewBadRequestError("bot_name is required")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "RegisterCommands"))
+		ctx.Error(err)
+		return nil
+	}
+
+	registration := new(entities.CommandRegistration)
+	if err := ctx.Bind(registration); err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "RegisterCommands"))
+		ctx.Error(err)
+		return nil
+	}
+
+	for _, definition := range registration.Commands {
+		if err := definition.Validate(); err != nil {
+			err = resterror.NewBadRequestError(err.Error())
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "RegisterCommands"))
+			ctx.Error(err)
+			return nil
+		}
+	}
+
+	apiKey := entities.BearerToken(ctx.Request().Header.Get(echo.HeaderAuthorization))
+	err := handler.service.RegisterCommands(ctx.Request().Context(), botName, apiKey, registration.Commands)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// EnableInRoom lets the bot join the room. Outside the admin routes the authenticated user must be the room owner.
+func (handler *botHandler) EnableInRoom(ctx echo.Context) error {
+	return handler.setRoomBot(ctx, true, "EnableInRoom")
+}
+
+func (handler *botHandler) DisableInRoom(ctx echo.Context) error {
+	return handler.setRoomBot(ctx, false, "DisableInRoom")
+}
+
+func (handler *botHandler) setRoomBot(ctx echo.Context, enabled bool, origin string) error {
+	request := new(entities.RoomBotRequest)
+	err := (&echo.DefaultBinder{}).BindPathParams(ctx, request)
+	if err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, origin))
+		ctx.Error(err)
+		return nil
+	}
+	request.UserID, _ = ctx.Get(entities.UserContextKey).(string)
+	request.Admin, _ = ctx.Get(entities.AdminContextKey).(bool)
+
+	err = handler.service.SetRoomBot(ctx.Request().Context(), *request, enabled)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+func validateBot(bot entities.Bot) error {
+	if str.IsEmpty(bot.Name) {
+		return resterror.NewBadRequestError("bot name is required")
+	}
+
+	if err := bot.ValidateScopes(); err != nil {
+		return resterror.NewBadRequestError(err.Error())
+	}
+
+	return nil
+}
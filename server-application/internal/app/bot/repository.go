@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/mongodb"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	repositoryName = "bot.repository"
+)
+
+type BotRepository interface {
+	Create(ctx context.Context, bot entities.Bot, hashedAPIKey string) (string, error)
+	Get(ctx context.Context, search entities.BotSearch) ([]entities.Bot, error)
+	Update(ctx context.Context, botID string, bot entities.Bot) error
+}
+
+type botRepository struct {
+	config         config.Config
+	mongodb        mongodb.MongoDBier
+	logs           logger.Logger
+	collectionName string
+}
+
+func NewBotRepository(cfg config.Config, mongoDBier mongodb.MongoDBier, logger logger.Logger) BotRepository {
+	return &botRepository{
+		config:         cfg,
+		mongodb:        mongoDBier,
+		logs:           logger,
+		collectionName: cfg.MongoDB.Collections.Bots,
+	}
+}
+
+func (repository *botRepository) Create(ctx context.Context, bot entities.Bot, hashedAPIKey string) (string, error) {
+	botDTO := entities.CreateBotDTOFromEntity(bot, hashedAPIKey)
+	_, err := repository.mongodb.Collection(repository.collectionName).InsertOne(ctx, botDTO)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Create"))
+		return str.Empty, err
+	}
+
+	return botDTO.ID.Hex(), nil
+}
+
+func (repository *botRepository) Get(ctx context.Context, search entities.BotSearch) ([]entities.Bot, error) {
+	bots := make([]entities.Bot, 0)
+	collection := repository.mongodb.Collection(repository.collectionName)
+	cursor, err := collection.Find(ctx, createFilter(search))
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Get"))
+		return bots, err
+	}
+
+	defer func() {
+		errClose := cursor.Close(ctx)
+		if errClose != nil {
+			repository.logs.Error(str.ErrorConcat(errClose, repositoryName, "Get"))
+		}
+	}()
+
+	for cursor.Next(ctx) {
+		botDTO := new(entities.BotDTO)
+		err = cursor.Decode(botDTO)
+		if err != nil {
+			repository.logs.Error(str.ErrorConcat(err, repositoryName, "Get"))
+			return bots, err
+		}
+
+		bots = append(bots, entities.CreateBotEntityFromBotDTO(*botDTO))
+	}
+
+	return bots, nil
+}
+
+// Update sets the owner, scopes, key hash and state of the bot, its name never changes since rooms refer to
+// bots by name.
+func (repository *botRepository) Update(ctx context.Context, botID string, bot entities.Bot) error {
+	foundID, err := primitive.ObjectIDFromHex(botID)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Update"))
+		return err
+	}
+
+	collection := repository.mongodb.Collection(repository.collectionName)
+	filter := bson.M{entities.BotIDField: foundID}
+
+	update := bson.D{
+		{Key: "$set",
+			Value: bson.D{
+				primitive.E{Key: entities.BotOwnerIDField, Value: bot.OwnerID},
+				primitive.E{Key: entities.BotScopesField, Value: bot.Scopes},
+				primitive.E{Key: entities.BotCommandsField, Value: bot.Commands},
+				primitive.E{Key: entities.BotAPIKeyField, Value: bot.APIKey},
+				primitive.E{Key: entities.BotIsActiveField, Value: bot.IsActive},
+			},
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Update"))
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		err = exceptions.NewNotFoundException(fmt.Sprintf("bot with id:%s not found", botID))
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Update"))
+		return err
+	}
+
+	return nil
+}
+
+func createFilter(search entities.BotSearch) bson.D {
+	filter := bson.D{}
+	if !str.IsEmpty(search.ID) {
+		id, _ := primitive.ObjectIDFromHex(search.ID)
+		filter = append(filter, bson.E{Key: entities.BotIDField, Value: id})
+	}
+
+	if !str.IsEmpty(search.Name) {
+		filter = append(filter, bson.E{Key: entities.BotNameField, Value: search.Name})
+	}
+
+	if !str.IsEmpty(search.OwnerID) {
+		filter = append(filter, bson.E{Key: entities.BotOwnerIDField, Value: search.OwnerID})
+	}
+
+	if search.IsActive != nil {
+		filter = append(filter, bson.E{Key: entities.BotIsActiveField, Value: *search.IsActive})
+	}
+
+	return filter
+}
@@ -0,0 +1,345 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/app/room"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/broker"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+)
+
+const (
+	serviceName         = "bot.service"
+	correlationIDHeader = "correlation_id"
+)
+
+type BotService interface {
+	Create(ctx context.Context, bot entities.Bot) (entities.BotCreateResponse, error)
+	Get(ctx context.Context, search entities.BotSearch) (entities.BotsGetResponse, error)
+	Update(ctx context.Context, botID string, bot entities.Bot) error
+	Delete(ctx context.Context, botID string) error
+	RotateKey(ctx context.Context, botID string) (entities.BotKeyResponse, error)
+	Authenticate(ctx context.Context, botName, apiKey, roomID string) (entities.Bot, error)
+	Rooms(ctx context.Context, botName, apiKey string) (entities.BotRoomsResponse, error)
+	RegisterCommands(ctx context.Context, botName, apiKey string, commands []entities.CommandDefinition) error
+	RoomCommands(ctx context.Context, roomID string) ([]entities.RoomCommand, error)
+	SendCommand(ctx context.Context, request entities.CommandRequest) error
+	SetRoomBot(ctx context.Context, request entities.RoomBotRequest, enabled bool) error
+}
+
+type botService struct {
+	config     config.Config
+	repository BotRepository
+	rooms      room.RoomRepository
+	publisher  broker.Publisher
+	logs       logger.Logger
+}
+
+func NewBotService(cfg config.Config, repository BotRepository, rooms room.RoomRepository, publisher broker.Publisher,
+	logger logger.Logger) BotService {
+	return &botService{
+		config:     cfg,
+		repository: repository,
+		rooms:      rooms,
+		publisher:  publisher,
+		logs:       logger,
+	}
+}
+
+// Create registers the bot and returns its API key, only its hash is stored so it can't be retrieved later.
+func (service *botService) Create(ctx context.Context, bot entities.Bot) (entities.BotCreateResponse, error) {
+	var botCreateResponse entities.BotCreateResponse
+	bots, err := service.repository.Get(ctx, entities.BotSearch{Name: bot.Name})
+	if err != nil {
+		return botCreateResponse, err
+	}
+
+	if len(bots) > 0 {
+		err = exceptions.NewDuplicatedException(fmt.Sprintf("bot '%s' already exist", bot.Name))
+		service.logs.Error(str.ErrorConcat(err, serviceName, "Create"))
+		return botCreateResponse, err
+	}
+
+	apiKey, hashedAPIKey, err := service.generateKey()
+	if err != nil {
+		return botCreateResponse, err
+	}
+
+	botID, err := service.repository.Create(ctx, bot, hashedAPIKey)
+	if err != nil {
+		return botCreateResponse, err
+	}
+
+	botCreateResponse.ID = botID
+	botCreateResponse.APIKey = apiKey
+
+	return botCreateResponse, nil
+}
+
+func (service *botService) Get(ctx context.Context, search entities.BotSearch) (entities.BotsGetResponse, error) {
+	bots, err := service.repository.Get(ctx, search)
+	if err != nil {
+		return entities.BotsGetResponse{}, err
+	}
+
+	return entities.BotsGetResponse{Bots: bots}, nil
+}
+
+func (service *botService) Update(ctx context.Context, botID string, bot entities.Bot) error {
+	botFound, err := service.findBot(ctx, entities.BotSearch{ID: botID}, "Update")
+	if err != nil {
+		return err
+	}
+
+	botFound.OwnerID = bot.OwnerID
+	botFound.Scopes = bot.Scopes
+	botFound.IsActive = bot.IsActive
+
+	return service.repository.Update(ctx, botID, botFound)
+}
+
+// Delete deactivates the bot, it can't connect anymore but stays listed in the rooms enabling it.
+func (service *botService) Delete(ctx context.Context, botID string) error {
+	botFound, err := service.findBot(ctx, entities.BotSearch{ID: botID}, "Delete")
+	if err != nil {
+		return err
+	}
+
+	botFound.IsActive = false
+
+	return service.repository.Update(ctx, botID, botFound)
+}
+
+// RotateKey replaces the bot API key, the previous one stops working right away.
+func (service *botService) RotateKey(ctx context.Context, botID string) (entities.BotKeyResponse, error) {
+	var botKeyResponse entities.BotKeyResponse
+	botFound, err := service.findBot(ctx, entities.BotSearch{ID: botID}, "RotateKey")
+	if err != nil {
+		return botKeyResponse, err
+	}
+
+	apiKey, hashedAPIKey, err := service.generateKey()
+	if err != nil {
+		return botKeyResponse, err
+	}
+
+	botFound.APIKey = hashedAPIKey
+	err = service.repository.Update(ctx, botID, botFound)
+	if err != nil {
+		return botKeyResponse, err
+	}
+
+	botKeyResponse.APIKey = apiKey
+
+	return botKeyResponse, nil
+}
+
+// Authenticate checks the API key of an active bot and that the room enables it.
+func (service *botService) Authenticate(ctx context.Context, botName, apiKey, roomID string) (entities.Bot, error) {
+	botFound, err := service.verifyKey(ctx, botName, apiKey, "Authenticate")
+	if err != nil {
+		return entities.Bot{}, err
+	}
+
+	rooms, err := service.rooms.Get(ctx, entities.RoomSearch{ID: roomID})
+	if err != nil {
+		return entities.Bot{}, err
+	}
+
+	if len(rooms) == 0 || !rooms[0].HasBot(botName) {
+		err = exceptions.NewUnauthorizedException(fmt.Sprintf("bot '%s' is not enabled in room %s", botName, roomID))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, "Authenticate"))
+		return entities.Bot{}, err
+	}
+
+	return botFound, nil
+}
+
+// Rooms lists the active rooms enabling the bot, which uses them to know the rooms to join.
+func (service *botService) Rooms(ctx context.Context, botName, apiKey string) (entities.BotRoomsResponse, error) {
+	botRoomsResponse := entities.BotRoomsResponse{Rooms: []string{}}
+	if _, err := service.verifyKey(ctx, botName, apiKey, "Rooms"); err != nil {
+		return botRoomsResponse, err
+	}
+
+	active := true
+	rooms, err := service.rooms.Get(ctx, entities.RoomSearch{Bot: botName, IsActive: &active})
+	if err != nil {
+		return botRoomsResponse, err
+	}
+
+	for _, roomFound := range rooms {
+		botRoomsResponse.Rooms = append(botRoomsResponse.Rooms, roomFound.ID)
+	}
+
+	return botRoomsResponse, nil
+}
+
+// RegisterCommands replaces the commands the bot gets through the broker, the bot needs the commands scope.
+func (service *botService) RegisterCommands(ctx context.Context, botName, apiKey string, commands []entities.CommandDefinition) error {
+	botFound, err := service.verifyKey(ctx, botName, apiKey, "RegisterCommands")
+	if err != nil {
+		return err
+	}
+
+	if !botFound.HasScope(entities.CommandsScope) {
+		err = exceptions.NewUnauthorizedException(fmt.Sprintf("bot '%s' is missing the '%s' scope", botName,
+			entities.CommandsScope))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, "RegisterCommands"))
+		return err
+	}
+
+	botFound.Commands = commands
+
+	return service.repository.Update(ctx, botFound.ID, botFound)
+}
+
+// RoomCommands lists the commands registered by the active bots enabled in the room. A command registered by
+// several bots belongs to the one enabled first.
+func (service *botService) RoomCommands(ctx context.Context, roomID string) ([]entities.RoomCommand, error) {
+	rooms, err := service.rooms.Get(ctx, entities.RoomSearch{ID: roomID})
+	if err != nil || len(rooms) == 0 {
+		return nil, err
+	}
+
+	active := true
+	var commands []entities.RoomCommand
+	registered := make(map[string]bool)
+	for _, botName := range rooms[0].Bots {
+		bots, err := service.repository.Get(ctx, entities.BotSearch{Name: botName, IsActive: &active})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bots) == 0 || !bots[0].HasScope(entities.CommandsScope) {
+			continue
+		}
+
+		for _, definition := range bots[0].Commands {
+			if registered[definition.Name] {
+				continue
+			}
+			registered[definition.Name] = true
+			commands = append(commands, entities.RoomCommand{Definition: definition, BotName: botName})
+		}
+	}
+
+	return commands, nil
+}
+
+// SendCommand publishes the command on the commands topic of its bot.
+func (service *botService) SendCommand(ctx context.Context, request entities.CommandRequest) error {
+	value, err := json.Marshal(request)
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "SendCommand"))
+		return err
+	}
+
+	topic := entities.CommandsTopic(service.config.Kafka.CommandsTopic, request.Bot)
+	err = service.publisher.Publish(ctx, topic, value, map[string]string{correlationIDHeader: request.CorrelationID})
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "SendCommand"))
+		return err
+	}
+
+	return nil
+}
+
+// SetRoomBot enables or disables the bot in the room, on behalf of the room owner or an admin.
+func (service *botService) SetRoomBot(ctx context.Context, request entities.RoomBotRequest, enabled bool) error {
+	rooms, err := service.rooms.Get(ctx, entities.RoomSearch{ID: request.RoomID})
+	if err != nil {
+		return err
+	}
+
+	if len(rooms) == 0 {
+		err = exceptions.NewNotFoundException(fmt.Sprintf("no room was found with id: %s", request.RoomID))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, "SetRoomBot"))
+		return err
+	}
+
+	roomFound := rooms[0]
+	if !request.Admin && (str.IsEmpty(roomFound.OwnerID) || roomFound.OwnerID != request.UserID) {
+		err = exceptions.NewUnauthorizedException(fmt.Sprintf("only the owner of room %s can manage its bots", request.RoomID))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, "SetRoomBot"))
+		return err
+	}
+
+	if enabled {
+		if roomFound.HasBot(request.BotName) {
+			return nil
+		}
+
+		if _, err = service.findBot(ctx, entities.BotSearch{Name: request.BotName}, "SetRoomBot"); err != nil {
+			return err
+		}
+		roomFound.Bots = append(roomFound.Bots, request.BotName)
+	} else {
+		bots := make([]string, 0, len(roomFound.Bots))
+		for _, name := range roomFound.Bots {
+			if name != request.BotName {
+				bots = append(bots, name)
+			}
+		}
+		roomFound.Bots = bots
+	}
+
+	return service.rooms.Update(ctx, request.RoomID, roomFound)
+}
+
+// verifyKey returns the active bot matching the API key.
+func (service *botService) verifyKey(ctx context.Context, botName, apiKey, origin string) (entities.Bot, error) {
+	active := true
+	bots, err := service.repository.Get(ctx, entities.BotSearch{Name: botName, IsActive: &active})
+	if err != nil {
+		return entities.Bot{}, err
+	}
+
+	if len(bots) == 0 || str.IsEmpty(apiKey) || entities.CompareHashAndPassword(bots[0].APIKey, apiKey) != nil {
+		err = exceptions.NewUnauthorizedException(fmt.Sprintf("invalid credentials for bot '%s'", botName))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, origin))
+		return entities.Bot{}, err
+	}
+
+	return bots[0], nil
+}
+
+func (service *botService) findBot(ctx context.Context, search entities.BotSearch, origin string) (entities.Bot, error) {
+	bots, err := service.repository.Get(ctx, search)
+	if err != nil {
+		return entities.Bot{}, err
+	}
+
+	if len(bots) == 0 {
+		reference := search.ID
+		if str.IsEmpty(reference) {
+			reference = search.Name
+		}
+		err = exceptions.NewNotFoundException(fmt.Sprintf("no bot was found with id or name: %s", reference))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, origin))
+		return entities.Bot{}, err
+	}
+
+	return bots[0], nil
+}
+
+func (service *botService) generateKey() (string, string, error) {
+	apiKey, err := entities.GenerateAPIKey()
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "generateKey"))
+		return str.Empty, str.Empty, err
+	}
+
+	hashedAPIKey, err := entities.HashPassword(apiKey)
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "generateKey"))
+		return str.Empty, str.Empty, err
+	}
+
+	return apiKey, hashedAPIKey, nil
+}
@@ -0,0 +1,323 @@
+package bot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/app/bot"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func Test_BotService_Create(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("create bot and return its api key once", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		ctx := context.TODO()
+		request := entities.Bot{Name: "stock", Scopes: []string{entities.CommandsScope}}
+		var hashedAPIKey string
+
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: request.Name}).Return([]entities.Bot{}, nil)
+		repositoryMock.On("Create", ctx, request, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+			hashedAPIKey = args.String(2)
+		}).Return("bot123", nil)
+
+		service := bot.NewBotService(configs, repositoryMock, nil, nil, logs)
+
+		response, err := service.Create(ctx, request)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "bot123", response.ID)
+		assert.NotEqual(t, response.APIKey, hashedAPIKey)
+		assert.NoError(t, entities.CompareHashAndPassword(hashedAPIKey, response.APIKey))
+	})
+
+	t.Run("bot already exists", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		ctx := context.TODO()
+		request := entities.Bot{Name: "stock"}
+
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: request.Name}).Return([]entities.Bot{request}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, nil, nil, logs)
+
+		_, err := service.Create(ctx, request)
+
+		assert.Equal(t, exceptions.NewDuplicatedException(fmt.Sprintf("bot '%s' already exist", request.Name)), err)
+		repositoryMock.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_BotService_Authenticate(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	active := true
+	botSearch := entities.BotSearch{Name: "stock", IsActive: &active}
+	roomSearch := entities.RoomSearch{ID: "room1"}
+	hashedAPIKey, _ := entities.HashPassword("secret")
+	registered := entities.Bot{ID: "bot123", Name: "stock", APIKey: hashedAPIKey, IsActive: true}
+
+	t.Run("authenticate bot enabled in the room", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, botSearch).Return([]entities.Bot{registered}, nil)
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{{ID: "room1", Bots: []string{"stock"}}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		authenticated, err := service.Authenticate(ctx, "stock", "secret", "room1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, registered, authenticated)
+	})
+
+	t.Run("invalid api key", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, botSearch).Return([]entities.Bot{registered}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		_, err := service.Authenticate(ctx, "stock", "wrong", "room1")
+
+		assert.Equal(t, exceptions.NewUnauthorizedException("invalid credentials for bot 'stock'"), err)
+		roomsMock.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	})
+
+	t.Run("bot not enabled in the room", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, botSearch).Return([]entities.Bot{registered}, nil)
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{{ID: "room1"}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		_, err := service.Authenticate(ctx, "stock", "secret", "room1")
+
+		assert.Equal(t, exceptions.NewUnauthorizedException("bot 'stock' is not enabled in room room1"), err)
+	})
+}
+
+func Test_BotService_Rooms(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	active := true
+	hashedAPIKey, _ := entities.HashPassword("secret")
+
+	t.Run("list the active rooms enabling the bot", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "stock", IsActive: &active}).
+			Return([]entities.Bot{{Name: "stock", APIKey: hashedAPIKey}}, nil)
+		roomsMock.On("Get", ctx, entities.RoomSearch{Bot: "stock", IsActive: &active}).
+			Return([]entities.Room{{ID: "room1"}, {ID: "room2"}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		response, err := service.Rooms(ctx, "stock", "secret")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"room1", "room2"}, response.Rooms)
+	})
+
+	t.Run("invalid api key", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "stock", IsActive: &active}).
+			Return([]entities.Bot{{Name: "stock", APIKey: hashedAPIKey}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		_, err := service.Rooms(ctx, "stock", "wrong")
+
+		assert.Equal(t, exceptions.NewUnauthorizedException("invalid credentials for bot 'stock'"), err)
+		roomsMock.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	})
+}
+
+func Test_BotService_RegisterCommands(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	active := true
+	botSearch := entities.BotSearch{Name: "stock", IsActive: &active}
+	hashedAPIKey, _ := entities.HashPassword("secret")
+	commands := []entities.CommandDefinition{{Name: "stock", Args: []entities.CommandArgument{{Name: "code"}}}}
+
+	t.Run("store the commands of the bot", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		ctx := context.TODO()
+		registered := entities.Bot{ID: "bot123", Name: "stock", Scopes: []string{entities.CommandsScope}, APIKey: hashedAPIKey}
+		updated := registered
+		updated.Commands = commands
+
+		repositoryMock.On("Get", ctx, botSearch).Return([]entities.Bot{registered}, nil)
+		repositoryMock.On("Update", ctx, "bot123", updated).Return(nil)
+
+		service := bot.NewBotService(configs, repositoryMock, nil, nil, logs)
+
+		err := service.RegisterCommands(ctx, "stock", "secret", commands)
+
+		assert.NoError(t, err)
+		repositoryMock.AssertExpectations(t)
+	})
+
+	t.Run("bot without the commands scope", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, botSearch).Return([]entities.Bot{{ID: "bot123", Name: "stock", APIKey: hashedAPIKey}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, nil, nil, logs)
+
+		err := service.RegisterCommands(ctx, "stock", "secret", commands)
+
+		assert.Equal(t, exceptions.NewUnauthorizedException("bot 'stock' is missing the 'commands' scope"), err)
+		repositoryMock.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_BotService_RoomCommands(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	active := true
+
+	t.Run("a command belongs to the bot enabled first", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+		scopes := []string{entities.CommandsScope}
+
+		roomsMock.On("Get", ctx, entities.RoomSearch{ID: "room1"}).
+			Return([]entities.Room{{ID: "room1", Bots: []string{"stock", "quotes", "silent"}}}, nil)
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "stock", IsActive: &active}).Return([]entities.Bot{{
+			Name: "stock", Scopes: scopes, Commands: []entities.CommandDefinition{{Name: "stock"}},
+		}}, nil)
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "quotes", IsActive: &active}).Return([]entities.Bot{{
+			Name: "quotes", Scopes: scopes, Commands: []entities.CommandDefinition{{Name: "stock"}, {Name: "quote"}},
+		}}, nil)
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "silent", IsActive: &active}).Return([]entities.Bot{{
+			Name: "silent", Commands: []entities.CommandDefinition{{Name: "mute"}},
+		}}, nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		commands, err := service.RoomCommands(ctx, "room1")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []entities.RoomCommand{
+			{Definition: entities.CommandDefinition{Name: "stock"}, BotName: "stock"},
+			{Definition: entities.CommandDefinition{Name: "quote"}, BotName: "quotes"},
+		}, commands)
+	})
+}
+
+func Test_BotService_SendCommand(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("publish the command on the commands topic of the bot", func(t *testing.T) {
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+		request := entities.CommandRequest{CorrelationID: "corr1", RoomID: "room1", Bot: "stock", Command: "stock"}
+		value, _ := json.Marshal(request)
+
+		producerMock.On("Publish", ctx, "commands.stock", value, map[string]string{"correlation_id": "corr1"}).
+			Return(nil)
+
+		service := bot.NewBotService(configs, nil, nil, producerMock, logs)
+
+		err := service.SendCommand(ctx, request)
+
+		assert.NoError(t, err)
+		producerMock.AssertExpectations(t)
+	})
+}
+
+func Test_BotService_SetRoomBot(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	roomSearch := entities.RoomSearch{ID: "room1"}
+	ownedRoom := entities.Room{ID: "room1", OwnerID: "owner1", Bots: []string{}}
+
+	t.Run("owner enables a registered bot", func(t *testing.T) {
+		repositoryMock := mocks.NewBotRepositoryMock()
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+		request := entities.RoomBotRequest{RoomID: "room1", BotName: "stock", UserID: "owner1"}
+
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{ownedRoom}, nil)
+		repositoryMock.On("Get", ctx, entities.BotSearch{Name: "stock"}).Return([]entities.Bot{{Name: "stock"}}, nil)
+		roomsMock.On("Update", ctx, "room1", entities.Room{ID: "room1", OwnerID: "owner1", Bots: []string{"stock"}}).
+			Return(nil)
+
+		service := bot.NewBotService(configs, repositoryMock, roomsMock, nil, logs)
+
+		err := service.SetRoomBot(ctx, request, true)
+
+		assert.NoError(t, err)
+		roomsMock.AssertExpectations(t)
+	})
+
+	t.Run("only the owner can manage the room bots", func(t *testing.T) {
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+		request := entities.RoomBotRequest{RoomID: "room1", BotName: "stock", UserID: "user2"}
+
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{ownedRoom}, nil)
+
+		service := bot.NewBotService(configs, mocks.NewBotRepositoryMock(), roomsMock, nil, logs)
+
+		err := service.SetRoomBot(ctx, request, true)
+
+		assert.Equal(t, exceptions.NewUnauthorizedException("only the owner of room room1 can manage its bots"), err)
+		roomsMock.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin disables a bot of a room without owner", func(t *testing.T) {
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+		request := entities.RoomBotRequest{RoomID: "room1", BotName: "stock", Admin: true}
+
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{{ID: "room1", Bots: []string{"stock", "weather"}}}, nil)
+		roomsMock.On("Update", ctx, "room1", entities.Room{ID: "room1", Bots: []string{"weather"}}).Return(nil)
+
+		service := bot.NewBotService(configs, mocks.NewBotRepositoryMock(), roomsMock, nil, logs)
+
+		err := service.SetRoomBot(ctx, request, false)
+
+		assert.NoError(t, err)
+		roomsMock.AssertExpectations(t)
+	})
+
+	t.Run("room not found", func(t *testing.T) {
+		roomsMock := mocks.NewRoomRepositoryMock()
+		ctx := context.TODO()
+		request := entities.RoomBotRequest{RoomID: "room1", BotName: "stock", Admin: true}
+
+		roomsMock.On("Get", ctx, roomSearch).Return([]entities.Room{}, nil)
+
+		service := bot.NewBotService(configs, mocks.NewBotRepositoryMock(), roomsMock, nil, logs)
+
+		err := service.SetRoomBot(ctx, request, true)
+
+		assert.Equal(t, exceptions.NewNotFoundException("no room was found with id: room1"), err)
+	})
+}
@@ -0,0 +1,69 @@
+package deadletter
+
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/sebastianreh/chatroom/cmd/httpserver/resterror"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"net/http"
+)
+
+const handlerName = "deadletter.handler"
+
+type DeadLetterHandler interface {
+	Get(c echo.Context) error
+	Replay(c echo.Context) error
+}
+
+type deadLetterHandler struct {
+	config  config.Config
+	service DeadLetterService
+	logs    logger.Logger
+}
+
+func NewDeadLetterHandler(cfg config.Config, service DeadLetterService, logger logger.Logger) DeadLetterHandler {
+	return &deadLetterHandler{
+		config:  cfg,
+		service: service,
+		logs:    logger,
+	}
+}
+
+func (handler *deadLetterHandler) Get(ctx echo.Context) error {
+	search := new(entities.DeadLetterSearch)
+	if err := ctx.Bind(search); err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Get"))
+		ctx.Error(err)
+		return nil
+	}
+
+	deadLetters, err := handler.service.Get(ctx.Request().Context(), *search)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.JSON(http.StatusOK, deadLetters)
+}
+
+func (handler *deadLetterHandler) Replay(ctx echo.Context) error {
+	deadLetterID := ctx.Param("id")
+	if str.IsEmpty(deadLetterID) {
+		err := errors.New("error: empty id")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Replay"))
+		ctx.Error(err)
+		return nil
+	}
+
+	err := handler.service.Replay(ctx.Request().Context(), deadLetterID)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	return ctx.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,134 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/mongodb"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	repositoryName = "deadletter.repository"
+)
+
+type DeadLetterRepository interface {
+	Create(ctx context.Context, deadLetter entities.DeadLetter) (string, error)
+	Get(ctx context.Context, search entities.DeadLetterSearch) ([]entities.DeadLetter, error)
+	MarkReplayed(ctx context.Context, deadLetterID string, replayedAt time.Time) error
+}
+
+type deadLetterRepository struct {
+	config         config.Config
+	mongodb        mongodb.MongoDBier
+	logs           logger.Logger
+	collectionName string
+}
+
+func NewDeadLetterRepository(cfg config.Config, mongoDBier mongodb.MongoDBier, logger logger.Logger) DeadLetterRepository {
+	return &deadLetterRepository{
+		config:         cfg,
+		mongodb:        mongoDBier,
+		logs:           logger,
+		collectionName: cfg.MongoDB.Collections.DeadLetters,
+	}
+}
+
+func (repository *deadLetterRepository) Create(ctx context.Context, deadLetter entities.DeadLetter) (string, error) {
+	deadLetterDTO := entities.CreateDeadLetterDTOFromEntity(deadLetter)
+	_, err := repository.mongodb.Collection(repository.collectionName).InsertOne(ctx, deadLetterDTO)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Create"))
+		return str.Empty, err
+	}
+
+	return deadLetterDTO.ID.Hex(), nil
+}
+
+func (repository *deadLetterRepository) Get(ctx context.Context, search entities.DeadLetterSearch) ([]entities.DeadLetter, error) {
+	deadLetters := make([]entities.DeadLetter, 0)
+	collection := repository.mongodb.Collection(repository.collectionName)
+	findOptions := options.Find().SetSort(bson.D{{Key: "failed_at", Value: -1}})
+	cursor, err := collection.Find(ctx, createFilter(search), findOptions)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "Get"))
+		return deadLetters, err
+	}
+
+	defer func() {
+		errClose := cursor.Close(ctx)
+		if errClose != nil {
+			repository.logs.Error(str.ErrorConcat(errClose, repositoryName, "Get"))
+		}
+	}()
+
+	for cursor.Next(ctx) {
+		deadLetterDTO := new(entities.DeadLetterDTO)
+		err = cursor.Decode(deadLetterDTO)
+		if err != nil {
+			repository.logs.Error(str.ErrorConcat(err, repositoryName, "Get"))
+			return deadLetters, err
+		}
+
+		deadLetters = append(deadLetters, entities.CreateDeadLetterEntityFromDTO(*deadLetterDTO))
+	}
+
+	return deadLetters, nil
+}
+
+func (repository *deadLetterRepository) MarkReplayed(ctx context.Context, deadLetterID string, replayedAt time.Time) error {
+	foundID, err := primitive.ObjectIDFromHex(deadLetterID)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "MarkReplayed"))
+		return err
+	}
+
+	filter := bson.M{entities.DeadLetterIDField: foundID}
+	update := bson.D{
+		{Key: "$set",
+			Value: bson.D{
+				primitive.E{Key: entities.DeadLetterReplayedAtField, Value: replayedAt},
+			},
+		},
+	}
+
+	result, err := repository.mongodb.Collection(repository.collectionName).UpdateOne(ctx, filter, update)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "MarkReplayed"))
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		err = exceptions.NewNotFoundException(fmt.Sprintf("dead letter with ID:%s not found", deadLetterID))
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "MarkReplayed"))
+		return err
+	}
+
+	return nil
+}
+
+func createFilter(search entities.DeadLetterSearch) bson.D {
+	filter := bson.D{}
+	if !str.IsEmpty(search.ID) {
+		id, _ := primitive.ObjectIDFromHex(search.ID)
+		filter = append(filter, bson.E{Key: entities.DeadLetterIDField, Value: id})
+	}
+
+	if !str.IsEmpty(search.Topic) {
+		filter = append(filter, bson.E{Key: entities.DeadLetterTopicField, Value: search.Topic})
+	}
+
+	if search.Replayed != nil {
+		filter = append(filter, bson.E{Key: entities.DeadLetterReplayedAtField,
+			Value: bson.M{"$exists": *search.Replayed}})
+	}
+
+	return filter
+}
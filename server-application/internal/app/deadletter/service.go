@@ -0,0 +1,92 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/broker"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"time"
+)
+
+const (
+	serviceName = "deadletter.service"
+)
+
+type DeadLetterService interface {
+	Save(ctx context.Context, deadLetter entities.DeadLetter) error
+	Get(ctx context.Context, search entities.DeadLetterSearch) (entities.DeadLettersGetResponse, error)
+	Replay(ctx context.Context, deadLetterID string) error
+}
+
+type deadLetterService struct {
+	config     config.Config
+	repository DeadLetterRepository
+	producer   broker.Publisher
+	logs       logger.Logger
+}
+
+func NewDeadLetterService(cfg config.Config, repository DeadLetterRepository, producer broker.Publisher, logger logger.Logger) DeadLetterService {
+	return &deadLetterService{
+		config:     cfg,
+		repository: repository,
+		producer:   producer,
+		logs:       logger,
+	}
+}
+
+// Save stores the dead letter so it can be listed and replayed, and publishes it with its error metadata to
+// the dead-letter topic for any other consumer. Failing to publish is only logged once the letter is stored.
+func (service *deadLetterService) Save(ctx context.Context, deadLetter entities.DeadLetter) error {
+	if deadLetter.FailedAt.IsZero() {
+		deadLetter.FailedAt = time.Now().UTC()
+	}
+
+	_, err := service.repository.Create(ctx, deadLetter)
+	if err != nil {
+		return err
+	}
+
+	err = service.producer.Publish(ctx, service.config.Kafka.DeadLetter.Topic, []byte(deadLetter.Payload),
+		deadLetter.Headers())
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "Save"))
+	}
+
+	return nil
+}
+
+func (service *deadLetterService) Get(ctx context.Context, search entities.DeadLetterSearch) (entities.DeadLettersGetResponse, error) {
+	deadLetters, err := service.repository.Get(ctx, search)
+	if err != nil {
+		return entities.DeadLettersGetResponse{}, err
+	}
+
+	return entities.DeadLettersGetResponse{DeadLetters: deadLetters}, nil
+}
+
+// Replay publishes the dead letter back into the topic it was consumed from.
+func (service *deadLetterService) Replay(ctx context.Context, deadLetterID string) error {
+	deadLetters, err := service.repository.Get(ctx, entities.DeadLetterSearch{ID: deadLetterID})
+	if err != nil {
+		return err
+	}
+
+	if len(deadLetters) == 0 {
+		err = exceptions.NewNotFoundException(fmt.Sprintf("no dead letter was found with id: %s", deadLetterID))
+		service.logs.Warn(str.ErrorConcat(err, serviceName, "Replay"))
+		return err
+	}
+
+	deadLetter := deadLetters[0]
+	err = service.producer.Publish(ctx, deadLetter.Topic, []byte(deadLetter.Payload), nil)
+	if err != nil {
+		service.logs.Error(str.ErrorConcat(err, serviceName, "Replay"))
+		return err
+	}
+
+	return service.repository.MarkReplayed(ctx, deadLetterID, time.Now().UTC())
+}
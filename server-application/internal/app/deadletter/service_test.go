@@ -0,0 +1,139 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"github.com/sebastianreh/chatroom/internal/app/deadletter"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func Test_DeadLetterService_Save(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	failedAt := time.Date(2023, 10, 18, 10, 0, 0, 0, time.UTC)
+	deadLetter := entities.DeadLetter{
+		Topic:    "stocks",
+		Payload:  `{"room_id":`,
+		Error:    "unexpected end of JSON input",
+		Attempts: 1,
+		FailedAt: failedAt,
+	}
+
+	t.Run("dead letter is stored and published with its error metadata", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Create", ctx, deadLetter).Return("id123", nil)
+		producerMock.On("Publish", ctx, configs.Kafka.DeadLetter.Topic, []byte(deadLetter.Payload), map[string]string{
+			entities.DeadLetterSourceTopicHeader: "stocks",
+			entities.DeadLetterErrorHeader:       "unexpected end of JSON input",
+			entities.DeadLetterAttemptsHeader:    "1",
+			entities.DeadLetterFailedAtHeader:    "2023-10-18T10:00:00Z",
+		}).Return(nil)
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Save(ctx, deadLetter)
+
+		assert.NoError(t, err)
+		repositoryMock.AssertExpectations(t)
+		producerMock.AssertExpectations(t)
+	})
+
+	t.Run("stored dead letter is kept when publishing fails", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Create", ctx, deadLetter).Return("id123", nil)
+		producerMock.On("Publish", ctx, mock.Anything, mock.Anything, mock.Anything).Return(errors.New("broker down"))
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Save(ctx, deadLetter)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("error storing the dead letter", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+		expectedErr := errors.New("mongo error")
+
+		repositoryMock.On("Create", ctx, deadLetter).Return("", expectedErr)
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Save(ctx, deadLetter)
+
+		assert.Equal(t, expectedErr, err)
+		producerMock.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_DeadLetterService_Replay(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("dead letter is published back to its topic", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+		deadLetter := entities.DeadLetter{ID: "id123", Topic: "stocks", Payload: `{"room_id":"room1"}`}
+
+		repositoryMock.On("Get", ctx, entities.DeadLetterSearch{ID: "id123"}).Return([]entities.DeadLetter{deadLetter}, nil)
+		producerMock.On("Publish", ctx, "stocks", []byte(deadLetter.Payload), map[string]string(nil)).Return(nil)
+		repositoryMock.On("MarkReplayed", ctx, "id123", mock.AnythingOfType("time.Time")).Return(nil)
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Replay(ctx, "id123")
+
+		assert.NoError(t, err)
+		repositoryMock.AssertExpectations(t)
+		producerMock.AssertExpectations(t)
+	})
+
+	t.Run("dead letter not found", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("Get", ctx, entities.DeadLetterSearch{ID: "id123"}).Return([]entities.DeadLetter{}, nil)
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Replay(ctx, "id123")
+
+		_, ok := err.(exceptions.NotFoundException)
+		assert.True(t, ok)
+	})
+
+	t.Run("dead letter is not marked when publishing fails", func(t *testing.T) {
+		repositoryMock := mocks.NewDeadLetterRepositoryMock()
+		producerMock := mocks.NewProducerMock()
+		ctx := context.TODO()
+		deadLetter := entities.DeadLetter{ID: "id123", Topic: "stocks", Payload: `{"room_id":"room1"}`}
+		expectedErr := errors.New("broker down")
+
+		repositoryMock.On("Get", ctx, entities.DeadLetterSearch{ID: "id123"}).Return([]entities.DeadLetter{deadLetter}, nil)
+		producerMock.On("Publish", ctx, "stocks", mock.Anything, mock.Anything).Return(expectedErr)
+
+		service := deadletter.NewDeadLetterService(configs, repositoryMock, producerMock, logs)
+
+		err := service.Replay(ctx, "id123")
+
+		assert.Equal(t, expectedErr, err)
+		repositoryMock.AssertNotCalled(t, "MarkReplayed", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
@@ -2,6 +2,7 @@ package ping
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/sebastianreh/chatroom/pkg/kafka"
 	"net/http"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 
 type Handler interface {
 	Ping(c echo.Context) error
+	Health(c echo.Context) error
 }
 
 type Response struct {
@@ -18,13 +20,19 @@ type Response struct {
 	Uptime  time.Time `json:"uptime"`
 }
 
+type HealthResponse struct {
+	Consumers map[string]kafka.Health `json:"consumers"`
+}
+
 type StatusHandler struct {
-	config config.Config
+	config         config.Config
+	stocksConsumer kafka.SupervisedConsumer
 }
 
-func NewSHandierPing(cfg config.Config) Handler {
+func NewSHandierPing(cfg config.Config, stocksConsumer kafka.SupervisedConsumer) Handler {
 	return &StatusHandler{
-		config: cfg,
+		config:         cfg,
+		stocksConsumer: stocksConsumer,
 	}
 }
 
@@ -35,3 +43,18 @@ func (s *StatusHandler) Ping(ctx echo.Context) error {
 		Uptime:  time.Now().UTC(),
 	})
 }
+
+// Health reports the state of the consumers, it answers 503 when one of them stopped consuming for good.
+func (s *StatusHandler) Health(ctx echo.Context) error {
+	stocksHealth := s.stocksConsumer.Health()
+	status := http.StatusOK
+	if !stocksHealth.IsHealthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	return ctx.JSON(status, HealthResponse{
+		Consumers: map[string]kafka.Health{
+			s.config.Kafka.StocksTopic: stocksHealth,
+		},
+	})
+}
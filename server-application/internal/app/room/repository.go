@@ -97,6 +97,7 @@ func (repository *roomRepository) Update(ctx context.Context, roomID string, roo
 			Value: bson.D{
 				primitive.E{Key: entities.RoomNameField, Value: room.Name},
 				primitive.E{Key: entities.RoomIsActiveNameField, Value: room.IsActive},
+				primitive.E{Key: entities.RoomBotsField, Value: room.Bots},
 			},
 		},
 	}
@@ -132,6 +133,10 @@ func createFilter(search entities.RoomSearch) bson.D {
 		filter = append(filter, bson.E{Key: entities.RoomIsActiveNameField, Value: search.IsActive})
 	}
 
+	if !str.IsEmpty(search.Bot) {
+		filter = append(filter, bson.E{Key: entities.RoomBotsField, Value: search.Bot})
+	}
+
 	if len(filter) == 0 {
 		return bson.D{}
 	}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	ws "github.com/sebastianreh/chatroom/pkg/websocket"
+	"sort"
+	"sync"
+)
+
+// registeredCommand is a command and the bot socket it is routed to.
+type registeredCommand struct {
+	definition entities.CommandDefinition
+	botName    string
+	socket     *ws.Client
+}
+
+// commandRegistry holds the commands registered by the bots connected to the room sockets of this instance, per
+// room.
+type commandRegistry struct {
+	mutex sync.RWMutex
+	rooms map[string]map[string]registeredCommand
+}
+
+func newCommandRegistry() *commandRegistry {
+	return &commandRegistry{rooms: make(map[string]map[string]registeredCommand)}
+}
+
+// register adds the bot commands to the room. A command owned by another connected bot is rejected and
+// nothing is registered, a bot registering again replaces its own commands.
+func (r *commandRegistry) register(roomID, botName string, socket *ws.Client, definitions []entities.CommandDefinition) error {
+	for _, definition := range definitions {
+		if err := definition.Validate(); err != nil {
+			return err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	commands, ok := r.rooms[roomID]
+	if !ok {
+		commands = make(map[string]registeredCommand)
+		r.rooms[roomID] = commands
+	}
+
+	for _, definition := range definitions {
+		if owner, ok := commands[definition.Name]; ok && owner.botName != botName {
+			return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+				fmt.Sprintf("command '%s' is already registered by bot '%s'", definition.Name, owner.botName))
+		}
+	}
+
+	for name, command := range commands {
+		if command.botName == botName {
+			delete(commands, name)
+		}
+	}
+	for _, definition := range definitions {
+		commands[definition.Name] = registeredCommand{definition: definition, botName: botName, socket: socket}
+	}
+
+	return nil
+}
+
+// unregister removes the commands routed to the socket, once the bot is disconnected.
+func (r *commandRegistry) unregister(roomID string, socket *ws.Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	commands := r.rooms[roomID]
+	for name, command := range commands {
+		if command.socket == socket {
+			delete(commands, name)
+		}
+	}
+
+	if len(commands) == 0 {
+		delete(r.rooms, roomID)
+	}
+}
+
+func (r *commandRegistry) lookup(roomID, name string) (registeredCommand, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	command, ok := r.rooms[roomID][name]
+	return command, ok
+}
+
+// help lists the room commands sorted by name, /help itself first. The commands of the bots registered through
+// the API are listed unless a connected bot registered the same command, which takes precedence.
+func (r *commandRegistry) help(roomID string, brokered []entities.RoomCommand) entities.CommandHelpPayload {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var commands []entities.CommandHelp
+	for _, command := range r.rooms[roomID] {
+		commands = append(commands, entities.CommandHelp{
+			Name:  command.definition.Name,
+			Usage: command.definition.Usage(),
+			Help:  command.definition.Help,
+			Bot:   command.botName,
+		})
+	}
+	for _, command := range brokered {
+		if _, ok := r.rooms[roomID][command.Definition.Name]; ok {
+			continue
+		}
+		commands = append(commands, entities.CommandHelp{
+			Name:  command.Definition.Name,
+			Usage: command.Definition.Usage(),
+			Help:  command.Definition.Help,
+			Bot:   command.BotName,
+		})
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+
+	helpCommand := entities.CommandDefinition{Name: entities.HelpCommand}
+	return entities.CommandHelpPayload{
+		Commands: append([]entities.CommandHelp{{
+			Name:  helpCommand.Name,
+			Usage: helpCommand.Usage(),
+			Help:  "Lists the commands available in the room",
+		}}, commands...),
+	}
+}
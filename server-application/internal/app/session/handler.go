@@ -1,20 +1,27 @@
 package session
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/sebastianreh/chatroom/cmd/httpserver/resterror"
+	"github.com/sebastianreh/chatroom/internal/app/bot"
+	"github.com/sebastianreh/chatroom/internal/app/deadletter"
 	"github.com/sebastianreh/chatroom/internal/config"
 	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/broker"
 	"github.com/sebastianreh/chatroom/pkg/kafka"
 	"github.com/sebastianreh/chatroom/pkg/logger"
 	str "github.com/sebastianreh/chatroom/pkg/strings"
 	ws "github.com/sebastianreh/chatroom/pkg/websocket"
-	"log"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const handlerName = "session.handler"
@@ -25,52 +32,180 @@ type SessionHandler interface {
 	GetMessages(c echo.Context) error
 	HandleChatConnection(c echo.Context) error
 	HandleBotConnection(c echo.Context) error
+	HandleConnection(c echo.Context) error
+	Stream(c echo.Context) error
+	Poll(c echo.Context) error
+	SendMessage(c echo.Context) error
 	Listen()
+	ReadStockMessage(message []byte)
 }
 
 type sessionHandler struct {
-	config    config.Config
-	websocket ws.Websocket
-	listener  kafka.Consumer
-	service   SessionService
-	logs      logger.Logger
+	config      config.Config
+	websocket   ws.Websocket
+	listener    broker.Subscriber
+	retryPolicy kafka.RetryPolicy
+	service     SessionService
+	deadLetters deadletter.DeadLetterService
+	bots        bot.BotService
+	commands    *commandRegistry
+	pending     *pendingCommands
+	logs        logger.Logger
 }
 
-func NewSessionHandler(cfg config.Config, service SessionService, websocket ws.Websocket, listener kafka.Consumer, logger logger.Logger) SessionHandler {
+func NewSessionHandler(cfg config.Config, service SessionService, deadLetters deadletter.DeadLetterService, bots bot.BotService, websocket ws.Websocket, listener broker.Subscriber, logger logger.Logger) SessionHandler {
 	return &sessionHandler{
 		config:    cfg,
 		websocket: websocket,
 		listener:  listener,
-		service:   service,
-		logs:      logger,
+		retryPolicy: kafka.RetryPolicy{
+			MaxAttempts: cfg.Kafka.DeadLetter.MaxAttempts,
+			Backoff:     cfg.Kafka.DeadLetter.RetryBackoff,
+		},
+		service:     service,
+		deadLetters: deadLetters,
+		bots:        bots,
+		commands:    newCommandRegistry(),
+		pending:     newPendingCommands(),
+		logs:        logger,
 	}
 }
 
+// Listen consumes the bot messages until the listener is closed, restarts on failures are up to the listener.
 func (handler *sessionHandler) Listen() {
 	err := handler.listener.Listen(handler.ReadStockMessage)
 	if err != nil {
-		if strings.Contains(err.Error(), "Subscribed topic not available") {
-			handler.Listen()
-		}
 		handler.logs.Error(str.ErrorConcat(err, handlerName, "Listen"))
 		return
 	}
 }
 
+// ReadStockMessage delivers a bot message to its room following the retry policy. Messages that still fail
+// are dead-lettered so they can be inspected and replayed, unless they reached the local sockets: replaying them
+// would deliver them there twice, and they stay in the replay log for the other instances' clients.
 func (handler *sessionHandler) ReadStockMessage(message []byte) {
-	var stock entities.StockMessage
-	err := json.Unmarshal(message, &stock)
+	ctx := context.Background()
+	correlationID := replyCorrelationID(message)
+	if !handler.acceptReply(ctx, correlationID) {
+		return
+	}
+
+	attempts := 1
+	envelope, err := handler.processStockMessage(ctx, message)
+	if err == nil {
+		attempts, err = handler.retryPolicy.Run(ctx, handler.deliverer(envelope))
+	}
+	var relayErr ws.RelayError
+	if err == nil || errors.As(err, &relayErr) {
+		if err != nil {
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "ReadStockMessage"))
+		}
+		handler.resolveReply(ctx, correlationID)
+		return
+	}
+
+	handler.logs.Error(str.ErrorConcat(err, handlerName, "ReadStockMessage"))
+	deadLetter := entities.DeadLetter{
+		Topic:    handler.config.Kafka.StocksTopic,
+		Payload:  string(message),
+		Error:    err.Error(),
+		Attempts: attempts,
+	}
+
+	err = handler.deadLetters.Save(ctx, deadLetter)
 	if err != nil {
 		handler.logs.Error(str.ErrorConcat(err, handlerName, "ReadStockMessage"))
 		return
 	}
 
-	handler.logs.Info("New message received", handlerName+".Listen")
+	if !str.IsEmpty(correlationID) {
+		if err = handler.service.DeadLetterReply(ctx, correlationID); err != nil {
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "ReadStockMessage"))
+		}
+	}
+}
 
-	err = handler.websocket.BroadCastMessage(message, stock.RoomID)
+// replyCorrelationID returns the correlation ID of the bot message, empty when it doesn't reply to a command.
+func replyCorrelationID(message []byte) string {
+	var reply entities.StockMessage
+	if err := json.Unmarshal(message, &reply); err != nil {
+		return ""
+	}
+
+	return reply.CorrelationID
+}
+
+// acceptReply drops the replies to commands already resolved, by an earlier reply or by their timeout, unless
+// they replay a dead-lettered reply. Messages without a correlation ID, or whose command can't be checked, are
+// delivered.
+func (handler *sessionHandler) acceptReply(ctx context.Context, correlationID string) bool {
+	if str.IsEmpty(correlationID) {
+		return true
+	}
+
+	accepted, err := handler.service.AcceptReply(ctx, correlationID)
 	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "acceptReply"))
+		return true
+	}
+
+	if !accepted {
+		handler.logs.Warn(fmt.Sprintf("dropping reply to command %s, it was already resolved", correlationID),
+			handlerName+".acceptReply")
+	}
+
+	return accepted
+}
+
+// resolveReply resolves the command once its reply was delivered. Until then its timeout stays pending, so the
+// user is still told when the reply can't be delivered.
+func (handler *sessionHandler) resolveReply(ctx context.Context, correlationID string) {
+	if str.IsEmpty(correlationID) {
 		return
 	}
+
+	handler.pending.remove(correlationID)
+	if _, err := handler.service.ResolveCommand(ctx, correlationID, entities.RepliedResolution); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "resolveReply"))
+	}
+}
+
+// processStockMessage builds and sequences the bot_message event once, retrying its delivery never duplicates it.
+func (handler *sessionHandler) processStockMessage(ctx context.Context, message []byte) (entities.Envelope, error) {
+	var stock entities.StockMessage
+	err := json.Unmarshal(message, &stock)
+	if err != nil {
+		return entities.Envelope{}, err
+	}
+
+	handler.logs.Info("New message received", handlerName+".Listen")
+
+	envelope, err := entities.NewEnvelope(entities.BotMessageFrameType, stock.RoomID, stock)
+	if err != nil {
+		return envelope, err
+	}
+
+	return handler.sequence(ctx, envelope), nil
+}
+
+// deliverer returns the delivery attempts of a room event. Once the event reached the local sockets only its
+// relay to the other instances is retried, and its failures are relay errors.
+func (handler *sessionHandler) deliverer(envelope entities.Envelope) func() error {
+	frame := envelope.ToBytes()
+	delivered := false
+	return func() error {
+		if delivered {
+			if err := handler.websocket.Relay(frame, envelope.RoomID); err != nil {
+				return ws.RelayError{Err: err}
+			}
+			return nil
+		}
+
+		err := handler.websocket.BroadCastMessage(frame, envelope.RoomID)
+		var relayErr ws.RelayError
+		delivered = err == nil || errors.As(err, &relayErr)
+		return err
+	}
 }
 
 func (handler *sessionHandler) Join(ctx echo.Context) error {
@@ -89,7 +224,7 @@ func (handler *sessionHandler) Join(ctx echo.Context) error {
 	}
 
 	joinAction := entities.GetJoinAction(request.SessionUser)
-	err = handler.websocket.BroadCastMessage(joinAction.ToBytes(), request.RoomID)
+	err = handler.broadcast(ctx.Request().Context(), entities.SessionActionFrameType, request.RoomID, joinAction)
 	if err != nil {
 
 	}
@@ -122,15 +257,21 @@ func (handler *sessionHandler) closeSocketAndSendMessage(ctx echo.Context, reque
 		return err
 	}
 
+	return handler.exitSession(ctx, request)
+}
+
+// exitSession notifies the room and removes the user from the session. It runs both for explicit exits and
+// for sockets that died without the user leaving the room.
+func (handler *sessionHandler) exitSession(ctx echo.Context, request entities.SessionChatRequest) error {
 	exitAction := entities.GetExitAction(request.SessionUser)
-	err = handler.websocket.BroadCastMessage(exitAction.ToBytes(), request.RoomID)
+	err := handler.broadcast(ctx.Request().Context(), entities.SessionActionFrameType, request.RoomID, exitAction)
 	if err != nil {
-		handler.logs.Warn(str.ErrorConcat(err, handlerName, "closeSocketAndSendMessage"))
+		handler.logs.Warn(str.ErrorConcat(err, handlerName, "exitSession"))
 	}
 
 	err = handler.service.Exit(ctx.Request().Context(), request)
 	if err != nil {
-		handler.logs.Error(str.ErrorConcat(err, handlerName, "closeSocketAndSendMessage"))
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "exitSession"))
 		return err
 	}
 
@@ -163,55 +304,60 @@ func (handler *sessionHandler) HandleChatConnection(ctx echo.Context) error {
 		return nil
 	}
 
-	socket, err := handler.websocket.GetSocket(ctx.Response(), ctx.Request(), sessionChatRequest.RoomID, sessionChatRequest.UserID)
+	lastSeq, resuming, err := parseLastSeq(ctx)
 	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
 		ctx.Error(err)
 		return nil
 	}
 
+	var socketOptions []ws.SocketOption
+	if resuming {
+		socketOptions = append(socketOptions, ws.WithHeldDelivery())
+	}
+
+	socket, err := handler.websocket.GetSocket(ctx.Response(), ctx.Request(), sessionChatRequest.RoomID,
+		sessionChatRequest.UserID, socketOptions...)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	if resuming {
+		handler.resume(ctx.Request().Context(), socket, sessionChatRequest.RoomID, lastSeq)
+	}
+
 	messageChan := make(chan []byte)
 
 	go func() {
 		for msg := range messageChan {
-			var decodedMessage = new(entities.ChatMessage)
-			err := json.Unmarshal(msg, decodedMessage)
-			if err != nil {
-				handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
+			envelope, err := handler.handleChatFrame(ctx.Request().Context(), sessionChatRequest, msg,
+				handler.replyTo(socket))
+			if err == nil {
 				continue
 			}
 
-			if strings.HasPrefix(decodedMessage.Content, str.CommandPrefix) {
-				command, value := str.ParseStockCodeFromMessage(string(msg))
-				if command != str.Empty || value != str.Empty {
-					botMessage := entities.BotMessage{
-						Command: command,
-						Value:   value,
-					}
-					msg, _ = json.Marshal(botMessage)
-					err = handler.websocket.BroadCastMessage(msg, sessionChatRequest.RoomID)
-					continue
-				}
-			}
-
-			err = handler.websocket.BroadCastMessage(msg, sessionChatRequest.RoomID)
-			if err != nil {
-				handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
+			if _, ok := err.(exceptions.ProtocolException); ok {
+				handler.logs.Warn(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
+				handler.sendError(socket, sessionChatRequest.RoomID, envelope.ID, err)
 				continue
 			}
 
-			err = handler.service.SaveMessage(ctx.Request().Context(), *decodedMessage, sessionChatRequest.RoomID)
+			err = handler.websocket.CloseSocket(sessionChatRequest.RoomID, sessionChatRequest.UserID)
 			if err != nil {
-				err = handler.websocket.CloseSocket(sessionChatRequest.RoomID, sessionChatRequest.UserID)
-				if err != nil {
-					handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
-					continue
-				}
+				handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleChatConnection"))
 			}
 		}
 	}()
 
 	handler.readMessages(socket, messageChan)
 
+	if len(handler.websocket.Release(socket)) > 0 {
+		handler.logs.Info(fmt.Sprintf("connection lost for user %s on room %s",
+			sessionChatRequest.UserID, sessionChatRequest.RoomID), handlerName+".HandleChatConnection")
+		_ = handler.exitSession(ctx, sessionChatRequest)
+	}
+
 	return nil
 }
 
@@ -223,6 +369,14 @@ func (handler *sessionHandler) HandleBotConnection(ctx echo.Context) error {
 		return nil
 	}
 
+	apiKey := entities.BearerToken(ctx.Request().Header.Get(echo.HeaderAuthorization))
+	authenticated, err := handler.bots.Authenticate(ctx.Request().Context(), botSessionRequest.BotName, apiKey,
+		botSessionRequest.RoomID)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
 	socket, err := handler.websocket.GetSocket(ctx.Response(), ctx.Request(), botSessionRequest.RoomID, botSessionRequest.BotName)
 	if err != nil {
 		handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleBotConnection"))
@@ -233,28 +387,32 @@ func (handler *sessionHandler) HandleBotConnection(ctx echo.Context) error {
 	messageChan := make(chan []byte)
 
 	go func() {
-		for {
-			_, msg, err := socket.ReadMessage()
-			if err != nil {
-				log.Println(err)
-				break
+		for msg := range messageChan {
+			var decodedMessage entities.ChatMessage
+			envelope, err := entities.DecodeEnvelope(msg, botSessionRequest.RoomID)
+			if err == nil && envelope.Type == entities.CommandRegistrationFrameType {
+				err = handler.registerCommands(socket, authenticated, botSessionRequest.RoomID, envelope)
+			} else if err == nil {
+				err = envelope.DecodePayload(&decodedMessage)
 			}
-
-			var decodedMessage = new(entities.ChatMessage)
-			err = json.Unmarshal(msg, decodedMessage)
 			if err != nil {
 				handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleBotConnection"))
+				handler.sendError(socket, botSessionRequest.RoomID, envelope.ID, err)
+				continue
+			}
+
+			if envelope.Type == entities.CommandRegistrationFrameType {
 				continue
 			}
 
 			if strings.HasPrefix(decodedMessage.Content, fmt.Sprintf(str.CommandPrefix+"%s", botSessionRequest.BotName)) {
-				contentBytes, err := json.Marshal(decodedMessage.Content)
+				reply, err := entities.NewEnvelope(entities.ChatMessageFrameType, botSessionRequest.RoomID, decodedMessage)
 				if err != nil {
 					handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleBotConnection"))
 					continue
 				}
 
-				err = handler.websocket.SendMessageToSocket(contentBytes, socket)
+				err = handler.websocket.SendMessageToSocket(reply.ToBytes(), socket)
 				if err != nil {
 					handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleBotConnection"))
 					continue
@@ -264,11 +422,581 @@ func (handler *sessionHandler) HandleBotConnection(ctx echo.Context) error {
 	}()
 
 	handler.readMessages(socket, messageChan)
+	handler.commands.unregister(botSessionRequest.RoomID, socket)
+	handler.websocket.Release(socket)
+
+	return nil
+}
+
+// registerCommands routes the commands of the registration frame to the bot socket until it disconnects, the
+// frame is acknowledged once they are registered. Only bots with the commands scope may register commands. The
+// registry is kept by each instance, so with CLUSTER_ENABLED bots must register their commands through the API
+// and get them through the broker, which every instance routes to.
+func (handler *sessionHandler) registerCommands(socket *ws.Client, authenticated entities.Bot, roomID string, envelope entities.Envelope) error {
+	if !authenticated.HasScope(entities.CommandsScope) {
+		return exceptions.NewProtocolException(exceptions.UnauthorizedCode,
+			fmt.Sprintf("bot '%s' is missing the '%s' scope", authenticated.Name, entities.CommandsScope))
+	}
+
+	if handler.config.Cluster.Enabled {
+		return exceptions.NewProtocolException(exceptions.ClusterUnsupportedCode,
+			"commands can't be registered over the socket on a cluster, register them through "+
+				"PUT /session/bot/commands to get them through the broker")
+	}
+
+	var registration entities.CommandRegistration
+	if err := envelope.DecodePayload(&registration); err != nil {
+		return err
+	}
+
+	err := handler.commands.register(roomID, authenticated.Name, socket, registration.Commands)
+	if err != nil {
+		return err
+	}
+
+	handler.logs.Info(fmt.Sprintf("bot %s registered %d commands on room %s", authenticated.Name,
+		len(registration.Commands), roomID), handlerName+".registerCommands")
+	handler.acknowledge(socket, envelope)
+	return nil
+}
+
+// HandleConnection serves a multiplexed socket: the user follows several rooms over a single connection with
+// subscribe and unsubscribe control frames, chat frames are routed to the room set in their room_id.
+func (handler *sessionHandler) HandleConnection(ctx echo.Context) error {
+	var sessionUser entities.SessionUser
+	if err := ctx.Bind(&sessionUser); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleConnection"))
+		ctx.Error(err)
+		return nil
+	}
+
+	if str.IsEmpty(sessionUser.UserID) {
+		err := resterror.NewBadRequestError("user_id is required")
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleConnection"))
+		ctx.Error(err)
+		return nil
+	}
+
+	socket, err := handler.websocket.Connect(ctx.Response(), ctx.Request(), sessionUser.UserID)
+	if err != nil {
+		ctx.Error(err)
+		return nil
+	}
+
+	messageChan := make(chan []byte)
+
+	go func() {
+		for msg := range messageChan {
+			envelope, err := handler.handleConnectionFrame(ctx.Request().Context(), socket, sessionUser, msg)
+			if err == nil {
+				continue
+			}
+
+			if _, ok := err.(exceptions.ProtocolException); ok {
+				handler.logs.Warn(str.ErrorConcat(err, handlerName, "HandleConnection"))
+				handler.sendError(socket, envelope.RoomID, envelope.ID, err)
+				continue
+			}
+
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "HandleConnection"))
+		}
+	}()
+
+	handler.readMessages(socket, messageChan)
+
+	for _, roomID := range handler.websocket.Release(socket) {
+		handler.logs.Info(fmt.Sprintf("connection lost for user %s on room %s", sessionUser.UserID, roomID),
+			handlerName+".HandleConnection")
+		_ = handler.exitSession(ctx, entities.SessionChatRequest{RoomID: roomID, SessionUser: sessionUser})
+	}
 
 	return nil
 }
 
-func (handler *sessionHandler) readMessages(socket *websocket.Conn, messageChan chan []byte) {
+// handleConnectionFrame handles a frame of a multiplexed socket. Control frames are acknowledged with a frame
+// of the same type and id, chat frames are only accepted for the rooms the socket is subscribed to.
+func (handler *sessionHandler) handleConnectionFrame(ctx context.Context, socket *ws.Client, sessionUser entities.SessionUser, msg []byte) (entities.Envelope, error) {
+	envelope, err := entities.DecodeEnvelope(msg, str.Empty)
+	if err != nil {
+		return envelope, err
+	}
+
+	if str.IsEmpty(envelope.RoomID) {
+		return envelope, exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			"frame room_id is required on a multiplexed connection")
+	}
+
+	switch envelope.Type {
+	case entities.SubscribeFrameType:
+		var subscription entities.SubscriptionPayload
+		if err = envelope.DecodePayload(&subscription); err != nil {
+			return envelope, err
+		}
+
+		handler.acknowledge(socket, envelope)
+		if subscription.LastSeq == nil {
+			handler.websocket.Join(socket, envelope.RoomID)
+			return envelope, nil
+		}
+
+		handler.websocket.Join(socket, envelope.RoomID, ws.WithHeldDelivery())
+		handler.resume(ctx, socket, envelope.RoomID, *subscription.LastSeq)
+		return envelope, nil
+	case entities.UnsubscribeFrameType:
+		if err = handler.websocket.Leave(socket, envelope.RoomID); err != nil {
+			return envelope, exceptions.NewProtocolException(exceptions.NotSubscribedCode, err.Error())
+		}
+
+		handler.acknowledge(socket, envelope)
+		return envelope, nil
+	}
+
+	if !socket.InGroup(envelope.RoomID) {
+		return envelope, exceptions.NewProtocolException(exceptions.NotSubscribedCode,
+			fmt.Sprintf("connection is not subscribed to room '%s'", envelope.RoomID))
+	}
+
+	request := entities.SessionChatRequest{
+		RoomID:      envelope.RoomID,
+		SessionUser: sessionUser,
+	}
+
+	return handler.handleChatFrame(ctx, request, msg, handler.replyTo(socket))
+}
+
+func (handler *sessionHandler) acknowledge(socket *ws.Client, envelope entities.Envelope) {
+	ack, err := entities.NewEnvelope(envelope.Type, envelope.RoomID, envelope.Payload)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "acknowledge"))
+		return
+	}
+
+	ack.ID = envelope.ID
+	if err = handler.websocket.SendMessageToSocket(ack.ToBytes(), socket); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "acknowledge"))
+	}
+}
+
+// Stream delivers the room events as Server-Sent Events, for clients that can't upgrade to a websocket.
+func (handler *sessionHandler) Stream(ctx echo.Context) error {
+	request, lastSeq, resuming, err := bindStreamRequest(ctx)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Stream"))
+		ctx.Error(err)
+		return nil
+	}
+
+	client := handler.subscribe(ctx.Request().Context(), request, lastSeq, resuming)
+	response := ctx.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	keepAlive := time.NewTicker(handler.config.Websocket.PingInterval)
+	defer keepAlive.Stop()
+
+stream:
+	for {
+		select {
+		case frame := <-client.Messages():
+			if err = writeStreamEvent(response, frame); err != nil {
+				break stream
+			}
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(response, ": keep-alive\n\n"); err != nil {
+				break stream
+			}
+			response.Flush()
+		case <-client.Done():
+			break stream
+		case <-ctx.Request().Context().Done():
+			break stream
+		}
+	}
+
+	if len(handler.websocket.Release(client)) > 0 {
+		handler.logs.Info(fmt.Sprintf("stream closed for user %s on room %s", request.UserID, request.RoomID),
+			handlerName+".Stream")
+		_ = handler.exitSession(ctx, request)
+	}
+
+	return nil
+}
+
+// Poll answers with the room events available after last_seq, waiting up to LongPollTimeout for new ones.
+// Clients poll again with the seq of the last event received, so nothing is lost between requests.
+func (handler *sessionHandler) Poll(ctx echo.Context) error {
+	request, lastSeq, resuming, err := bindStreamRequest(ctx)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "Poll"))
+		ctx.Error(err)
+		return nil
+	}
+
+	client := handler.subscribe(ctx.Request().Context(), request, lastSeq, resuming)
+	defer handler.websocket.Release(client)
+
+	timeout := time.NewTimer(handler.config.Session.LongPollTimeout)
+	defer timeout.Stop()
+
+	frames := make([]json.RawMessage, 0)
+	select {
+	case frame := <-client.Messages():
+		frames = append(frames, frame)
+	case <-timeout.C:
+	case <-client.Done():
+	case <-ctx.Request().Context().Done():
+		return nil
+	}
+
+drain:
+	for len(frames) > 0 {
+		select {
+		case frame := <-client.Messages():
+			frames = append(frames, frame)
+		default:
+			break drain
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, frames)
+}
+
+// SendMessage accepts a chat frame over plain HTTP, for clients using the SSE or long-poll delivery.
+func (handler *sessionHandler) SendMessage(ctx echo.Context) error {
+	request, _, _, err := bindStreamRequest(ctx)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "SendMessage"))
+		ctx.Error(err)
+		return nil
+	}
+
+	body, err := io.ReadAll(ctx.Request().Body)
+	if err != nil {
+		err = resterror.NewBadRequestError(err.Error())
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "SendMessage"))
+		ctx.Error(err)
+		return nil
+	}
+
+	var reply *entities.Envelope
+	envelope, err := handler.handleChatFrame(ctx.Request().Context(), request, body, func(envelope entities.Envelope) {
+		reply = &envelope
+	})
+	if err != nil {
+		if protocolErr, ok := err.(exceptions.ProtocolException); ok {
+			if protocolErr.Code() == exceptions.DeliveryFailedCode {
+				err = resterror.NewInternalServerError(err.Error(), err)
+			} else {
+				err = resterror.NewBadRequestError(err.Error())
+			}
+		}
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "SendMessage"))
+		ctx.Error(err)
+		return nil
+	}
+
+	if reply != nil {
+		return ctx.JSON(http.StatusOK, reply)
+	}
+
+	return ctx.JSON(http.StatusAccepted, envelope)
+}
+
+// handleChatFrame validates a frame sent by a user, routes commands to the bots and delivers and stores
+// regular messages. Protocol errors are meant for the sender, including the delivery_failed one telling the
+// message was neither delivered nor stored. Any other error means the message was lost.
+// Frames answering the sender only, like the /help listing, are passed to reply.
+func (handler *sessionHandler) handleChatFrame(ctx context.Context, request entities.SessionChatRequest, msg []byte, reply func(entities.Envelope)) (entities.Envelope, error) {
+	envelope, chatMessage, err := handler.decodeChatFrame(msg, request)
+	if err != nil {
+		return envelope, err
+	}
+
+	if command, ok := entities.ParseCommand(chatMessage.Content); ok {
+		return envelope, handler.routeCommand(ctx, request, envelope.ID, command, reply)
+	}
+
+	err = handler.publish(ctx, envelope)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "handleChatFrame"))
+		return envelope, exceptions.NewProtocolException(exceptions.DeliveryFailedCode,
+			"message could not be delivered, send it again")
+	}
+
+	err = handler.service.SaveMessage(ctx, chatMessage, request.RoomID)
+	if err != nil {
+		return envelope, err
+	}
+
+	return envelope, nil
+}
+
+// routeCommand answers /help and sends any other command to the bot handling it in the room, no other socket
+// gets it. Bots connected to the room socket get a bot_command frame, bots registered through the API get the
+// command on their commands topic. Unknown commands and invalid arguments are returned as errors for the sender.
+// commandID is the ID of the frame holding the command, the timeout error replies to it.
+func (handler *sessionHandler) routeCommand(ctx context.Context, request entities.SessionChatRequest, commandID string, command entities.Command, reply func(entities.Envelope)) error {
+	roomID := request.RoomID
+	if command.Name == entities.HelpCommand {
+		helpPayload := handler.commands.help(roomID, handler.roomCommands(ctx, roomID))
+		help, err := entities.NewEnvelope(entities.CommandHelpFrameType, roomID, helpPayload)
+		if err != nil {
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "routeCommand"))
+			return nil
+		}
+		reply(help)
+		return nil
+	}
+
+	if registered, ok := handler.commands.lookup(roomID, command.Name); ok {
+		if err := registered.definition.ValidateArgs(command.Args); err != nil {
+			return err
+		}
+
+		commandRequest := entities.NewCommandRequest(roomID, request.SessionUser, registered.botName, command)
+		handler.awaitReply(commandRequest, commandID)
+		handler.sendToSocket(commandRequest, registered.socket)
+		return nil
+	}
+
+	for _, roomCommand := range handler.roomCommands(ctx, roomID) {
+		if roomCommand.Definition.Name != command.Name {
+			continue
+		}
+
+		if err := roomCommand.Definition.ValidateArgs(command.Args); err != nil {
+			return err
+		}
+
+		commandRequest := entities.NewCommandRequest(roomID, request.SessionUser, roomCommand.BotName, command)
+		handler.awaitReply(commandRequest, commandID)
+		if err := handler.bots.SendCommand(ctx, commandRequest); err != nil {
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "routeCommand"))
+		}
+		return nil
+	}
+
+	return exceptions.NewProtocolException(exceptions.UnknownCommandCode,
+		fmt.Sprintf("unknown command '%s', type /help to list the room commands", command.Name))
+}
+
+// awaitReply tracks the command until its bot replies, the user is told when it doesn't within
+// SESSION_COMMAND_TIMEOUT.
+func (handler *sessionHandler) awaitReply(request entities.CommandRequest, commandID string) {
+	handler.pending.add(request.CorrelationID, handler.config.Session.CommandTimeout, func() {
+		handler.timeOut(request, commandID)
+	})
+}
+
+// timeOut resolves the command with its timeout and sends the requesting user a bot_timeout error, on the sockets
+// they hold on every instance, unless the bot replied in the meantime, possibly through another instance. The
+// error isn't a room event: it gets no sequence number and isn't replayed.
+func (handler *sessionHandler) timeOut(request entities.CommandRequest, commandID string) {
+	ctx := context.Background()
+	resolved, err := handler.service.ResolveCommand(ctx, request.CorrelationID, entities.TimedOutResolution)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "timeOut"))
+	} else if !resolved {
+		return
+	}
+
+	timeout := entities.NewErrorEnvelope(request.RoomID, commandID, exceptions.NewProtocolException(
+		exceptions.BotTimeoutCode, fmt.Sprintf("bot '%s' did not respond to /%s", request.Bot, request.Command)))
+	err = handler.websocket.SendMessageToUser(timeout.ToBytes(), request.RoomID, request.UserID)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "timeOut"))
+	}
+}
+
+// sendToSocket sends the command to a bot connected to the room socket as a bot_command frame.
+func (handler *sessionHandler) sendToSocket(request entities.CommandRequest, socket *ws.Client) {
+	botMessage := entities.BotMessage{
+		CorrelationID: request.CorrelationID,
+		RoomID:        request.RoomID,
+		UserID:        request.UserID,
+		Command:       request.Command,
+		Args:          request.Args,
+	}
+	if len(request.Args) > 0 {
+		botMessage.Value = request.Args[0]
+	}
+
+	botCommand, err := entities.NewEnvelope(entities.BotCommandFrameType, request.RoomID, botMessage)
+	if err == nil {
+		err = handler.websocket.SendMessageToSocket(botCommand.ToBytes(), socket)
+	}
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "sendToSocket"))
+	}
+}
+
+// roomCommands lists the commands the bots enabled in the room get through the broker, none when they can't
+// be loaded.
+func (handler *sessionHandler) roomCommands(ctx context.Context, roomID string) []entities.RoomCommand {
+	commands, err := handler.bots.RoomCommands(ctx, roomID)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "roomCommands"))
+	}
+
+	return commands
+}
+
+// replyTo sends the frames answering the sender back to its socket.
+func (handler *sessionHandler) replyTo(socket *ws.Client) func(entities.Envelope) {
+	return func(envelope entities.Envelope) {
+		if err := handler.websocket.SendMessageToSocket(envelope.ToBytes(), socket); err != nil {
+			handler.logs.Error(str.ErrorConcat(err, handlerName, "replyTo"))
+		}
+	}
+}
+
+// subscribe registers a socketless client for the room, replaying the events missed since lastSeq first.
+func (handler *sessionHandler) subscribe(ctx context.Context, request entities.SessionChatRequest, lastSeq int64, resuming bool) *ws.Client {
+	if !resuming {
+		return handler.websocket.Subscribe(request.RoomID, request.UserID)
+	}
+
+	client := handler.websocket.Subscribe(request.RoomID, request.UserID, ws.WithHeldDelivery())
+	go handler.resume(ctx, client, request.RoomID, lastSeq)
+	return client
+}
+
+func bindStreamRequest(ctx echo.Context) (entities.SessionChatRequest, int64, bool, error) {
+	var request entities.SessionChatRequest
+	if err := (&echo.DefaultBinder{}).BindQueryParams(ctx, &request); err != nil {
+		return request, 0, false, resterror.NewBadRequestError(err.Error())
+	}
+
+	request.RoomID = ctx.Param("room_id")
+	if str.IsEmpty(request.RoomID) || str.IsEmpty(request.UserID) {
+		return request, 0, false, resterror.NewBadRequestError("room_id and user_id are required")
+	}
+
+	if str.IsEmpty(ctx.QueryParam("last_seq")) && !str.IsEmpty(ctx.Request().Header.Get("Last-Event-ID")) {
+		ctx.QueryParams().Set("last_seq", ctx.Request().Header.Get("Last-Event-ID"))
+	}
+
+	lastSeq, resuming, err := parseLastSeq(ctx)
+	return request, lastSeq, resuming, err
+}
+
+func writeStreamEvent(response *echo.Response, frame []byte) error {
+	var envelope entities.Envelope
+	if err := json.Unmarshal(frame, &envelope); err == nil && envelope.Seq > 0 {
+		if _, err = fmt.Fprintf(response, "id: %d\n", envelope.Seq); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(response, "data: %s\n\n", frame); err != nil {
+		return err
+	}
+
+	response.Flush()
+	return nil
+}
+
+// decodeChatFrame turns an inbound frame into a chat message authored by the connected user. Only
+// chat_message frames may be sent by clients, the remaining types are emitted by the server.
+func (handler *sessionHandler) decodeChatFrame(msg []byte, request entities.SessionChatRequest) (entities.Envelope, entities.ChatMessage, error) {
+	var chatMessage entities.ChatMessage
+	envelope, err := entities.DecodeEnvelope(msg, request.RoomID)
+	if err != nil {
+		return envelope, chatMessage, err
+	}
+
+	if envelope.Type != entities.ChatMessageFrameType {
+		err = exceptions.NewProtocolException(exceptions.UnknownTypeCode,
+			fmt.Sprintf("frame type '%s' cannot be sent by clients", envelope.Type))
+		return envelope, chatMessage, err
+	}
+
+	if err = envelope.DecodePayload(&chatMessage); err != nil {
+		return envelope, chatMessage, err
+	}
+
+	chatMessage.SessionUser = request.SessionUser
+	if chatMessage.CreatedAt.IsZero() {
+		chatMessage.CreatedAt = envelope.Timestamp
+	}
+
+	if err = chatMessage.Validate(); err != nil {
+		return envelope, chatMessage, err
+	}
+
+	envelope.Payload, err = json.Marshal(chatMessage)
+	return envelope, chatMessage, err
+}
+
+func (handler *sessionHandler) broadcast(ctx context.Context, frameType, roomID string, payload interface{}) error {
+	envelope, err := entities.NewEnvelope(frameType, roomID, payload)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "broadcast"))
+		return err
+	}
+
+	return handler.publish(ctx, envelope)
+}
+
+// publish sequences the room event and broadcasts it.
+func (handler *sessionHandler) publish(ctx context.Context, envelope entities.Envelope) error {
+	envelope = handler.sequence(ctx, envelope)
+	return handler.websocket.BroadCastMessage(envelope.ToBytes(), envelope.RoomID)
+}
+
+// sequence stores the room event for replay and numbers it. When the session store is unavailable the event is
+// returned as is, it is still delivered live, without a sequence number, since it cannot be replayed anyway.
+func (handler *sessionHandler) sequence(ctx context.Context, envelope entities.Envelope) entities.Envelope {
+	sequenced, err := handler.service.PublishEvent(ctx, envelope)
+	if err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "sequence"))
+		return envelope
+	}
+
+	return sequenced
+}
+
+// resume replays the events missed since lastSeq before the socket switches to live delivery. When the gap
+// can't be replayed the client gets a resync frame and must reload the room history.
+func (handler *sessionHandler) resume(ctx context.Context, socket *ws.Client, roomID string, lastSeq int64) {
+	replay, err := handler.service.GetEventsSince(ctx, roomID, lastSeq)
+	frames := replay.Frames
+	if err != nil || !replay.Complete {
+		resync, _ := entities.NewEnvelope(entities.ResyncFrameType, roomID, entities.ResyncPayload{LastSeq: replay.LastSeq})
+		frames = [][]byte{resync.ToBytes()}
+	}
+
+	if err = handler.websocket.Resume(socket, frames); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "resume"))
+	}
+}
+
+func parseLastSeq(ctx echo.Context) (int64, bool, error) {
+	lastSeqParam := ctx.QueryParam("last_seq")
+	if str.IsEmpty(lastSeqParam) {
+		return 0, false, nil
+	}
+
+	lastSeq, err := strconv.ParseInt(lastSeqParam, 10, 64)
+	if err != nil || lastSeq < 0 {
+		return 0, false, resterror.NewBadRequestError(fmt.Sprintf("invalid last_seq '%s'", lastSeqParam))
+	}
+
+	return lastSeq, true, nil
+}
+
+func (handler *sessionHandler) sendError(socket *ws.Client, roomID, replyTo string, err error) {
+	errorEnvelope := entities.NewErrorEnvelope(roomID, replyTo, err)
+	if err = handler.websocket.SendMessageToSocket(errorEnvelope.ToBytes(), socket); err != nil {
+		handler.logs.Error(str.ErrorConcat(err, handlerName, "sendError"))
+	}
+}
+
+func (handler *sessionHandler) readMessages(socket *ws.Client, messageChan chan []byte) {
+	defer close(messageChan)
 	for {
 		if socket != nil {
 			msgType, msg, err := socket.ReadMessage()
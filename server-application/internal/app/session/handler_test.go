@@ -0,0 +1,827 @@
+package session_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/sebastianreh/chatroom/cmd/httpserver"
+	"github.com/sebastianreh/chatroom/internal/app/session"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/container"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/sebastianreh/chatroom/pkg/broker"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	ws "github.com/sebastianreh/chatroom/pkg/websocket"
+	"github.com/sebastianreh/chatroom/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setup(method, target string, body *strings.Reader) (echo.Context, *httptest.ResponseRecorder) {
+	mockServer := httpserver.NewServer(container.Dependencies{})
+
+	request := httptest.NewRequest(method, target, body)
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	mockServer.Server.HTTPErrorHandler = httpserver.HTTPErrorHandler
+	ctx := mockServer.NewServerContext(request, w)
+
+	return ctx, w
+}
+
+func setRoomParam(ctx echo.Context, path, roomID string) {
+	ctx.SetPath(path)
+	ctx.SetParamNames("room_id")
+	ctx.SetParamValues(roomID)
+}
+
+func Test_SessionHandler_Poll(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	configs.Session.LongPollTimeout = 200 * time.Millisecond
+
+	t.Run("missed events are returned right away", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		frames := [][]byte{
+			[]byte(`{"type":"chat_message","seq":2}`),
+			[]byte(`{"type":"chat_message","seq":3}`),
+		}
+
+		context, recorder := setup(http.MethodGet, "/poll/room1?user_id=id123&username=User1&last_seq=1", strings.NewReader(""))
+		setRoomParam(context, "/poll/:room_id", "room1")
+		serviceMock.On("GetEventsSince", mock.Anything, "room1", int64(1)).
+			Return(entities.EventReplay{Frames: frames, LastSeq: 3, Complete: true}, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.Poll(context)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		var received []json.RawMessage
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &received))
+		assert.GreaterOrEqual(t, len(received), 1)
+		assert.JSONEq(t, string(frames[0]), string(received[0]))
+	})
+
+	t.Run("live event is returned when it arrives", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		context, recorder := setup(http.MethodGet, "/poll/room1?user_id=id123&username=User1", strings.NewReader(""))
+		setRoomParam(context, "/poll/:room_id", "room1")
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = hub.BroadCastMessage([]byte(`{"type":"chat_message","seq":4}`), "room1")
+		}()
+
+		err := handler.Poll(context)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[{"type":"chat_message","seq":4}]`, recorder.Body.String())
+	})
+
+	t.Run("empty list after the poll timeout", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		context, recorder := setup(http.MethodGet, "/poll/room1?user_id=id123&username=User1", strings.NewReader(""))
+		setRoomParam(context, "/poll/:room_id", "room1")
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.Poll(context)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[]`, recorder.Body.String())
+	})
+
+	t.Run("missing user id", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		context, recorder := setup(http.MethodGet, "/poll/room1", strings.NewReader(""))
+		setRoomParam(context, "/poll/:room_id", "room1")
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.Poll(context)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
+
+// failingHub is a hub whose broadcasts fail, like a cluster hub that can't reach the other instances.
+type failingHub struct {
+	ws.Websocket
+}
+
+func (failingHub) BroadCastMessage([]byte, string) error {
+	return errors.New("cluster bus unavailable")
+}
+
+// relayFailingHub delivers the broadcasts locally but fails to relay them to the cluster until relayFailures
+// relays were attempted.
+type relayFailingHub struct {
+	ws.Websocket
+	relayFailures int
+	relays        int
+}
+
+func (h *relayFailingHub) BroadCastMessage(message []byte, groupID string) error {
+	if err := h.Websocket.BroadCastMessage(message, groupID); err != nil {
+		return err
+	}
+
+	if err := h.Relay(message, groupID); err != nil {
+		return ws.RelayError{Err: err}
+	}
+	return nil
+}
+
+func (h *relayFailingHub) Relay([]byte, string) error {
+	h.relays++
+	if h.relays <= h.relayFailures {
+		return errors.New("cluster bus unavailable")
+	}
+	return nil
+}
+
+func Test_SessionHandler_SendMessage(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("message is delivered and stored", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		subscriber := hub.Subscribe("room1", "id456")
+		body := `{"type":"chat_message","version":1,"payload":{"content":"hello"}}`
+
+		context, recorder := setup(http.MethodPost, "/messages/room1?user_id=id123&username=User1", strings.NewReader(body))
+		setRoomParam(context, "/messages/:room_id", "room1")
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).Return(func(envelope entities.Envelope) entities.Envelope {
+			envelope.Seq = 1
+			return envelope
+		}, nil)
+		serviceMock.On("SaveMessage", mock.Anything, mock.MatchedBy(func(message entities.ChatMessage) bool {
+			return message.Content == "hello" && message.UserID == "id123" && message.Username == "User1"
+		}), "room1").Return(nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.SendMessage(context)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, recorder.Code)
+		serviceMock.AssertExpectations(t)
+		select {
+		case frame := <-subscriber.Messages():
+			var envelope entities.Envelope
+			assert.NoError(t, json.Unmarshal(frame, &envelope))
+			assert.Equal(t, int64(1), envelope.Seq)
+		case <-time.After(time.Second):
+			t.Fatal("message was not delivered")
+		}
+	})
+
+	t.Run("message that can't be delivered is reported and not stored", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := failingHub{Websocket: ws.NewWebsocket(configs, logs)}
+		body := `{"type":"chat_message","version":1,"payload":{"content":"hello"}}`
+
+		context, recorder := setup(http.MethodPost, "/messages/room1?user_id=id123&username=User1", strings.NewReader(body))
+		setRoomParam(context, "/messages/:room_id", "room1")
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).Return(func(envelope entities.Envelope) entities.Envelope {
+			return envelope
+		}, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.SendMessage(context)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		serviceMock.AssertNotCalled(t, "SaveMessage", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid frame is rejected", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		body := `{"type":"chat_message","version":1,"payload":{"content":""}}`
+
+		context, recorder := setup(http.MethodPost, "/messages/room1?user_id=id123&username=User1", strings.NewReader(body))
+		setRoomParam(context, "/messages/:room_id", "room1")
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		err := handler.SendMessage(context)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		serviceMock.AssertNotCalled(t, "SaveMessage", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_SessionHandler_HandleConnection(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	dialConnection := func(t *testing.T, handler session.SessionHandler) (*gorilla.Conn, func()) {
+		server := echo.New()
+		server.GET("/connect", handler.HandleConnection)
+		httpServer := httptest.NewServer(server)
+		url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/connect?user_id=id123&username=User1"
+		conn, _, err := gorilla.DefaultDialer.Dial(url, nil)
+		assert.NoError(t, err)
+		return conn, func() {
+			_ = conn.Close()
+			httpServer.Close()
+		}
+	}
+
+	send := func(t *testing.T, conn *gorilla.Conn, frameType, roomID string, payload interface{}) entities.Envelope {
+		envelope, err := entities.NewEnvelope(frameType, roomID, payload)
+		assert.NoError(t, err)
+		assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, envelope.ToBytes()))
+		return envelope
+	}
+
+	read := func(t *testing.T, conn *gorilla.Conn) entities.Envelope {
+		var envelope entities.Envelope
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(message, &envelope))
+		return envelope
+	}
+
+	t.Run("subscribed rooms are delivered over one connection", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).Return(func(envelope entities.Envelope) entities.Envelope {
+			return envelope
+		}, nil).Maybe()
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+		conn, closeConn := dialConnection(t, handler)
+		defer closeConn()
+
+		for _, roomID := range []string{"room1", "room2"} {
+			subscribe := send(t, conn, entities.SubscribeFrameType, roomID, entities.SubscriptionPayload{})
+			ack := read(t, conn)
+			assert.Equal(t, entities.SubscribeFrameType, ack.Type)
+			assert.Equal(t, subscribe.ID, ack.ID)
+		}
+
+		assert.NoError(t, hub.BroadCastMessage([]byte(`{"type":"chat_message","room_id":"room1"}`), "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte(`{"type":"chat_message","room_id":"room2"}`), "room2"))
+		assert.Equal(t, "room1", read(t, conn).RoomID)
+		assert.Equal(t, "room2", read(t, conn).RoomID)
+	})
+
+	t.Run("subscribing with last_seq replays the missed events first", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		missed, _ := entities.NewEnvelope(entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: "missed"})
+		missed.Seq = 5
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).Return(func(envelope entities.Envelope) entities.Envelope {
+			return envelope
+		}, nil).Maybe()
+		serviceMock.On("GetEventsSince", mock.Anything, "room1", int64(4)).
+			Return(entities.EventReplay{Frames: [][]byte{missed.ToBytes()}, LastSeq: 5, Complete: true}, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+		conn, closeConn := dialConnection(t, handler)
+		defer closeConn()
+
+		lastSeq := int64(4)
+		send(t, conn, entities.SubscribeFrameType, "room1", entities.SubscriptionPayload{LastSeq: &lastSeq})
+
+		assert.Equal(t, entities.SubscribeFrameType, read(t, conn).Type)
+		assert.Equal(t, int64(5), read(t, conn).Seq)
+	})
+
+	t.Run("chat frames are routed by room and rejected for unsubscribed rooms", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).Return(func(envelope entities.Envelope) entities.Envelope {
+			return envelope
+		}, nil)
+		serviceMock.On("SaveMessage", mock.Anything, mock.Anything, "room1").Return(nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+		conn, closeConn := dialConnection(t, handler)
+		defer closeConn()
+
+		send(t, conn, entities.SubscribeFrameType, "room1", entities.SubscriptionPayload{})
+		read(t, conn)
+
+		rejected := send(t, conn, entities.ChatMessageFrameType, "room2", entities.ChatMessage{Content: "hello"})
+		errorFrame := read(t, conn)
+		var errorPayload entities.ErrorPayload
+		assert.NoError(t, errorFrame.DecodePayload(&errorPayload))
+		assert.Equal(t, entities.ErrorFrameType, errorFrame.Type)
+		assert.Equal(t, exceptions.NotSubscribedCode, errorPayload.Code)
+		assert.Equal(t, rejected.ID, errorPayload.ReplyTo)
+
+		send(t, conn, entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: "hello"})
+		delivered := read(t, conn)
+		var chatMessage entities.ChatMessage
+		assert.NoError(t, delivered.DecodePayload(&chatMessage))
+		assert.Equal(t, "room1", delivered.RoomID)
+		assert.Equal(t, "id123", chatMessage.UserID)
+		assert.Equal(t, "hello", chatMessage.Content)
+	})
+
+	t.Run("unsubscribing from a room not followed is rejected", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+		conn, closeConn := dialConnection(t, handler)
+		defer closeConn()
+
+		send(t, conn, entities.UnsubscribeFrameType, "room1", entities.SubscriptionPayload{})
+		errorFrame := read(t, conn)
+		var errorPayload entities.ErrorPayload
+		assert.NoError(t, errorFrame.DecodePayload(&errorPayload))
+		assert.Equal(t, exceptions.NotSubscribedCode, errorPayload.Code)
+	})
+}
+
+func Test_SessionHandler_ReadStockMessage(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	configs.Kafka.DeadLetter.RetryBackoff = time.Millisecond
+
+	t.Run("bot message is delivered to its room", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope { return envelope }, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"room_id":"room1","message":"AAPL.US quote is $93.42 per share"}`))
+
+		serviceMock.AssertNumberOfCalls(t, "PublishEvent", 1)
+		deadLettersMock.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	})
+
+	t.Run("failed relay is retried without delivering the message twice", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := &relayFailingHub{Websocket: ws.NewWebsocket(configs, logs), relayFailures: 2}
+		subscriber := hub.Subscribe("room1", "id456")
+
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope {
+				envelope.Seq = 7
+				return envelope
+			}, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"room_id":"room1","message":"AAPL.US quote is $93.42 per share"}`))
+
+		assert.Equal(t, 3, hub.relays)
+		serviceMock.AssertNumberOfCalls(t, "PublishEvent", 1)
+		deadLettersMock.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+		assert.Len(t, subscriber.Messages(), 1)
+	})
+
+	t.Run("message delivered locally is not dead-lettered when its relay keeps failing", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := &relayFailingHub{Websocket: ws.NewWebsocket(configs, logs), relayFailures: configs.Kafka.DeadLetter.MaxAttempts}
+		subscriber := hub.Subscribe("room1", "id456")
+
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope { return envelope }, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"room_id":"room1","message":"AAPL.US quote is $93.42 per share"}`))
+
+		assert.Equal(t, configs.Kafka.DeadLetter.MaxAttempts, hub.relays)
+		deadLettersMock.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+		assert.Len(t, subscriber.Messages(), 1)
+	})
+
+	t.Run("malformed bot message is dead-lettered without retries", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		message := `{"room_id":`
+
+		deadLettersMock.On("Save", mock.Anything, mock.MatchedBy(func(deadLetter entities.DeadLetter) bool {
+			return deadLetter.Topic == configs.Kafka.StocksTopic && deadLetter.Payload == message &&
+				deadLetter.Attempts == 1 && deadLetter.Error != ""
+		})).Return(nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(message))
+
+		deadLettersMock.AssertExpectations(t)
+		serviceMock.AssertNotCalled(t, "PublishEvent", mock.Anything, mock.Anything)
+	})
+
+	t.Run("reply resolves its command once delivered", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		serviceMock.On("AcceptReply", mock.Anything, "corr1").Return(true, nil)
+		serviceMock.On("ResolveCommand", mock.Anything, "corr1", entities.RepliedResolution).Return(true, nil)
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope { return envelope }, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"correlation_id":"corr1","room_id":"room1","bot_message":"AAPL.US quote is $93.42 per share"}`))
+
+		serviceMock.AssertNumberOfCalls(t, "PublishEvent", 1)
+		serviceMock.AssertExpectations(t)
+	})
+
+	t.Run("reply to a command already resolved is dropped", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+
+		serviceMock.On("AcceptReply", mock.Anything, "corr1").Return(false, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"correlation_id":"corr1","room_id":"room1","bot_message":"AAPL.US quote is $93.42 per share"}`))
+
+		serviceMock.AssertNotCalled(t, "PublishEvent", mock.Anything, mock.Anything)
+		serviceMock.AssertNotCalled(t, "ResolveCommand", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("delivery fails after a correlated reply", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := failingHub{Websocket: ws.NewWebsocket(configs, logs)}
+		message := `{"correlation_id":"corr1","room_id":"room1","bot_message":"AAPL.US quote is $93.42 per share"}`
+
+		serviceMock.On("AcceptReply", mock.Anything, "corr1").Return(true, nil)
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope { return envelope }, nil)
+		serviceMock.On("DeadLetterReply", mock.Anything, "corr1").Return(nil)
+		deadLettersMock.On("Save", mock.Anything, mock.MatchedBy(func(deadLetter entities.DeadLetter) bool {
+			return deadLetter.Payload == message
+		})).Return(nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(message))
+
+		deadLettersMock.AssertExpectations(t)
+		serviceMock.AssertExpectations(t)
+		serviceMock.AssertNotCalled(t, "ResolveCommand", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("replay of a correlated dead letter", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		deadLettersMock := mocks.NewDeadLetterServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		subscriber := hub.Subscribe("room1", "id456")
+
+		serviceMock.On("AcceptReply", mock.Anything, "corr1").Return(true, nil)
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope { return envelope }, nil)
+		serviceMock.On("ResolveCommand", mock.Anything, "corr1", entities.RepliedResolution).Return(false, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, deadLettersMock, nil, hub, nil, logs)
+
+		handler.ReadStockMessage([]byte(`{"correlation_id":"corr1","room_id":"room1","bot_message":"AAPL.US quote is $93.42 per share"}`))
+
+		assert.Len(t, subscriber.Messages(), 1)
+		deadLettersMock.AssertNotCalled(t, "Save", mock.Anything, mock.Anything)
+	})
+}
+
+func Test_SessionHandler_Listen(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("bot message published on the broker reaches the room", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		memory := broker.NewMemoryBroker(1)
+		subscriber, _ := memory.Subscriber(configs.Kafka.StocksTopic)
+		published := make(chan entities.Envelope, 1)
+
+		serviceMock.On("PublishEvent", mock.Anything, mock.Anything).
+			Return(func(envelope entities.Envelope) entities.Envelope {
+				published <- envelope
+				return envelope
+			}, nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, nil, hub, subscriber, logs)
+		go handler.Listen()
+
+		err := memory.Publish(context.TODO(), configs.Kafka.StocksTopic,
+			[]byte(`{"room_id":"room1","message":"AAPL.US quote is $93.42 per share"}`), nil)
+
+		assert.NoError(t, err)
+		select {
+		case envelope := <-published:
+			assert.Equal(t, entities.BotMessageFrameType, envelope.Type)
+			assert.Equal(t, "room1", envelope.RoomID)
+		case <-time.After(time.Second):
+			t.Fatal("bot message was not delivered")
+		}
+		assert.NoError(t, subscriber.Close(context.TODO()))
+	})
+}
+
+func Test_SessionHandler_Commands(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	configs.Session.CommandTimeout = time.Hour
+
+	newBotsMock := func(scopes ...string) *mocks.BotServiceMock {
+		botsMock := mocks.NewBotServiceMock()
+		for _, botName := range []string{"stock", "quotes"} {
+			botsMock.On("Authenticate", mock.Anything, botName, "secret", "room1").
+				Return(entities.Bot{Name: botName, Scopes: scopes, IsActive: true}, nil)
+		}
+		botsMock.On("RoomCommands", mock.Anything, "room1").Return([]entities.RoomCommand{}, nil).Maybe()
+		return botsMock
+	}
+
+	dial := func(t *testing.T, handler session.SessionHandler, target string) (*gorilla.Conn, func()) {
+		server := echo.New()
+		server.GET("/chat", handler.HandleChatConnection)
+		server.GET("/bot", handler.HandleBotConnection)
+		httpServer := httptest.NewServer(server)
+		header := http.Header{echo.HeaderAuthorization: []string{"Bearer secret"}}
+		conn, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+target, header)
+		assert.NoError(t, err)
+		return conn, func() {
+			_ = conn.Close()
+			httpServer.Close()
+		}
+	}
+
+	read := func(t *testing.T, conn *gorilla.Conn) entities.Envelope {
+		var envelope entities.Envelope
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(message, &envelope))
+		return envelope
+	}
+
+	sendCommand := func(t *testing.T, conn *gorilla.Conn, content string) {
+		envelope, _ := entities.NewEnvelope(entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: content})
+		assert.NoError(t, conn.WriteMessage(gorilla.TextMessage, envelope.ToBytes()))
+	}
+
+	readError := func(t *testing.T, conn *gorilla.Conn) entities.ErrorPayload {
+		errorFrame := read(t, conn)
+		var errorPayload entities.ErrorPayload
+		assert.Equal(t, entities.ErrorFrameType, errorFrame.Type)
+		assert.NoError(t, errorFrame.DecodePayload(&errorPayload))
+		return errorPayload
+	}
+
+	setup := func(t *testing.T) (*gorilla.Conn, *gorilla.Conn, func()) {
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		hub := ws.NewWebsocket(configs, logs)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, newBotsMock(entities.CommandsScope), hub, nil, logs)
+
+		bot, closeBot := dial(t, handler, "/bot?bot_name=stock&room_id=room1")
+		registration, _ := entities.NewEnvelope(entities.CommandRegistrationFrameType, "room1", entities.CommandRegistration{
+			Commands: []entities.CommandDefinition{{
+				Name: "stock",
+				Args: []entities.CommandArgument{{Name: "code", Pattern: `[\w.]+`}},
+				Help: "Gets the quote of a stock",
+			}},
+		})
+		assert.NoError(t, bot.WriteMessage(gorilla.TextMessage, registration.ToBytes()))
+		assert.Equal(t, entities.CommandRegistrationFrameType, read(t, bot).Type)
+
+		user, closeUser := dial(t, handler, "/chat?room_id=room1&user_id=id123&username=User1")
+		return bot, user, func() {
+			closeUser()
+			closeBot()
+		}
+	}
+
+	t.Run("command is routed to the bot owning it only", func(t *testing.T) {
+		bot, user, closeConns := setup(t)
+		defer closeConns()
+
+		sendCommand(t, user, "/stock aapl.us")
+
+		botCommand := read(t, bot)
+		var botMessage entities.BotMessage
+		assert.Equal(t, entities.BotCommandFrameType, botCommand.Type)
+		assert.NoError(t, botCommand.DecodePayload(&botMessage))
+		assert.NotEmpty(t, botMessage.CorrelationID)
+		botMessage.CorrelationID = ""
+		assert.Equal(t, entities.BotMessage{RoomID: "room1", UserID: "id123", Command: "stock", Value: "aapl.us",
+			Args: []string{"aapl.us"}}, botMessage)
+		_ = user.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := user.ReadMessage()
+		assert.Error(t, err)
+	})
+
+	t.Run("help lists the room commands to the sender", func(t *testing.T) {
+		_, user, closeConns := setup(t)
+		defer closeConns()
+
+		sendCommand(t, user, "/help")
+
+		help := read(t, user)
+		var helpPayload entities.CommandHelpPayload
+		assert.Equal(t, entities.CommandHelpFrameType, help.Type)
+		assert.NoError(t, help.DecodePayload(&helpPayload))
+		assert.Equal(t, []entities.CommandHelp{
+			{Name: "help", Usage: "/help", Help: "Lists the commands available in the room"},
+			{Name: "stock", Usage: "/stock <code>", Help: "Gets the quote of a stock", Bot: "stock"},
+		}, helpPayload.Commands)
+	})
+
+	t.Run("usage errors are returned to the sender", func(t *testing.T) {
+		_, user, closeConns := setup(t)
+		defer closeConns()
+
+		sendCommand(t, user, "/stock")
+		invalid := readError(t, user)
+		sendCommand(t, user, "/weather london")
+		unknown := readError(t, user)
+
+		assert.Equal(t, exceptions.InvalidCommandCode, invalid.Code)
+		assert.Equal(t, "expected 1 argument, usage: /stock <code>", invalid.Message)
+		assert.Equal(t, exceptions.UnknownCommandCode, unknown.Code)
+	})
+
+	t.Run("command owned by another bot is not registered", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		hub := ws.NewWebsocket(configs, logs)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, newBotsMock(entities.CommandsScope), hub, nil, logs)
+		registration, _ := entities.NewEnvelope(entities.CommandRegistrationFrameType, "room1", entities.CommandRegistration{
+			Commands: []entities.CommandDefinition{{Name: "stock"}},
+		})
+
+		first, closeFirst := dial(t, handler, "/bot?bot_name=stock&room_id=room1")
+		defer closeFirst()
+		assert.NoError(t, first.WriteMessage(gorilla.TextMessage, registration.ToBytes()))
+		read(t, first)
+		second, closeSecond := dial(t, handler, "/bot?bot_name=quotes&room_id=room1")
+		defer closeSecond()
+		assert.NoError(t, second.WriteMessage(gorilla.TextMessage, registration.ToBytes()))
+
+		assert.Equal(t, exceptions.InvalidPayloadCode, readError(t, second).Code)
+	})
+	t.Run("bot without the commands scope can't register commands", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		hub := ws.NewWebsocket(configs, logs)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, newBotsMock(), hub, nil, logs)
+		registration, _ := entities.NewEnvelope(entities.CommandRegistrationFrameType, "room1", entities.CommandRegistration{
+			Commands: []entities.CommandDefinition{{Name: "stock"}},
+		})
+
+		bot, closeBot := dial(t, handler, "/bot?bot_name=stock&room_id=room1")
+		defer closeBot()
+		assert.NoError(t, bot.WriteMessage(gorilla.TextMessage, registration.ToBytes()))
+
+		assert.Equal(t, exceptions.UnauthorizedCode, readError(t, bot).Code)
+	})
+
+	t.Run("commands can't be registered over the socket on a cluster", func(t *testing.T) {
+		clusterConfigs := configs
+		clusterConfigs.Cluster.Enabled = true
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		hub := ws.NewWebsocket(clusterConfigs, logs)
+		handler := session.NewSessionHandler(clusterConfigs, serviceMock, nil, newBotsMock(entities.CommandsScope), hub,
+			nil, logs)
+		registration, _ := entities.NewEnvelope(entities.CommandRegistrationFrameType, "room1", entities.CommandRegistration{
+			Commands: []entities.CommandDefinition{{Name: "stock"}},
+		})
+
+		bot, closeBot := dial(t, handler, "/bot?bot_name=stock&room_id=room1")
+		defer closeBot()
+		assert.NoError(t, bot.WriteMessage(gorilla.TextMessage, registration.ToBytes()))
+
+		assert.Equal(t, exceptions.ClusterUnsupportedCode, readError(t, bot).Code)
+	})
+
+	t.Run("bot with an invalid api key is rejected", func(t *testing.T) {
+		botsMock := mocks.NewBotServiceMock()
+		botsMock.On("Authenticate", mock.Anything, "stock", "wrong", "room1").
+			Return(entities.Bot{}, exceptions.NewUnauthorizedException("invalid credentials for bot 'stock'"))
+		server := echo.New()
+		server.HTTPErrorHandler = httpserver.HTTPErrorHandler
+		handler := session.NewSessionHandler(configs, mocks.NewSessionServiceMock(), nil, botsMock,
+			ws.NewWebsocket(configs, logs), nil, logs)
+		server.GET("/bot", handler.HandleBotConnection)
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		header := http.Header{echo.HeaderAuthorization: []string{"Bearer wrong"}}
+		_, response, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+
+			"/bot?bot_name=stock&room_id=room1", header)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+	t.Run("command of a bot registered through the api is published on its commands topic", func(t *testing.T) {
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		botsMock := mocks.NewBotServiceMock()
+		botsMock.On("RoomCommands", mock.Anything, "room1").Return([]entities.RoomCommand{{
+			Definition: entities.CommandDefinition{Name: "quote", Args: []entities.CommandArgument{{Name: "code"}}},
+			BotName:    "quotes",
+		}}, nil)
+		sent := make(chan entities.CommandRequest, 1)
+		botsMock.On("SendCommand", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			sent <- args.Get(1).(entities.CommandRequest)
+		}).Return(nil)
+		handler := session.NewSessionHandler(configs, serviceMock, nil, botsMock, ws.NewWebsocket(configs, logs), nil, logs)
+		user, closeUser := dial(t, handler, "/chat?room_id=room1&user_id=id123&username=User1")
+		defer closeUser()
+
+		sendCommand(t, user, "/quote aapl.us")
+		sendCommand(t, user, "/quote")
+
+		select {
+		case request := <-sent:
+			assert.NotEmpty(t, request.CorrelationID)
+			assert.Equal(t, "quotes", request.Bot)
+			assert.Equal(t, "room1", request.RoomID)
+			assert.Equal(t, "id123", request.UserID)
+			assert.Equal(t, "User1", request.Username)
+			assert.Equal(t, "quote", request.Command)
+			assert.Equal(t, []string{"aapl.us"}, request.Args)
+		case <-time.After(time.Second):
+			t.Fatal("command was not sent")
+		}
+		assert.Equal(t, exceptions.InvalidCommandCode, readError(t, user).Code)
+	})
+
+	t.Run("user is told when the bot does not respond in time", func(t *testing.T) {
+		timeoutConfigs := configs
+		timeoutConfigs.Session.CommandTimeout = 50 * time.Millisecond
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		serviceMock.On("ResolveCommand", mock.Anything, mock.Anything, entities.TimedOutResolution).Return(true, nil)
+		botsMock := mocks.NewBotServiceMock()
+		botsMock.On("RoomCommands", mock.Anything, "room1").Return([]entities.RoomCommand{{
+			Definition: entities.CommandDefinition{Name: "quote"},
+			BotName:    "quotes",
+		}}, nil)
+		botsMock.On("SendCommand", mock.Anything, mock.Anything).Return(nil)
+		hub := ws.NewWebsocket(timeoutConfigs, logs)
+		member := hub.Subscribe("room1", "id456")
+		handler := session.NewSessionHandler(timeoutConfigs, serviceMock, nil, botsMock, hub, nil, logs)
+		user, closeUser := dial(t, handler, "/chat?room_id=room1&user_id=id123&username=User1")
+		defer closeUser()
+
+		command, _ := entities.NewEnvelope(entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: "/quote"})
+		assert.NoError(t, user.WriteMessage(gorilla.TextMessage, command.ToBytes()))
+
+		timeout := readError(t, user)
+		assert.Equal(t, entities.ErrorPayload{
+			Code:    exceptions.BotTimeoutCode,
+			Message: "bot 'quotes' did not respond to /quote",
+			ReplyTo: command.ID,
+		}, timeout)
+		serviceMock.AssertNotCalled(t, "PublishEvent", mock.Anything, mock.Anything)
+		assert.Empty(t, member.Messages())
+	})
+
+	t.Run("user is not told about a command the bot replied to through another instance", func(t *testing.T) {
+		timeoutConfigs := configs
+		timeoutConfigs.Session.CommandTimeout = 50 * time.Millisecond
+		serviceMock := mocks.NewSessionServiceMock()
+		serviceMock.On("Exit", mock.Anything, mock.Anything).Return(nil).Maybe()
+		resolved := make(chan struct{})
+		serviceMock.On("ResolveCommand", mock.Anything, mock.Anything, entities.TimedOutResolution).
+			Run(func(args mock.Arguments) { close(resolved) }).Return(false, nil)
+		botsMock := mocks.NewBotServiceMock()
+		botsMock.On("RoomCommands", mock.Anything, "room1").Return([]entities.RoomCommand{{
+			Definition: entities.CommandDefinition{Name: "quote"},
+			BotName:    "quotes",
+		}}, nil)
+		botsMock.On("SendCommand", mock.Anything, mock.Anything).Return(nil)
+		handler := session.NewSessionHandler(timeoutConfigs, serviceMock, nil, botsMock, ws.NewWebsocket(timeoutConfigs, logs),
+			nil, logs)
+		user, closeUser := dial(t, handler, "/chat?room_id=room1&user_id=id123&username=User1")
+		defer closeUser()
+
+		sendCommand(t, user, "/quote")
+
+		select {
+		case <-resolved:
+		case <-time.After(time.Second):
+			t.Fatal("command timeout did not fire")
+		}
+		_ = user.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := user.ReadMessage()
+		assert.Error(t, err)
+	})
+}
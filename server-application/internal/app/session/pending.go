@@ -0,0 +1,44 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// pendingCommands holds the timeout of the commands routed by this instance until their bot replies.
+type pendingCommands struct {
+	mutex  sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func newPendingCommands() *pendingCommands {
+	return &pendingCommands{
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// add calls expire once timeout elapses, unless the command is removed first.
+func (p *pendingCommands) add(correlationID string, timeout time.Duration, expire func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.timers[correlationID] = time.AfterFunc(timeout, func() {
+		p.mutex.Lock()
+		delete(p.timers, correlationID)
+		p.mutex.Unlock()
+		expire()
+	})
+}
+
+// remove stops the timeout of the command, it returns false when the command was not pending here.
+func (p *pendingCommands) remove(correlationID string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	timer, ok := p.timers[correlationID]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(p.timers, correlationID)
+	return true
+}
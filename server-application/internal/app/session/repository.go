@@ -8,17 +8,31 @@ import (
 	"github.com/sebastianreh/chatroom/pkg/logger"
 	"github.com/sebastianreh/chatroom/pkg/redis"
 	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"strconv"
 	"time"
 )
 
 const (
 	repositoryName  = "session.repository"
 	InactiveTimeTTL = time.Duration(24) * time.Hour
+	seqKeySuffix    = ":seq"
+	eventsKeySuffix = ":events"
+
+	resolvedCommandKeyPrefix   = "resolved_command:"
+	deadLetteredReplyKeyPrefix = "dead_lettered_reply:"
 )
 
 type SessionRepository interface {
 	Set(ctx context.Context, session entities.Session) error
 	Get(ctx context.Context, roomID string) (entities.Session, error)
+	NextSeq(ctx context.Context, roomID string) (int64, error)
+	CurrentSeq(ctx context.Context, roomID string) (int64, error)
+	AppendEvent(ctx context.Context, roomID string, frame []byte) error
+	GetEvents(ctx context.Context, roomID string) ([][]byte, error)
+	ResolveCommand(ctx context.Context, correlationID, resolution string, ttl time.Duration) (bool, error)
+	CommandResolution(ctx context.Context, correlationID string) (string, error)
+	SaveDeadLetteredReply(ctx context.Context, correlationID string, ttl time.Duration) error
+	IsDeadLetteredReply(ctx context.Context, correlationID string) (bool, error)
 }
 
 type sessionRepository struct {
@@ -71,3 +85,106 @@ func (repository *sessionRepository) Get(ctx context.Context, roomID string) (en
 
 	return session, err
 }
+
+func (repository *sessionRepository) NextSeq(ctx context.Context, roomID string) (int64, error) {
+	seq, err := repository.redis.Incr(ctx, roomID+seqKeySuffix, InactiveTimeTTL)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "NextSeq"))
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+func (repository *sessionRepository) CurrentSeq(ctx context.Context, roomID string) (int64, error) {
+	seqString, err := repository.redis.Get(ctx, roomID+seqKeySuffix)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "CurrentSeq"))
+		return 0, err
+	}
+
+	if seqString == str.Empty {
+		return 0, nil
+	}
+
+	seq, err := strconv.ParseInt(seqString, 10, 64)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "CurrentSeq"))
+		return 0, err
+	}
+
+	return seq, nil
+}
+
+// AppendEvent stores a sequenced frame in the room replay log, which keeps the last ReplayWindow frames.
+func (repository *sessionRepository) AppendEvent(ctx context.Context, roomID string, frame []byte) error {
+	err := repository.redis.ListAppend(ctx, roomID+eventsKeySuffix, frame, repository.config.Session.ReplayWindow,
+		InactiveTimeTTL)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "AppendEvent"))
+		return err
+	}
+
+	return nil
+}
+
+func (repository *sessionRepository) GetEvents(ctx context.Context, roomID string) ([][]byte, error) {
+	events, err := repository.redis.ListRange(ctx, roomID+eventsKeySuffix)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "GetEvents"))
+		return nil, err
+	}
+
+	frames := make([][]byte, 0, len(events))
+	for _, event := range events {
+		frames = append(frames, []byte(event))
+	}
+
+	return frames, nil
+}
+
+// ResolveCommand records how the command was resolved, it returns false when it already was. The record
+// expires after ttl.
+func (repository *sessionRepository) ResolveCommand(ctx context.Context, correlationID, resolution string,
+	ttl time.Duration) (bool, error) {
+	resolved, err := repository.redis.SetIfAbsent(ctx, resolvedCommandKeyPrefix+correlationID, resolution, ttl)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "ResolveCommand"))
+		return false, err
+	}
+
+	return resolved, nil
+}
+
+// CommandResolution returns how the command was resolved, it is empty while the command is pending.
+func (repository *sessionRepository) CommandResolution(ctx context.Context, correlationID string) (string, error) {
+	resolution, err := repository.redis.Get(ctx, resolvedCommandKeyPrefix+correlationID)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "CommandResolution"))
+		return "", err
+	}
+
+	return resolution, nil
+}
+
+// SaveDeadLetteredReply records that the reply to the command was dead-lettered. The record expires after ttl.
+func (repository *sessionRepository) SaveDeadLetteredReply(ctx context.Context, correlationID string,
+	ttl time.Duration) error {
+	err := repository.redis.Set(ctx, deadLetteredReplyKeyPrefix+correlationID, true, ttl)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "SaveDeadLetteredReply"))
+		return err
+	}
+
+	return nil
+}
+
+func (repository *sessionRepository) IsDeadLetteredReply(ctx context.Context, correlationID string) (bool, error) {
+	deadLettered, err := repository.redis.Get(ctx, deadLetteredReplyKeyPrefix+correlationID)
+	if err != nil {
+		repository.logs.Error(str.ErrorConcat(err, repositoryName, "IsDeadLetteredReply"))
+		return false, err
+	}
+
+	return !str.IsEmpty(deadLettered), nil
+}
@@ -2,18 +2,24 @@ package session
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/sebastianreh/chatroom/internal/config"
 	"github.com/sebastianreh/chatroom/internal/entities"
 	"github.com/sebastianreh/chatroom/pkg/logger"
 	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"sort"
 	"time"
 )
 
 const (
 	serviceName     = "session.service"
 	messageMaxLimit = 50
+
+	// resolvedCommandTTL is how long the resolved commands are remembered, replies to them are dropped until
+	// then.
+	resolvedCommandTTL = time.Hour
 )
 
 type SessionService interface {
@@ -21,6 +27,11 @@ type SessionService interface {
 	Exit(ctx context.Context, sessionExit entities.SessionChatRequest) error
 	SaveMessage(ctx context.Context, message entities.ChatMessage, roomID string) error
 	GetMessages(ctx context.Context, roomID string) ([]entities.ChatMessage, error)
+	PublishEvent(ctx context.Context, envelope entities.Envelope) (entities.Envelope, error)
+	GetEventsSince(ctx context.Context, roomID string, lastSeq int64) (entities.EventReplay, error)
+	ResolveCommand(ctx context.Context, correlationID, resolution string) (bool, error)
+	AcceptReply(ctx context.Context, correlationID string) (bool, error)
+	DeadLetterReply(ctx context.Context, correlationID string) error
 }
 
 type sessionService struct {
@@ -177,3 +188,118 @@ func (service *sessionService) GetMessages(ctx context.Context, roomID string) (
 
 	return messages, nil
 }
+
+// PublishEvent assigns the next room sequence number to the envelope and keeps it for replay. Numbering and
+// storing are separate calls: a failed append leaves a gap, and concurrent publishers can store their events out
+// of order, GetEventsSince copes with both.
+func (service *sessionService) PublishEvent(ctx context.Context, envelope entities.Envelope) (entities.Envelope, error) {
+	seq, err := service.repository.NextSeq(ctx, envelope.RoomID)
+	if err != nil {
+		return envelope, err
+	}
+
+	envelope.Seq = seq
+	err = service.repository.AppendEvent(ctx, envelope.RoomID, envelope.ToBytes())
+	if err != nil {
+		return envelope, err
+	}
+
+	return envelope, nil
+}
+
+// GetEventsSince returns the events after lastSeq in sequence order. The replay is incomplete when any of them
+// isn't stored, because it is older than the replay window, it could not be stored or it is still being stored.
+func (service *sessionService) GetEventsSince(ctx context.Context, roomID string, lastSeq int64) (entities.EventReplay, error) {
+	replay := entities.EventReplay{Complete: true}
+	currentSeq, err := service.repository.CurrentSeq(ctx, roomID)
+	if err != nil {
+		return replay, err
+	}
+
+	replay.LastSeq = currentSeq
+	if lastSeq == currentSeq {
+		return replay, nil
+	}
+
+	if lastSeq > currentSeq {
+		service.logs.Warn(fmt.Sprintf("last_seq %d is ahead of room %s sequence %d", lastSeq, roomID, currentSeq),
+			serviceName+".GetEventsSince")
+		replay.Complete = false
+		return replay, nil
+	}
+
+	frames, err := service.repository.GetEvents(ctx, roomID)
+	if err != nil {
+		return replay, err
+	}
+
+	type sequencedFrame struct {
+		seq   int64
+		frame []byte
+	}
+
+	missed := make([]sequencedFrame, 0, len(frames))
+	for _, frame := range frames {
+		var envelope entities.Envelope
+		if err = json.Unmarshal(frame, &envelope); err != nil {
+			service.logs.Error(str.ErrorConcat(err, serviceName, "GetEventsSince"))
+			continue
+		}
+
+		if envelope.Seq > lastSeq {
+			missed = append(missed, sequencedFrame{seq: envelope.Seq, frame: frame})
+		}
+	}
+
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].seq < missed[j].seq
+	})
+
+	nextSeq := lastSeq + 1
+	for _, event := range missed {
+		if event.seq == nextSeq {
+			nextSeq++
+		}
+	}
+
+	if nextSeq <= currentSeq {
+		service.logs.Warn(fmt.Sprintf("event %d of room %s is not stored, the replay is incomplete", nextSeq, roomID),
+			serviceName+".GetEventsSince")
+		replay.Complete = false
+		return replay, nil
+	}
+
+	for _, event := range missed {
+		replay.Frames = append(replay.Frames, event.frame)
+	}
+
+	return replay, nil
+}
+
+// ResolveCommand resolves the command either with the bot reply or with its timeout, whichever comes first
+// across the instances: it returns false when the command was already resolved, so the user isn't told about
+// the timeout of a command whose reply was delivered.
+func (service *sessionService) ResolveCommand(ctx context.Context, correlationID, resolution string) (bool, error) {
+	return service.repository.ResolveCommand(ctx, correlationID, resolution, resolvedCommandTTL)
+}
+
+// AcceptReply tells whether the bot reply to the command is delivered: it is while the command is pending, and
+// when an earlier delivery of the reply was dead-lettered, so its replay gets through even after the timeout.
+// Any other reply is late or duplicated.
+func (service *sessionService) AcceptReply(ctx context.Context, correlationID string) (bool, error) {
+	resolution, err := service.repository.CommandResolution(ctx, correlationID)
+	if err != nil {
+		return false, err
+	}
+
+	if str.IsEmpty(resolution) {
+		return true, nil
+	}
+
+	return service.repository.IsDeadLetteredReply(ctx, correlationID)
+}
+
+// DeadLetterReply lets the replay of the dead-lettered reply to the command through AcceptReply.
+func (service *sessionService) DeadLetterReply(ctx context.Context, correlationID string) error {
+	return service.repository.SaveDeadLetteredReply(ctx, correlationID, resolvedCommandTTL)
+}
@@ -0,0 +1,257 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"github.com/sebastianreh/chatroom/internal/app/session"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func sequencedFrame(t *testing.T, roomID string, seq int64) []byte {
+	envelope, err := entities.NewEnvelope(entities.ChatMessageFrameType, roomID, entities.ChatMessage{Content: "hi"})
+	assert.NoError(t, err)
+	envelope.Seq = seq
+	return envelope.ToBytes()
+}
+
+func Test_SessionService_PublishEvent(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("publish event assigns the next sequence number", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		envelope, _ := entities.NewEnvelope(entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: "hi"})
+
+		repositoryMock.On("NextSeq", ctx, "room1").Return(int64(7), nil)
+		repositoryMock.On("AppendEvent", ctx, "room1", mock.Anything).Return(nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		published, err := service.PublishEvent(ctx, envelope)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), published.Seq)
+		repositoryMock.AssertCalled(t, "AppendEvent", ctx, "room1", published.ToBytes())
+	})
+
+	t.Run("sequence error is returned", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		envelope, _ := entities.NewEnvelope(entities.ChatMessageFrameType, "room1", entities.ChatMessage{Content: "hi"})
+
+		repositoryMock.On("NextSeq", ctx, "room1").Return(int64(0), errors.New("redis error"))
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		_, err := service.PublishEvent(ctx, envelope)
+
+		assert.Error(t, err)
+		repositoryMock.AssertNotCalled(t, "AppendEvent", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func Test_SessionService_GetEventsSince(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("missed events are returned in sequence order", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		frames := [][]byte{
+			sequencedFrame(t, "room1", 3),
+			sequencedFrame(t, "room1", 5),
+			sequencedFrame(t, "room1", 4),
+			sequencedFrame(t, "room1", 6),
+		}
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(6), nil)
+		repositoryMock.On("GetEvents", ctx, "room1").Return(frames, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 3)
+
+		assert.NoError(t, err)
+		assert.True(t, replay.Complete)
+		assert.Equal(t, int64(6), replay.LastSeq)
+		assert.Equal(t, [][]byte{frames[2], frames[1], frames[3]}, replay.Frames)
+	})
+
+	t.Run("client up to date gets nothing", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(6), nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 6)
+
+		assert.NoError(t, err)
+		assert.True(t, replay.Complete)
+		assert.Empty(t, replay.Frames)
+		repositoryMock.AssertNotCalled(t, "GetEvents", mock.Anything, mock.Anything)
+	})
+
+	t.Run("gap older than the replay window is incomplete", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		frames := [][]byte{
+			sequencedFrame(t, "room1", 5),
+			sequencedFrame(t, "room1", 6),
+		}
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(6), nil)
+		repositoryMock.On("GetEvents", ctx, "room1").Return(frames, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 2)
+
+		assert.NoError(t, err)
+		assert.False(t, replay.Complete)
+		assert.Empty(t, replay.Frames)
+		assert.Equal(t, int64(6), replay.LastSeq)
+	})
+
+	t.Run("event missing inside the replay window is incomplete", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		frames := [][]byte{
+			sequencedFrame(t, "room1", 3),
+			sequencedFrame(t, "room1", 4),
+			sequencedFrame(t, "room1", 6),
+		}
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(6), nil)
+		repositoryMock.On("GetEvents", ctx, "room1").Return(frames, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 3)
+
+		assert.NoError(t, err)
+		assert.False(t, replay.Complete)
+		assert.Empty(t, replay.Frames)
+		assert.Equal(t, int64(6), replay.LastSeq)
+	})
+
+	t.Run("event numbered but not stored yet is incomplete", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		frames := [][]byte{
+			sequencedFrame(t, "room1", 4),
+			sequencedFrame(t, "room1", 5),
+		}
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(6), nil)
+		repositoryMock.On("GetEvents", ctx, "room1").Return(frames, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 3)
+
+		assert.NoError(t, err)
+		assert.False(t, replay.Complete)
+		assert.Empty(t, replay.Frames)
+	})
+
+	t.Run("client ahead of the room sequence is incomplete", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("CurrentSeq", ctx, "room1").Return(int64(0), nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replay, err := service.GetEventsSince(ctx, "room1", 10)
+
+		assert.NoError(t, err)
+		assert.False(t, replay.Complete)
+	})
+}
+
+func Test_SessionService_ResolveCommand(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("only the first resolution of a command wins", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("ResolveCommand", ctx, "corr1", entities.RepliedResolution, mock.Anything).
+			Return(true, nil).Once()
+		repositoryMock.On("ResolveCommand", ctx, "corr1", entities.TimedOutResolution, mock.Anything).
+			Return(false, nil).Once()
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		replied, err := service.ResolveCommand(ctx, "corr1", entities.RepliedResolution)
+		assert.NoError(t, err)
+		timedOut, err := service.ResolveCommand(ctx, "corr1", entities.TimedOutResolution)
+		assert.NoError(t, err)
+
+		assert.True(t, replied)
+		assert.False(t, timedOut)
+		repositoryMock.AssertExpectations(t)
+	})
+}
+
+func Test_SessionService_AcceptReply(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("reply to a pending command is accepted", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("CommandResolution", ctx, "corr1").Return("", nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		accepted, err := service.AcceptReply(ctx, "corr1")
+
+		assert.NoError(t, err)
+		assert.True(t, accepted)
+		repositoryMock.AssertNotCalled(t, "IsDeadLetteredReply", mock.Anything, mock.Anything)
+	})
+
+	t.Run("late reply to a command is dropped", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("CommandResolution", ctx, "corr1").Return(entities.TimedOutResolution, nil)
+		repositoryMock.On("IsDeadLetteredReply", ctx, "corr1").Return(false, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		accepted, err := service.AcceptReply(ctx, "corr1")
+
+		assert.NoError(t, err)
+		assert.False(t, accepted)
+	})
+
+	t.Run("replay of a dead-lettered reply is accepted after the timeout", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+
+		repositoryMock.On("CommandResolution", ctx, "corr1").Return(entities.TimedOutResolution, nil)
+		repositoryMock.On("IsDeadLetteredReply", ctx, "corr1").Return(true, nil)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		accepted, err := service.AcceptReply(ctx, "corr1")
+
+		assert.NoError(t, err)
+		assert.True(t, accepted)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		repositoryMock := mocks.NewSessionRepositoryMock()
+		ctx := context.TODO()
+		expectedErr := errors.New("redis unavailable")
+
+		repositoryMock.On("CommandResolution", ctx, "corr1").Return("", expectedErr)
+		service := session.NewSessionService(configs, repositoryMock, logs)
+
+		accepted, err := service.AcceptReply(ctx, "corr1")
+
+		assert.Equal(t, expectedErr, err)
+		assert.False(t, accepted)
+	})
+}
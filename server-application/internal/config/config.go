@@ -2,18 +2,23 @@ package config
 
 import (
 	"github.com/kelseyhightower/envconfig"
+	"time"
 )
 
 type (
 	Config struct {
-		ProjectName    string `default:"chatroom"`
-		ProjectVersion string `envconfig:"PROJECT_VERSION" default:"0.0.1"`
-		Port           string `envconfig:"PORT" default:"8000" required:"true"`
-		Prefix         string `envconfig:"PREFIX" default:"/chatroom"`
-		MongoDB        struct {
+		ProjectName     string        `default:"chatroom"`
+		ProjectVersion  string        `envconfig:"PROJECT_VERSION" default:"0.0.1"`
+		Port            string        `envconfig:"PORT" default:"8000" required:"true"`
+		Prefix          string        `envconfig:"PREFIX" default:"/chatroom"`
+		ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"15s"`
+		AdminAPIKey     string        `envconfig:"ADMIN_API_KEY"`
+		MongoDB         struct {
 			Collections struct {
-				Users string `envconfig:"USERS_COLLECTION" default:"users"`
-				Rooms string `envconfig:"ROOMS_COLLECTION" default:"rooms"`
+				Users       string `envconfig:"USERS_COLLECTION" default:"users"`
+				Rooms       string `envconfig:"ROOMS_COLLECTION" default:"rooms"`
+				DeadLetters string `envconfig:"DEAD_LETTERS_COLLECTION" default:"dead_letters"`
+				Bots        string `envconfig:"BOTS_COLLECTION" default:"bots"`
 			}
 			Database string `envconfig:"MONGODB_DATABASE" default:"chatroom"`
 			URI      string `envconfig:"MONGODB_URI" default:"mongodb://localhost:27018"`
@@ -21,10 +26,57 @@ type (
 		Redis struct {
 			Host string `envconfig:"REDIS_HOST" default:"localhost:6379"`
 		}
+		Session struct {
+			ReplayWindow    int64         `envconfig:"SESSION_REPLAY_WINDOW" default:"200"`
+			LongPollTimeout time.Duration `envconfig:"SESSION_LONG_POLL_TIMEOUT" default:"25s"`
+			CommandTimeout  time.Duration `envconfig:"SESSION_COMMAND_TIMEOUT" default:"10s"`
+		}
+		Websocket struct {
+			SendQueueSize  int           `envconfig:"WEBSOCKET_SEND_QUEUE_SIZE" default:"256"`
+			WriteTimeout   time.Duration `envconfig:"WEBSOCKET_WRITE_TIMEOUT" default:"10s"`
+			PingInterval   time.Duration `envconfig:"WEBSOCKET_PING_INTERVAL" default:"30s"`
+			PongTimeout    time.Duration `envconfig:"WEBSOCKET_PONG_TIMEOUT" default:"60s"`
+			MaxMessageSize int64         `envconfig:"WEBSOCKET_MAX_MESSAGE_SIZE" default:"8192"`
+			Compression    struct {
+				Enabled   bool `envconfig:"WEBSOCKET_COMPRESSION_ENABLED" default:"true"`
+				Level     int  `envconfig:"WEBSOCKET_COMPRESSION_LEVEL" default:"1"`
+				Threshold int  `envconfig:"WEBSOCKET_COMPRESSION_THRESHOLD" default:"512"`
+			}
+			ReadBufferSize  int  `envconfig:"WEBSOCKET_READ_BUFFER_SIZE" default:"1024"`
+			WriteBufferSize int  `envconfig:"WEBSOCKET_WRITE_BUFFER_SIZE" default:"1024"`
+			WriteBufferPool bool `envconfig:"WEBSOCKET_WRITE_BUFFER_POOL" default:"true"`
+		}
+		Cluster struct {
+			Enabled bool   `envconfig:"CLUSTER_ENABLED" default:"false"`
+			Channel string `envconfig:"CLUSTER_CHANNEL" default:"chatroom:broadcast"`
+		}
+		Broker struct {
+			Type   string `envconfig:"BROKER_TYPE" default:"kafka"`
+			Memory struct {
+				BufferSize int `envconfig:"BROKER_MEMORY_BUFFER_SIZE" default:"256"`
+			}
+			Redis struct {
+				Group    string        `envconfig:"BROKER_REDIS_GROUP" default:"chatroom-group"`
+				Consumer string        `envconfig:"BROKER_REDIS_CONSUMER" default:"chatroom"`
+				MaxLen   int64         `envconfig:"BROKER_REDIS_MAX_LEN" default:"10000"`
+				Block    time.Duration `envconfig:"BROKER_REDIS_BLOCK" default:"1s"`
+			}
+		}
 		Kafka struct {
-			Server      string `envconfig:"KAFKA_SERVER" default:"localhost:9092"`
-			GroupID     string `envconfig:"KAFKA_GROUP_ID" default:"chatroom-group"`
-			StocksTopic string `envconfig:"STOCKS_TOPIC" default:"stocks"`
+			Server        string `envconfig:"KAFKA_SERVER" default:"localhost:9092"`
+			GroupID       string `envconfig:"KAFKA_GROUP_ID" default:"chatroom-group"`
+			StocksTopic   string `envconfig:"STOCKS_TOPIC" default:"stocks"`
+			CommandsTopic string `envconfig:"COMMANDS_TOPIC" default:"commands"`
+			Restart       struct {
+				InitialBackoff time.Duration `envconfig:"KAFKA_RESTART_INITIAL_BACKOFF" default:"1s"`
+				MaxBackoff     time.Duration `envconfig:"KAFKA_RESTART_MAX_BACKOFF" default:"1m"`
+				MaxRestarts    int           `envconfig:"KAFKA_RESTART_MAX_RESTARTS" default:"0"`
+			}
+			DeadLetter struct {
+				Topic        string        `envconfig:"KAFKA_DEAD_LETTER_TOPIC" default:"stocks.dlq"`
+				MaxAttempts  int           `envconfig:"KAFKA_MAX_ATTEMPTS" default:"3"`
+				RetryBackoff time.Duration `envconfig:"KAFKA_RETRY_BACKOFF" default:"200ms"`
+			}
 		}
 	}
 )
@@ -1,11 +1,14 @@
 package container
 
 import (
+	"github.com/sebastianreh/chatroom/internal/app/bot"
+	"github.com/sebastianreh/chatroom/internal/app/deadletter"
 	"github.com/sebastianreh/chatroom/internal/app/ping"
 	"github.com/sebastianreh/chatroom/internal/app/room"
 	"github.com/sebastianreh/chatroom/internal/app/session"
 	"github.com/sebastianreh/chatroom/internal/app/user"
 	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/broker"
 	"github.com/sebastianreh/chatroom/pkg/kafka"
 	"github.com/sebastianreh/chatroom/pkg/logger"
 	"github.com/sebastianreh/chatroom/pkg/mongodb"
@@ -14,12 +17,20 @@ import (
 )
 
 type Dependencies struct {
-	PingHandler    ping.Handler
-	Config         config.Config
-	Logs           logger.Logger
-	UserHandler    user.UserHandler
-	RoomHandler    room.RoomHandler
-	SessionHandler session.SessionHandler
+	PingHandler       ping.Handler
+	Config            config.Config
+	Logs              logger.Logger
+	UserHandler       user.UserHandler
+	UserService       user.UserService
+	RoomHandler       room.RoomHandler
+	SessionHandler    session.SessionHandler
+	DeadLetterHandler deadletter.DeadLetterHandler
+	BotHandler        bot.BotHandler
+	Websocket         ws.Websocket
+	Subscriber        kafka.SupervisedConsumer
+	Publisher         broker.Publisher
+	MongoDB           mongodb.MongoDBier
+	Redis             rds.Redis
 }
 
 func Build() Dependencies {
@@ -27,15 +38,29 @@ func Build() Dependencies {
 	dependencies.Config = config.NewConfig()
 	logs := logger.NewLogger()
 	dependencies.Logs = logs
-	dependencies.PingHandler = ping.NewSHandierPing(dependencies.Config)
 
 	mongoDB := mongodb.NewMongoDB(dependencies.Config)
 	redis, err := rds.NewRedis(logs, dependencies.Config)
 	if err != nil {
 		logs.Fatal(err.Error())
 	}
-	websocket := ws.NewWebsocket()
-	kafkaConsumer, err := kafka.NewKafkaConsumer(dependencies.Config, dependencies.Logs)
+	websocket := ws.NewWebsocket(dependencies.Config, dependencies.Logs)
+	if dependencies.Config.Cluster.Enabled {
+		websocket, err = ws.NewClusterWebsocket(dependencies.Config, dependencies.Logs, websocket, redis)
+		if err != nil {
+			logs.Fatal(err.Error())
+		}
+	}
+	messageBroker, err := broker.NewBroker(dependencies.Config, redis, dependencies.Logs)
+	if err != nil {
+		logs.Fatal(err.Error())
+	}
+	stocksSubscriber, err := messageBroker.Subscriber(dependencies.Config.Kafka.StocksTopic)
+	if err != nil {
+		logs.Fatal(err.Error())
+	}
+	subscriber := kafka.NewSupervisedConsumer(dependencies.Config, stocksSubscriber, dependencies.Logs)
+	publisher, err := messageBroker.Publisher()
 	if err != nil {
 		logs.Fatal(err.Error())
 	}
@@ -48,13 +73,30 @@ func Build() Dependencies {
 	roomService := room.NewRoomService(dependencies.Config, roomRepository, dependencies.Logs)
 	roomHandler := room.NewRoomHandler(dependencies.Config, roomService, dependencies.Logs)
 
+	deadLetterRepository := deadletter.NewDeadLetterRepository(dependencies.Config, mongoDB, dependencies.Logs)
+	deadLetterService := deadletter.NewDeadLetterService(dependencies.Config, deadLetterRepository, publisher, dependencies.Logs)
+	deadLetterHandler := deadletter.NewDeadLetterHandler(dependencies.Config, deadLetterService, dependencies.Logs)
+
+	botRepository := bot.NewBotRepository(dependencies.Config, mongoDB, dependencies.Logs)
+	botService := bot.NewBotService(dependencies.Config, botRepository, roomRepository, publisher, dependencies.Logs)
+	botHandler := bot.NewBotHandler(dependencies.Config, botService, dependencies.Logs)
+
 	sessionRepository := session.NewSessionRepository(dependencies.Config, redis, dependencies.Logs)
 	sessionService := session.NewSessionService(dependencies.Config, sessionRepository, dependencies.Logs)
-	sessionHandler := session.NewSessionHandler(dependencies.Config, sessionService, websocket, kafkaConsumer, dependencies.Logs)
+	sessionHandler := session.NewSessionHandler(dependencies.Config, sessionService, deadLetterService, botService, websocket, subscriber, dependencies.Logs)
 
+	dependencies.PingHandler = ping.NewSHandierPing(dependencies.Config, subscriber)
 	dependencies.UserHandler = userHandler
+	dependencies.UserService = userService
 	dependencies.RoomHandler = roomHandler
 	dependencies.SessionHandler = sessionHandler
+	dependencies.DeadLetterHandler = deadLetterHandler
+	dependencies.BotHandler = botHandler
+	dependencies.Websocket = websocket
+	dependencies.Subscriber = subscriber
+	dependencies.Publisher = publisher
+	dependencies.MongoDB = mongoDB
+	dependencies.Redis = redis
 
 	return dependencies
 }
@@ -0,0 +1,152 @@
+package entities
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+const (
+	BotIDField       = "_id"
+	BotNameField     = "name"
+	BotOwnerIDField  = "owner_id"
+	BotScopesField   = "scopes"
+	BotAPIKeyField   = "api_key"
+	BotIsActiveField = "is_active"
+	BotCommandsField = "commands"
+
+	// CommandsScope lets a bot register the commands it handles in the rooms it joins.
+	CommandsScope = "commands"
+
+	// AdminContextKey flags the requests authenticated with the admin API key.
+	AdminContextKey = "admin"
+
+	apiKeyBytes  = 32
+	bearerPrefix = "Bearer "
+)
+
+var botScopes = map[string]bool{
+	CommandsScope: true,
+}
+
+// Bot is a registered bot. APIKey holds the hash of the key the bot authenticates with, the key itself is
+// only returned when it is generated. Commands are the ones the bot registered to get through the broker.
+type Bot struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name" validate:"required"`
+	OwnerID   string              `json:"owner_id"`
+	Scopes    []string            `json:"scopes"`
+	Commands  []CommandDefinition `json:"commands"`
+	APIKey    string              `json:"-"`
+	IsActive  bool                `json:"is_active"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+type BotCreateResponse struct {
+	ID     string `json:"id"`
+	APIKey string `json:"api_key"`
+}
+
+type BotKeyResponse struct {
+	APIKey string `json:"api_key"`
+}
+
+type BotsGetResponse struct {
+	Bots []Bot `json:"bots"`
+}
+
+// BotRoomsResponse lists the rooms a bot is enabled in.
+type BotRoomsResponse struct {
+	Rooms []string `json:"rooms"`
+}
+
+type BotDTO struct {
+	ID        primitive.ObjectID  `bson:"_id"`
+	Name      string              `bson:"name"`
+	OwnerID   string              `bson:"owner_id"`
+	Scopes    []string            `bson:"scopes"`
+	Commands  []CommandDefinition `bson:"commands"`
+	APIKey    string              `bson:"api_key"`
+	IsActive  bool                `bson:"is_active"`
+	CreatedAt time.Time           `bson:"created_at"`
+}
+
+type BotSearch struct {
+	ID       string `query:"id"`
+	Name     string `query:"name"`
+	OwnerID  string `query:"owner_id"`
+	IsActive *bool  `query:"is_active"`
+}
+
+// RoomBotRequest enables or disables a bot in a room. UserID is the authenticated user, never read from the
+// request, and must be the room owner unless the request comes from an admin.
+type RoomBotRequest struct {
+	RoomID  string `param:"id"`
+	BotName string `param:"bot_name"`
+	UserID  string
+	Admin   bool
+}
+
+// BearerToken returns the API key sent in an Authorization header.
+func BearerToken(authorization string) string {
+	return strings.TrimPrefix(authorization, bearerPrefix)
+}
+
+// GenerateAPIKey returns a random key for a bot.
+func GenerateAPIKey() (string, error) {
+	key := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(key), nil
+}
+
+func (b Bot) HasScope(scope string) bool {
+	for _, botScope := range b.Scopes {
+		if botScope == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b Bot) ValidateScopes() error {
+	for _, scope := range b.Scopes {
+		if !botScopes[scope] {
+			return fmt.Errorf("unknown scope '%s'", scope)
+		}
+	}
+
+	return nil
+}
+
+func CreateBotDTOFromEntity(bot Bot, hashedAPIKey string) BotDTO {
+	return BotDTO{
+		ID:        primitive.NewObjectID(),
+		Name:      bot.Name,
+		OwnerID:   bot.OwnerID,
+		Scopes:    bot.Scopes,
+		Commands:  []CommandDefinition{},
+		APIKey:    hashedAPIKey,
+		IsActive:  true,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func CreateBotEntityFromBotDTO(DTO BotDTO) Bot {
+	return Bot{
+		ID:        DTO.ID.Hex(),
+		Name:      DTO.Name,
+		OwnerID:   DTO.OwnerID,
+		Scopes:    DTO.Scopes,
+		Commands:  DTO.Commands,
+		APIKey:    DTO.APIKey,
+		IsActive:  DTO.IsActive,
+		CreatedAt: DTO.CreatedAt,
+	}
+}
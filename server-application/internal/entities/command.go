@@ -0,0 +1,226 @@
+package entities
+
+import (
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	HelpCommand = "help"
+
+	// RepliedResolution and TimedOutResolution tell whether a command was resolved by the bot reply or by its
+	// timeout.
+	RepliedResolution  = "replied"
+	TimedOutResolution = "timed_out"
+)
+
+var commandNamePattern = regexp.MustCompile(`^\w+$`)
+
+// CommandArgument describes a positional argument of a bot command, its value must fully match Pattern when set.
+// A Variadic argument, only allowed last, takes every remaining value.
+type CommandArgument struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+	Variadic bool   `json:"variadic,omitempty"`
+}
+
+// CommandDefinition is a command a bot handles, registered when the bot connects to a room.
+type CommandDefinition struct {
+	Name string            `json:"name"`
+	Args []CommandArgument `json:"args,omitempty"`
+	Help string            `json:"help"`
+}
+
+// CommandRegistration is the payload of the command_registration frame a bot sends after connecting.
+type CommandRegistration struct {
+	Commands []CommandDefinition `json:"commands"`
+}
+
+// CommandHelp lists a command in the command_help frame answering /help.
+type CommandHelp struct {
+	Name  string `json:"name"`
+	Usage string `json:"usage"`
+	Help  string `json:"help"`
+	Bot   string `json:"bot,omitempty"`
+}
+
+type CommandHelpPayload struct {
+	Commands []CommandHelp `json:"commands"`
+}
+
+// Command is a slash command typed in a chat message.
+type Command struct {
+	Name string
+	Args []string
+}
+
+// CommandRequest is a command delivered to a bot through the broker, on the commands topic of the bot. The bot
+// reply carries the same CorrelationID.
+type CommandRequest struct {
+	CorrelationID string    `json:"correlation_id"`
+	RoomID        string    `json:"room_id"`
+	UserID        string    `json:"user_id"`
+	Username      string    `json:"username"`
+	Bot           string    `json:"bot"`
+	Command       string    `json:"command"`
+	Args          []string  `json:"args,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// RoomCommand is a command registered through the API by a bot enabled in a room.
+type RoomCommand struct {
+	Definition CommandDefinition
+	BotName    string
+}
+
+func NewCommandRequest(roomID string, user SessionUser, botName string, command Command) CommandRequest {
+	return CommandRequest{
+		CorrelationID: primitive.NewObjectID().Hex(),
+		RoomID:        roomID,
+		UserID:        user.UserID,
+		Username:      user.Username,
+		Bot:           botName,
+		Command:       command.Name,
+		Args:          command.Args,
+		CreatedAt:     time.Now().UTC(),
+	}
+}
+
+// CommandsTopic is the topic the commands of the bot are delivered on.
+func CommandsTopic(prefix, botName string) string {
+	return prefix + "." + botName
+}
+
+// ParseCommand splits a /name arg1 arg2 message into its command, ok is false when the message is not a
+// command. The legacy /name=value form is accepted as a command with a single argument.
+func ParseCommand(content string) (Command, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, str.CommandPrefix) {
+		return Command{}, false
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(content, str.CommandPrefix))
+	if len(fields) == 0 {
+		return Command{}, false
+	}
+
+	name, value, legacy := strings.Cut(fields[0], "=")
+	command := Command{Name: strings.ToLower(name)}
+	if legacy && !str.IsEmpty(value) {
+		command.Args = append(command.Args, value)
+	}
+	command.Args = append(command.Args, fields[1:]...)
+
+	return command, true
+}
+
+// Validate checks the definition a bot registers, argument patterns must compile.
+func (d CommandDefinition) Validate() error {
+	if !commandNamePattern.MatchString(d.Name) {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			fmt.Sprintf("invalid command name '%s'", d.Name))
+	}
+
+	if d.Name == HelpCommand {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			fmt.Sprintf("command '%s' is reserved", d.Name))
+	}
+
+	for i, arg := range d.Args {
+		if _, err := regexp.Compile(anchor(arg.Pattern)); err != nil {
+			return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+				fmt.Sprintf("invalid pattern for argument '%s' of command '%s': %s", arg.Name, d.Name, err.Error()))
+		}
+
+		if arg.Variadic && i != len(d.Args)-1 {
+			return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+				fmt.Sprintf("argument '%s' of command '%s' is variadic but not the last one", arg.Name, d.Name))
+		}
+	}
+
+	return nil
+}
+
+// ValidateArgs checks the arguments typed by a user against the definition, the error message holds the
+// command usage.
+func (d CommandDefinition) ValidateArgs(args []string) error {
+	required := 0
+	for _, arg := range d.Args {
+		if !arg.Optional {
+			required++
+		}
+	}
+
+	variadic := len(d.Args) > 0 && d.Args[len(d.Args)-1].Variadic
+	if variadic && len(args) < required {
+		return d.usageError(fmt.Sprintf("expected at least %s", pluralizeArgs(required, required)))
+	}
+
+	if !variadic && (len(args) < required || len(args) > len(d.Args)) {
+		return d.usageError(fmt.Sprintf("expected %s", pluralizeArgs(required, len(d.Args))))
+	}
+
+	for i, value := range args {
+		arg := d.Args[len(d.Args)-1]
+		if i < len(d.Args) {
+			arg = d.Args[i]
+		}
+
+		if str.IsEmpty(arg.Pattern) {
+			continue
+		}
+
+		if !regexp.MustCompile(anchor(arg.Pattern)).MatchString(value) {
+			return d.usageError(fmt.Sprintf("invalid %s '%s'", arg.Name, value))
+		}
+	}
+
+	return nil
+}
+
+// Usage renders the command syntax, optional arguments are shown in brackets and variadic ones followed by an
+// ellipsis.
+func (d CommandDefinition) Usage() string {
+	usage := str.CommandPrefix + d.Name
+	for _, arg := range d.Args {
+		format := " <%s>"
+		if arg.Optional {
+			format = " [%s]"
+		}
+		usage += fmt.Sprintf(format, arg.Name)
+
+		if arg.Variadic {
+			usage += "..."
+		}
+	}
+
+	return usage
+}
+
+func (d CommandDefinition) usageError(reason string) error {
+	return exceptions.NewProtocolException(exceptions.InvalidCommandCode,
+		fmt.Sprintf("%s, usage: %s", reason, d.Usage()))
+}
+
+func anchor(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+func pluralizeArgs(min, max int) string {
+	count := fmt.Sprintf("%d", min)
+	if min != max {
+		count = fmt.Sprintf("%d to %d", min, max)
+	}
+
+	if max == 1 {
+		return count + " argument"
+	}
+
+	return count + " arguments"
+}
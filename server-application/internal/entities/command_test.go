@@ -0,0 +1,107 @@
+package entities_test
+
+import (
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_ParseCommand(t *testing.T) {
+	t.Run("command and arguments are split", func(t *testing.T) {
+		command, ok := entities.ParseCommand(" /Stock aapl.us  msft.us ")
+
+		assert.True(t, ok)
+		assert.Equal(t, entities.Command{Name: "stock", Args: []string{"aapl.us", "msft.us"}}, command)
+	})
+
+	t.Run("legacy form is parsed as a single argument", func(t *testing.T) {
+		command, ok := entities.ParseCommand("/stock=aapl.us")
+
+		assert.True(t, ok)
+		assert.Equal(t, entities.Command{Name: "stock", Args: []string{"aapl.us"}}, command)
+	})
+
+	t.Run("regular messages are not commands", func(t *testing.T) {
+		for _, content := range []string{"hello /stock", "/", "/ "} {
+			_, ok := entities.ParseCommand(content)
+
+			assert.False(t, ok, content)
+		}
+	})
+}
+
+func Test_CommandDefinition_ValidateArgs(t *testing.T) {
+	definition := entities.CommandDefinition{
+		Name: "stock",
+		Args: []entities.CommandArgument{
+			{Name: "code", Pattern: `[\w.]+`},
+			{Name: "currency", Pattern: `[a-z]{3}`, Optional: true},
+		},
+	}
+
+	t.Run("valid arguments", func(t *testing.T) {
+		assert.NoError(t, definition.ValidateArgs([]string{"aapl.us"}))
+		assert.NoError(t, definition.ValidateArgs([]string{"aapl.us", "usd"}))
+	})
+
+	t.Run("invalid arguments return the usage", func(t *testing.T) {
+		cases := map[string][]string{
+			"expected 1 to 2 arguments, usage: /stock <code> [currency]":  {},
+			"invalid currency 'dollars', usage: /stock <code> [currency]": {"aapl.us", "dollars"},
+			"invalid code 'aapl$', usage: /stock <code> [currency]":       {"aapl$"},
+		}
+
+		for message, args := range cases {
+			err := definition.ValidateArgs(args)
+
+			protocolErr, ok := err.(exceptions.ProtocolException)
+			if assert.True(t, ok, message) {
+				assert.Equal(t, exceptions.InvalidCommandCode, protocolErr.Code())
+				assert.Equal(t, message, protocolErr.Error())
+			}
+		}
+	})
+}
+
+func Test_CommandDefinition_ValidateArgs_Variadic(t *testing.T) {
+	definition := entities.CommandDefinition{
+		Name: "stock",
+		Args: []entities.CommandArgument{{Name: "code", Pattern: `[\w.]+`, Variadic: true}},
+	}
+
+	t.Run("variadic argument takes every remaining value", func(t *testing.T) {
+		assert.NoError(t, definition.ValidateArgs([]string{"aapl.us"}))
+		assert.NoError(t, definition.ValidateArgs([]string{"aapl.us", "msft.us", "tsla.us"}))
+	})
+
+	t.Run("every value is checked against the variadic argument", func(t *testing.T) {
+		cases := map[string][]string{
+			"expected at least 1 argument, usage: /stock <code>...": {},
+			"invalid code 'msft$', usage: /stock <code>...":         {"aapl.us", "msft$"},
+		}
+
+		for message, args := range cases {
+			err := definition.ValidateArgs(args)
+
+			if assert.Error(t, err, message) {
+				assert.Equal(t, message, err.Error())
+			}
+		}
+	})
+}
+
+func Test_CommandDefinition_Validate(t *testing.T) {
+	t.Run("invalid definitions are rejected", func(t *testing.T) {
+		definitions := []entities.CommandDefinition{
+			{Name: "help"},
+			{Name: "two words"},
+			{Name: "stock", Args: []entities.CommandArgument{{Name: "code", Pattern: `[`}}},
+			{Name: "stock", Args: []entities.CommandArgument{{Name: "code", Variadic: true}, {Name: "currency"}}},
+		}
+
+		for _, definition := range definitions {
+			assert.Error(t, definition.Validate(), definition.Name)
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package entities
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"time"
+)
+
+const (
+	DeadLetterIDField         = "_id"
+	DeadLetterTopicField      = "topic"
+	DeadLetterReplayedAtField = "replayed_at"
+
+	DeadLetterSourceTopicHeader = "source_topic"
+	DeadLetterErrorHeader       = "error"
+	DeadLetterAttemptsHeader    = "attempts"
+	DeadLetterFailedAtHeader    = "failed_at"
+)
+
+// DeadLetter is a message that could not be processed after all its attempts. Topic is the topic it was
+// consumed from, and where it is published again when replayed.
+type DeadLetter struct {
+	ID         string     `json:"id"`
+	Topic      string     `json:"topic"`
+	Payload    string     `json:"payload"`
+	Error      string     `json:"error"`
+	Attempts   int        `json:"attempts"`
+	FailedAt   time.Time  `json:"failed_at"`
+	ReplayedAt *time.Time `json:"replayed_at,omitempty"`
+}
+
+type DeadLettersGetResponse struct {
+	DeadLetters []DeadLetter `json:"dead_letters"`
+}
+
+type DeadLetterDTO struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Topic      string             `bson:"topic"`
+	Payload    string             `bson:"payload"`
+	Error      string             `bson:"error"`
+	Attempts   int                `bson:"attempts"`
+	FailedAt   time.Time          `bson:"failed_at"`
+	ReplayedAt *time.Time         `bson:"replayed_at,omitempty"`
+}
+
+type DeadLetterSearch struct {
+	ID       string `query:"id"`
+	Topic    string `query:"topic"`
+	Replayed *bool  `query:"replayed"`
+}
+
+// Headers are the error metadata sent along with the payload to the dead-letter topic.
+func (d DeadLetter) Headers() map[string]string {
+	return map[string]string{
+		DeadLetterSourceTopicHeader: d.Topic,
+		DeadLetterErrorHeader:       d.Error,
+		DeadLetterAttemptsHeader:    strconv.Itoa(d.Attempts),
+		DeadLetterFailedAtHeader:    d.FailedAt.Format(time.RFC3339),
+	}
+}
+
+func CreateDeadLetterDTOFromEntity(deadLetter DeadLetter) DeadLetterDTO {
+	return DeadLetterDTO{
+		ID:         primitive.NewObjectID(),
+		Topic:      deadLetter.Topic,
+		Payload:    deadLetter.Payload,
+		Error:      deadLetter.Error,
+		Attempts:   deadLetter.Attempts,
+		FailedAt:   deadLetter.FailedAt,
+		ReplayedAt: deadLetter.ReplayedAt,
+	}
+}
+
+func CreateDeadLetterEntityFromDTO(DTO DeadLetterDTO) DeadLetter {
+	return DeadLetter{
+		ID:         DTO.ID.Hex(),
+		Topic:      DTO.Topic,
+		Payload:    DTO.Payload,
+		Error:      DTO.Error,
+		Attempts:   DTO.Attempts,
+		FailedAt:   DTO.FailedAt,
+		ReplayedAt: DTO.ReplayedAt,
+	}
+}
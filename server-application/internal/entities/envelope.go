@@ -0,0 +1,197 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	str "github.com/sebastianreh/chatroom/pkg/strings"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	ProtocolVersion = 1
+
+	ChatMessageFrameType   = "chat_message"
+	SessionActionFrameType = "session_action"
+	BotCommandFrameType    = "bot_command"
+	BotMessageFrameType    = "bot_message"
+	ErrorFrameType         = "error"
+	ResyncFrameType        = "resync"
+	SubscribeFrameType     = "subscribe"
+	UnsubscribeFrameType   = "unsubscribe"
+
+	CommandRegistrationFrameType = "command_registration"
+	CommandHelpFrameType         = "command_help"
+)
+
+var frameTypes = map[string]bool{
+	ChatMessageFrameType:   true,
+	SessionActionFrameType: true,
+	BotCommandFrameType:    true,
+	BotMessageFrameType:    true,
+	ErrorFrameType:         true,
+	ResyncFrameType:        true,
+	SubscribeFrameType:     true,
+	UnsubscribeFrameType:   true,
+
+	CommandRegistrationFrameType: true,
+	CommandHelpFrameType:         true,
+}
+
+// Envelope wraps every frame sent through a socket, in both directions, so clients can tell
+// which kind of payload they received without sniffing its fields. Seq is assigned by the server to
+// room events, it increases monotonically per room and lets clients resume after a reconnection.
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	ID        string          `json:"id"`
+	Seq       int64           `json:"seq,omitempty"`
+	RoomID    string          `json:"room_id"`
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// ResyncPayload tells a resuming client its missed events are no longer available: it has to reload the
+// room history and continue from LastSeq.
+type ResyncPayload struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// SubscriptionPayload is carried by the subscribe and unsubscribe control frames of a multiplexed connection,
+// the room is the envelope room_id. LastSeq resumes the room delivery like the last_seq query parameter.
+type SubscriptionPayload struct {
+	LastSeq *int64 `json:"last_seq,omitempty"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+func NewEnvelope(frameType, roomID string, payload interface{}) (Envelope, error) {
+	var envelope Envelope
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return envelope, err
+	}
+
+	envelope = Envelope{
+		Type:      frameType,
+		Version:   ProtocolVersion,
+		ID:        primitive.NewObjectID().Hex(),
+		RoomID:    roomID,
+		Payload:   payloadBytes,
+		Timestamp: time.Now().UTC(),
+	}
+
+	return envelope, nil
+}
+
+func NewErrorEnvelope(roomID, replyTo string, err error) Envelope {
+	payload := ErrorPayload{
+		Code:    exceptions.MalformedFrameCode,
+		Message: err.Error(),
+		ReplyTo: replyTo,
+	}
+
+	if protocolErr, ok := err.(exceptions.ProtocolException); ok {
+		payload.Code = protocolErr.Code()
+	}
+
+	envelope, _ := NewEnvelope(ErrorFrameType, roomID, payload)
+	return envelope
+}
+
+// DecodeEnvelope parses an inbound frame for the given room. Frames without a version are treated as
+// the legacy raw ChatMessage shape and wrapped into a chat_message envelope.
+func DecodeEnvelope(message []byte, roomID string) (Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return Envelope{}, exceptions.NewProtocolException(exceptions.MalformedFrameCode,
+			fmt.Sprintf("frame is not a json object: %s", err.Error()))
+	}
+
+	if _, ok := fields["version"]; !ok {
+		return decodeLegacyFrame(fields, message, roomID)
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return envelope, exceptions.NewProtocolException(exceptions.MalformedFrameCode,
+			fmt.Sprintf("invalid envelope: %s", err.Error()))
+	}
+
+	if str.IsEmpty(envelope.RoomID) {
+		envelope.RoomID = roomID
+	}
+
+	if err := envelope.Validate(roomID); err != nil {
+		return envelope, err
+	}
+
+	if str.IsEmpty(envelope.ID) {
+		envelope.ID = primitive.NewObjectID().Hex()
+	}
+
+	if envelope.Timestamp.IsZero() {
+		envelope.Timestamp = time.Now().UTC()
+	}
+
+	return envelope, nil
+}
+
+func decodeLegacyFrame(fields map[string]json.RawMessage, message []byte, roomID string) (Envelope, error) {
+	if _, ok := fields["content"]; !ok {
+		return Envelope{}, exceptions.NewProtocolException(exceptions.MalformedFrameCode,
+			"frame has no version and does not match any legacy shape")
+	}
+
+	var chatMessage ChatMessage
+	if err := json.Unmarshal(message, &chatMessage); err != nil {
+		return Envelope{}, exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			fmt.Sprintf("invalid legacy chat message: %s", err.Error()))
+	}
+
+	return NewEnvelope(ChatMessageFrameType, roomID, chatMessage)
+}
+
+// Validate checks the envelope header. When roomID is not empty the envelope must target that room.
+func (e Envelope) Validate(roomID string) error {
+	if e.Version != ProtocolVersion {
+		return exceptions.NewProtocolException(exceptions.UnsupportedVersionCode,
+			fmt.Sprintf("unsupported protocol version %d, expected %d", e.Version, ProtocolVersion))
+	}
+
+	if !frameTypes[e.Type] {
+		return exceptions.NewProtocolException(exceptions.UnknownTypeCode,
+			fmt.Sprintf("unknown frame type '%s'", e.Type))
+	}
+
+	if !str.IsEmpty(roomID) && e.RoomID != roomID {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			fmt.Sprintf("frame room_id '%s' does not match connection room", e.RoomID))
+	}
+
+	payload := bytes.TrimSpace(e.Payload)
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode, "frame payload is empty")
+	}
+
+	return nil
+}
+
+func (e Envelope) DecodePayload(payload interface{}) error {
+	if err := json.Unmarshal(e.Payload, payload); err != nil {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode,
+			fmt.Sprintf("invalid %s payload: %s", e.Type, err.Error()))
+	}
+	return nil
+}
+
+func (e Envelope) ToBytes() []byte {
+	eBytes, _ := json.Marshal(e)
+	return eBytes
+}
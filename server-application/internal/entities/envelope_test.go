@@ -0,0 +1,90 @@
+package entities_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_DecodeEnvelope(t *testing.T) {
+	roomID := "room123"
+
+	t.Run("decode envelope successfully", func(t *testing.T) {
+		frame := `{"type":"chat_message","version":1,"id":"abc","room_id":"room123","payload":{"content":"hi"}}`
+
+		envelope, err := entities.DecodeEnvelope([]byte(frame), roomID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, entities.ChatMessageFrameType, envelope.Type)
+		assert.Equal(t, "abc", envelope.ID)
+		assert.False(t, envelope.Timestamp.IsZero())
+		var chatMessage entities.ChatMessage
+		assert.NoError(t, envelope.DecodePayload(&chatMessage))
+		assert.Equal(t, "hi", chatMessage.Content)
+	})
+
+	t.Run("legacy chat message is wrapped into an envelope", func(t *testing.T) {
+		frame := `{"username":"User1","user_id":"id123","created_at":"2023-10-01T10:00:00Z","content":"hello"}`
+
+		envelope, err := entities.DecodeEnvelope([]byte(frame), roomID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, entities.ChatMessageFrameType, envelope.Type)
+		assert.Equal(t, entities.ProtocolVersion, envelope.Version)
+		assert.Equal(t, roomID, envelope.RoomID)
+		assert.NotEmpty(t, envelope.ID)
+		var chatMessage entities.ChatMessage
+		assert.NoError(t, json.Unmarshal(envelope.Payload, &chatMessage))
+		assert.Equal(t, "hello", chatMessage.Content)
+		assert.Equal(t, "User1", chatMessage.Username)
+	})
+
+	t.Run("invalid frames return protocol errors", func(t *testing.T) {
+		cases := map[string]string{
+			exceptions.MalformedFrameCode:     `not json`,
+			exceptions.UnsupportedVersionCode: `{"type":"chat_message","version":2,"payload":{"content":"hi"}}`,
+			exceptions.UnknownTypeCode:        `{"type":"shout","version":1,"payload":{"content":"hi"}}`,
+			exceptions.InvalidPayloadCode:     `{"type":"chat_message","version":1,"room_id":"other","payload":{}}`,
+		}
+
+		for code, frame := range cases {
+			_, err := entities.DecodeEnvelope([]byte(frame), roomID)
+
+			protocolErr, ok := err.(exceptions.ProtocolException)
+			assert.True(t, ok, frame)
+			assert.Equal(t, code, protocolErr.Code(), frame)
+		}
+	})
+
+	t.Run("unknown legacy shape is rejected", func(t *testing.T) {
+		_, err := entities.DecodeEnvelope([]byte(`{"foo":"bar"}`), roomID)
+
+		assert.Error(t, err)
+	})
+}
+
+func Test_NewErrorEnvelope(t *testing.T) {
+	t.Run("protocol error keeps its code", func(t *testing.T) {
+		err := exceptions.NewProtocolException(exceptions.UnknownTypeCode, "unknown frame type")
+
+		envelope := entities.NewErrorEnvelope("room123", "abc", err)
+
+		var payload entities.ErrorPayload
+		assert.NoError(t, envelope.DecodePayload(&payload))
+		assert.Equal(t, entities.ErrorFrameType, envelope.Type)
+		assert.Equal(t, exceptions.UnknownTypeCode, payload.Code)
+		assert.Equal(t, "abc", payload.ReplyTo)
+	})
+
+	t.Run("generic error is reported as malformed frame", func(t *testing.T) {
+		envelope := entities.NewErrorEnvelope("room123", "", errors.New("boom"))
+
+		var payload entities.ErrorPayload
+		assert.NoError(t, envelope.DecodePayload(&payload))
+		assert.Equal(t, exceptions.MalformedFrameCode, payload.Code)
+		assert.Equal(t, "boom", payload.Message)
+	})
+}
@@ -0,0 +1,42 @@
+package exceptions
+
+const (
+	MalformedFrameCode     = "malformed_frame"
+	UnsupportedVersionCode = "unsupported_version"
+	UnknownTypeCode        = "unknown_type"
+	InvalidPayloadCode     = "invalid_payload"
+	NotSubscribedCode      = "not_subscribed"
+	UnknownCommandCode     = "unknown_command"
+	InvalidCommandCode     = "invalid_command"
+	UnauthorizedCode       = "unauthorized"
+	BotTimeoutCode         = "bot_timeout"
+	DeliveryFailedCode     = "delivery_failed"
+	ClusterUnsupportedCode = "cluster_unsupported"
+)
+
+type ProtocolException interface {
+	Error() string
+	Code() string
+	IsProtocolError() bool
+}
+
+type protocolException struct {
+	ErrCode    string
+	ErrMessage string
+}
+
+func (exception *protocolException) Error() string {
+	return exception.ErrMessage
+}
+
+func (exception *protocolException) Code() string {
+	return exception.ErrCode
+}
+
+func (exception *protocolException) IsProtocolError() bool {
+	return true
+}
+
+func NewProtocolException(code, message string) ProtocolException {
+	return &protocolException{ErrCode: code, ErrMessage: message}
+}
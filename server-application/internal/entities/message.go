@@ -1,6 +1,10 @@
 package entities
 
-import "time"
+import (
+	"github.com/sebastianreh/chatroom/internal/entities/exceptions"
+	"strings"
+	"time"
+)
 
 const (
 	RoomActionEventType  = "room_action"
@@ -22,13 +26,27 @@ type ChatMessage struct {
 	Content   string    `json:"content"`
 }
 
+// BotMessage is the bot_command payload routed to the bot owning the command, from RoomID, where the reply goes.
 type BotMessage struct {
-	Command string `json:"command"`
-	Value   string `json:"value"`
+	CorrelationID string   `json:"correlation_id,omitempty"`
+	RoomID        string   `json:"room_id"`
+	UserID        string   `json:"user_id,omitempty"`
+	Command       string   `json:"command"`
+	Value         string   `json:"value"`
+	Args          []string `json:"args,omitempty"`
 }
 
+// StockMessage is a bot reply, CorrelationID is the one of the command it answers.
 type StockMessage struct {
-	RoomID    string    `json:"room_id"`
-	Message   string    `json:"bot_message"`
-	CreatedAt time.Time `json:"created_at"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	RoomID        string    `json:"room_id"`
+	Message       string    `json:"bot_message"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (m ChatMessage) Validate() error {
+	if strings.TrimSpace(m.Content) == "" {
+		return exceptions.NewProtocolException(exceptions.InvalidPayloadCode, "chat message content is empty")
+	}
+	return nil
 }
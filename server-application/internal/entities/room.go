@@ -6,12 +6,16 @@ const (
 	RoomIDField           = "_id"
 	RoomNameField         = "name"
 	RoomIsActiveNameField = "is_active"
+	RoomBotsField         = "bots"
 )
 
+// Room is a chatroom. Bots lists the names of the bots allowed to join it, managed by its owner.
 type Room struct {
-	ID       string `json:"id" validate:"required"`
-	Name     string `json:"name" validate:"required"`
-	IsActive bool   `json:"is_active"`
+	ID       string   `json:"id" validate:"required"`
+	Name     string   `json:"name" validate:"required"`
+	OwnerID  string   `json:"owner_id"`
+	Bots     []string `json:"bots"`
+	IsActive bool     `json:"is_active"`
 }
 
 type RoomCreateResponse struct {
@@ -25,6 +29,8 @@ type RoomsGetResponse struct {
 type RoomDTO struct {
 	ID       primitive.ObjectID `json:"id" bson:"_id"`
 	Name     string             `json:"name"  bson:"name"`
+	OwnerID  string             `json:"owner_id"  bson:"owner_id"`
+	Bots     []string           `json:"bots"  bson:"bots"`
 	IsActive bool               `json:"is_active"  bson:"is_active"`
 }
 
@@ -32,12 +38,15 @@ type RoomSearch struct {
 	ID       string `query:"id" bson:"_id"`
 	Name     string `query:"name"  bson:"name"`
 	IsActive *bool  `query:"is_active"  bson:"is_active"`
+	Bot      string `query:"bot"  bson:"bots"`
 }
 
 func CreateRoomDTOFromEntity(request Room) RoomDTO {
 	return RoomDTO{
 		ID:       primitive.NewObjectID(),
 		Name:     request.Name,
+		OwnerID:  request.OwnerID,
+		Bots:     []string{},
 		IsActive: true,
 	}
 }
@@ -46,6 +55,19 @@ func CreateRoomEntityFromRoomDTO(DTO RoomDTO) Room {
 	return Room{
 		ID:       DTO.ID.Hex(),
 		Name:     DTO.Name,
+		OwnerID:  DTO.OwnerID,
+		Bots:     DTO.Bots,
 		IsActive: DTO.IsActive,
 	}
 }
+
+// HasBot tells whether the bot is allowed to join the room.
+func (r Room) HasBot(botName string) bool {
+	for _, name := range r.Bots {
+		if name == botName {
+			return true
+		}
+	}
+
+	return false
+}
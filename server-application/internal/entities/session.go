@@ -32,6 +32,14 @@ type SessionAction struct {
 	Type string `json:"type"`
 }
 
+// EventReplay holds the room events a resuming client missed, in sequence order. Complete is false when any of
+// them isn't kept for replay, LastSeq is the room's latest sequence number.
+type EventReplay struct {
+	Frames   [][]byte
+	LastSeq  int64
+	Complete bool
+}
+
 type BotSessionRequest struct {
 	RoomID  string `json:"room_id" validate:"required" query:"room_id"`
 	BotName string `json:"bot_name" validate:"required" query:"bot_name"`
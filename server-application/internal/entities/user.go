@@ -10,6 +10,9 @@ const (
 	UserIDField           = "_id"
 	UsernameField         = "username"
 	UserIsActiveNameField = "is_active"
+
+	// UserContextKey holds the ID of the user the request was authenticated as.
+	UserContextKey = "user_id"
 )
 
 type User struct {
@@ -0,0 +1,76 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/kafka"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	rds "github.com/sebastianreh/chatroom/pkg/redis"
+)
+
+const (
+	KafkaType  = "kafka"
+	MemoryType = "memory"
+	RedisType  = "redis"
+)
+
+// Publisher sends messages to a topic, Publish returns once the broker confirmed the delivery.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, value []byte, headers map[string]string) error
+	Close(ctx context.Context) error
+}
+
+// Subscriber delivers the messages of its topic to process until Close is called, the message being processed
+// at that moment is always finished.
+type Subscriber interface {
+	Listen(process func([]byte)) error
+	Close(ctx context.Context) error
+}
+
+// Broker builds the publisher and the subscribers of the configured broker type.
+type Broker interface {
+	Publisher() (Publisher, error)
+	Subscriber(topic string) (Subscriber, error)
+}
+
+// NewBroker returns the broker selected by BROKER_TYPE. The redis client is only used by the redis broker.
+func NewBroker(cfg config.Config, redis rds.Redis, logger logger.Logger) (Broker, error) {
+	switch cfg.Broker.Type {
+	case KafkaType:
+		return &kafkaBroker{config: cfg, logs: logger}, nil
+	case MemoryType:
+		return NewMemoryBroker(cfg.Broker.Memory.BufferSize), nil
+	case RedisType:
+		return &redisBroker{config: cfg, redis: redis, logs: logger}, nil
+	default:
+		return nil, fmt.Errorf("unknown broker type %q", cfg.Broker.Type)
+	}
+}
+
+type kafkaBroker struct {
+	config config.Config
+	logs   logger.Logger
+}
+
+func (b *kafkaBroker) Publisher() (Publisher, error) {
+	return kafka.NewKafkaProducer(b.config, b.logs)
+}
+
+func (b *kafkaBroker) Subscriber(topic string) (Subscriber, error) {
+	return kafka.NewKafkaConsumer(b.config, topic, b.logs)
+}
+
+type redisBroker struct {
+	config config.Config
+	redis  rds.Redis
+	logs   logger.Logger
+}
+
+func (b *redisBroker) Publisher() (Publisher, error) {
+	return NewRedisPublisher(b.config, b.redis), nil
+}
+
+func (b *redisBroker) Subscriber(topic string) (Subscriber, error) {
+	return NewRedisSubscriber(b.config, b.redis, topic, b.logs)
+}
@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errBrokerClosed = errors.New("the broker is closed")
+
+// MemoryBroker delivers the messages in process, through a buffered channel per topic. It keeps the whole
+// pipeline runnable in tests and on a single process without an external broker.
+type MemoryBroker struct {
+	mutex      sync.Mutex
+	bufferSize int
+	topics     map[string]chan []byte
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func NewMemoryBroker(bufferSize int) *MemoryBroker {
+	return &MemoryBroker{
+		bufferSize: bufferSize,
+		topics:     make(map[string]chan []byte),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (b *MemoryBroker) Publisher() (Publisher, error) {
+	return b, nil
+}
+
+func (b *MemoryBroker) Subscriber(topic string) (Subscriber, error) {
+	return &memorySubscriber{
+		messages:  b.topic(topic),
+		listeners: newListeners(),
+	}, nil
+}
+
+// Publish queues the message on its topic, waiting for room in the buffer until ctx is done. The headers are
+// dropped since subscribers only get the value.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, value []byte, _ map[string]string) error {
+	select {
+	case <-b.closed:
+		return errBrokerClosed
+	default:
+	}
+
+	select {
+	case b.topic(topic) <- value:
+		return nil
+	case <-b.closed:
+		return errBrokerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, the ones already queued are still delivered.
+func (b *MemoryBroker) Close(_ context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+
+	return nil
+}
+
+func (b *MemoryBroker) topic(name string) chan []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	messages, ok := b.topics[name]
+	if !ok {
+		messages = make(chan []byte, b.bufferSize)
+		b.topics[name] = messages
+	}
+
+	return messages
+}
+
+type memorySubscriber struct {
+	messages  chan []byte
+	listeners *listeners
+}
+
+func (s *memorySubscriber) Listen(process func([]byte)) error {
+	if !s.listeners.start() {
+		return nil
+	}
+	defer s.listeners.stop()
+
+	for {
+		select {
+		case <-s.listeners.done:
+			return nil
+		case message := <-s.messages:
+			process(message)
+		}
+	}
+}
+
+func (s *memorySubscriber) Close(ctx context.Context) error {
+	return s.listeners.close(ctx)
+}
@@ -0,0 +1,73 @@
+package broker_test
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/pkg/broker"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_MemoryBroker_Publish(t *testing.T) {
+	t.Run("published message is delivered to the topic subscriber", func(t *testing.T) {
+		memory := broker.NewMemoryBroker(10)
+		subscriber, _ := memory.Subscriber("stocks")
+		publisher, _ := memory.Publisher()
+		received := make(chan []byte, 1)
+		go subscriber.Listen(func(message []byte) {
+			received <- message
+		})
+
+		err := publisher.Publish(context.TODO(), "stocks", []byte("message"), nil)
+
+		assert.NoError(t, err)
+		select {
+		case message := <-received:
+			assert.Equal(t, []byte("message"), message)
+		case <-time.After(time.Second):
+			t.Fatal("message was not delivered")
+		}
+		assert.NoError(t, subscriber.Close(context.TODO()))
+	})
+
+	t.Run("full topic waits until the context is done", func(t *testing.T) {
+		memory := broker.NewMemoryBroker(1)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		assert.NoError(t, memory.Publish(ctx, "stocks", []byte("first"), nil))
+		err := memory.Publish(ctx, "stocks", []byte("second"), nil)
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("closed broker rejects messages", func(t *testing.T) {
+		memory := broker.NewMemoryBroker(1)
+
+		assert.NoError(t, memory.Close(context.TODO()))
+		err := memory.Publish(context.TODO(), "stocks", []byte("message"), nil)
+
+		assert.Error(t, err)
+	})
+}
+
+func Test_MemoryBroker_Close(t *testing.T) {
+	t.Run("listen returns once closed", func(t *testing.T) {
+		memory := broker.NewMemoryBroker(1)
+		subscriber, _ := memory.Subscriber("stocks")
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- subscriber.Listen(func([]byte) {})
+		}()
+
+		err := subscriber.Close(context.TODO())
+
+		assert.NoError(t, err)
+		select {
+		case err = <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("listen did not return")
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	rds "github.com/sebastianreh/chatroom/pkg/redis"
+	"time"
+)
+
+const (
+	// ValueField and HeadersField are the stream entry fields holding the message, bots write the same ones.
+	ValueField   = "value"
+	HeadersField = "headers"
+
+	redisSubscriberName = "pkg.broker.redisSubscriber"
+	readCount           = 10
+)
+
+type redisPublisher struct {
+	redis  rds.Redis
+	maxLen int64
+}
+
+// NewRedisPublisher appends the messages to the Redis stream named after the topic.
+func NewRedisPublisher(cfg config.Config, redis rds.Redis) Publisher {
+	return &redisPublisher{
+		redis:  redis,
+		maxLen: cfg.Broker.Redis.MaxLen,
+	}
+}
+
+func (p *redisPublisher) Publish(ctx context.Context, topic string, value []byte, headers map[string]string) error {
+	values := map[string]interface{}{ValueField: value}
+	if len(headers) > 0 {
+		encoded, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+		values[HeadersField] = encoded
+	}
+
+	return p.redis.StreamAdd(ctx, topic, values, p.maxLen)
+}
+
+// Close is a no-op, the redis client is shared and closed on its own.
+func (p *redisPublisher) Close(_ context.Context) error {
+	return nil
+}
+
+type redisSubscriber struct {
+	redis     rds.Redis
+	stream    string
+	group     string
+	consumer  string
+	block     time.Duration
+	logs      logger.Logger
+	listeners *listeners
+}
+
+// NewRedisSubscriber reads the Redis stream named after the topic as a member of the configured consumer
+// group, so replicas share the messages as they do with a Kafka group.
+func NewRedisSubscriber(cfg config.Config, redis rds.Redis, topic string, logger logger.Logger) (Subscriber, error) {
+	err := redis.StreamCreateGroup(context.Background(), topic, cfg.Broker.Redis.Group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the consumer group: %w", err)
+	}
+
+	return &redisSubscriber{
+		redis:     redis,
+		stream:    topic,
+		group:     cfg.Broker.Redis.Group,
+		consumer:  cfg.Broker.Redis.Consumer,
+		block:     cfg.Broker.Redis.Block,
+		logs:      logger,
+		listeners: newListeners(),
+	}, nil
+}
+
+// Listen acknowledges each entry once processed. Reading errors are returned so the caller decides whether
+// to listen again.
+func (s *redisSubscriber) Listen(process func([]byte)) error {
+	if !s.listeners.start() {
+		return nil
+	}
+	defer s.listeners.stop()
+
+	ctx := context.Background()
+	for {
+		select {
+		case <-s.listeners.done:
+			return nil
+		default:
+		}
+
+		messages, err := s.redis.StreamReadGroup(ctx, s.stream, s.group, s.consumer, readCount, s.block)
+		if err != nil {
+			return fmt.Errorf("failed to read stream: %w", err)
+		}
+
+		for _, message := range messages {
+			process(streamValue(message))
+			if err = s.redis.StreamAck(ctx, s.stream, s.group, message.ID); err != nil {
+				s.logs.Error(fmt.Sprintf("failed to ack entry %s: %s", message.ID, err.Error()), redisSubscriberName)
+			}
+		}
+	}
+}
+
+// Close stops Listen after the entries being processed, it waits up to the read block time.
+func (s *redisSubscriber) Close(ctx context.Context) error {
+	return s.listeners.close(ctx)
+}
+
+func streamValue(message rds.StreamMessage) []byte {
+	switch value := message.Values[ValueField].(type) {
+	case string:
+		return []byte(value)
+	case []byte:
+		return value
+	default:
+		return nil
+	}
+}
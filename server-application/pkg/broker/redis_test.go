@@ -0,0 +1,92 @@
+package broker_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/broker"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	rds "github.com/sebastianreh/chatroom/pkg/redis"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newRedisConfig(t *testing.T) (config.Config, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	configs := config.NewConfig()
+	configs.Redis.Host = server.Addr()
+	configs.Broker.Redis.Block = 50 * time.Millisecond
+	return configs, server
+}
+
+func Test_RedisBroker_Publish(t *testing.T) {
+	logs := logger.NewLogger()
+
+	t.Run("published message is delivered to the group subscriber", func(t *testing.T) {
+		configs, _ := newRedisConfig(t)
+		redis, _ := rds.NewRedis(logs, configs)
+		subscriber, err := broker.NewRedisSubscriber(configs, redis, "stocks", logs)
+		assert.NoError(t, err)
+		publisher := broker.NewRedisPublisher(configs, redis)
+		received := make(chan []byte, 1)
+		go subscriber.Listen(func(message []byte) {
+			received <- message
+		})
+
+		err = publisher.Publish(context.TODO(), "stocks", []byte(`{"room_id":"room1"}`), nil)
+
+		assert.NoError(t, err)
+		select {
+		case message := <-received:
+			assert.Equal(t, `{"room_id":"room1"}`, string(message))
+		case <-time.After(time.Second):
+			t.Fatal("message was not delivered")
+		}
+		assert.NoError(t, subscriber.Close(context.TODO()))
+	})
+
+	t.Run("headers are stored with the entry", func(t *testing.T) {
+		configs, server := newRedisConfig(t)
+		redis, _ := rds.NewRedis(logs, configs)
+		publisher := broker.NewRedisPublisher(configs, redis)
+
+		err := publisher.Publish(context.TODO(), "stocks.dlq", []byte("message"), map[string]string{"attempts": "3"})
+
+		assert.NoError(t, err)
+		entries, _ := server.Stream("stocks.dlq")
+		if assert.Len(t, entries, 1) {
+			values := make(map[string]string)
+			for i := 0; i+1 < len(entries[0].Values); i += 2 {
+				values[entries[0].Values[i]] = entries[0].Values[i+1]
+			}
+			assert.Equal(t, map[string]string{broker.ValueField: "message", broker.HeadersField: `{"attempts":"3"}`},
+				values)
+		}
+	})
+}
+
+func Test_RedisBroker_Close(t *testing.T) {
+	logs := logger.NewLogger()
+
+	t.Run("listen returns once closed", func(t *testing.T) {
+		configs, _ := newRedisConfig(t)
+		redis, _ := rds.NewRedis(logs, configs)
+		subscriber, _ := broker.NewRedisSubscriber(configs, redis, "stocks", logs)
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- subscriber.Listen(func([]byte) {})
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		err := subscriber.Close(context.TODO())
+
+		assert.NoError(t, err)
+		select {
+		case err = <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("listen did not return")
+		}
+	})
+}
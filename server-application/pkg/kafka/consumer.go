@@ -1,22 +1,32 @@
 package kafka
 
 import (
+	"context"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/sebastianreh/chatroom/internal/config"
 	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
 )
 
 type Consumer interface {
 	Listen(process func([]byte)) error
+	Close(ctx context.Context) error
 }
 
 type consumer struct {
 	topic    string
 	listener *kafka.Consumer
+	// mutex orders the Listen calls registering in listening with Close closing done, so no Listen call is
+	// added while Close waits for them.
+	mutex     sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+	listening sync.WaitGroup
 }
 
-func NewKafkaConsumer(cfg config.Config, logger logger.Logger) (Consumer, error) {
+// NewKafkaConsumer returns a consumer of topic.
+func NewKafkaConsumer(cfg config.Config, topic string, logger logger.Logger) (Consumer, error) {
 	kafkaConsumer, err := kafka.NewConsumer(&kafka.ConfigMap{
 		"bootstrap.servers": cfg.Kafka.Server,  // Assuming your config has a Kafka struct with a Server field
 		"group.id":          cfg.Kafka.GroupID, // And a GroupID field
@@ -25,7 +35,8 @@ func NewKafkaConsumer(cfg config.Config, logger logger.Logger) (Consumer, error)
 
 	csr := new(consumer)
 	csr.listener = kafkaConsumer
-	csr.topic = cfg.Kafka.StocksTopic
+	csr.topic = topic
+	csr.done = make(chan struct{})
 
 	if err != nil {
 		logger.Error("failed to create Kafka consumer", err)
@@ -35,11 +46,23 @@ func NewKafkaConsumer(cfg config.Config, logger logger.Logger) (Consumer, error)
 	return csr, nil
 }
 
+// Listen polls the topic until Close is called, the message being processed at that moment is always finished.
 func (c *consumer) Listen(process func([]byte)) error {
+	if !c.startListening() {
+		return nil
+	}
+	defer c.listening.Done()
+
 	if err := c.listener.Subscribe(c.topic, nil); err != nil {
 		return fmt.Errorf("failed to subscribe to topic: %w", err)
 	}
 	for {
+		select {
+		case <-c.done:
+			return nil
+		default:
+		}
+
 		event := c.listener.Poll(100)
 		if event == nil {
 			continue
@@ -53,3 +76,47 @@ func (c *consumer) Listen(process func([]byte)) error {
 		}
 	}
 }
+
+// Close stops Listen, waits for the in-flight message, commits the processed offsets and closes the consumer.
+func (c *consumer) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	c.mutex.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.listening.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if _, err := c.listener.Commit(); err != nil {
+		if kafkaErr, ok := err.(kafka.Error); !ok || kafkaErr.Code() != kafka.ErrNoOffset {
+			return fmt.Errorf("failed to commit offsets: %w", err)
+		}
+	}
+
+	return c.listener.Close()
+}
+
+// startListening registers a Listen call, it returns false once the consumer is closed.
+func (c *consumer) startListening() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	c.listening.Add(1)
+	return true
+}
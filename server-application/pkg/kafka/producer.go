@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"time"
+)
+
+const producerName = "pkg.kafka.producer"
+
+type Producer interface {
+	Publish(ctx context.Context, topic string, value []byte, headers map[string]string) error
+	Close(ctx context.Context) error
+}
+
+type producer struct {
+	client *kafka.Producer
+	logs   logger.Logger
+}
+
+func NewKafkaProducer(cfg config.Config, logger logger.Logger) (Producer, error) {
+	client, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": cfg.Kafka.Server,
+	})
+	if err != nil {
+		logger.Error("failed to create Kafka producer", err)
+		return nil, err
+	}
+
+	p := &producer{
+		client: client,
+		logs:   logger,
+	}
+	go p.logEvents()
+
+	return p, nil
+}
+
+// Publish produces the message and waits for its delivery report.
+func (p *producer) Publish(ctx context.Context, topic string, value []byte, headers map[string]string) error {
+	message := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Value:          value,
+	}
+	for key, headerValue := range headers {
+		message.Headers = append(message.Headers, kafka.Header{Key: key, Value: []byte(headerValue)})
+	}
+
+	deliveries := make(chan kafka.Event, 1)
+	if err := p.client.Produce(message, deliveries); err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+
+	select {
+	case event := <-deliveries:
+		delivered, ok := event.(*kafka.Message)
+		if !ok {
+			return fmt.Errorf("unexpected delivery event: %s", event.String())
+		}
+		return delivered.TopicPartition.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes the queued messages until ctx is done and closes the client.
+func (p *producer) Close(ctx context.Context) error {
+	timeout := time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	remaining := p.client.Flush(int(timeout.Milliseconds()))
+	p.client.Close()
+	if remaining > 0 {
+		return fmt.Errorf("%d messages were not delivered before closing the producer", remaining)
+	}
+
+	return nil
+}
+
+func (p *producer) logEvents() {
+	for event := range p.client.Events() {
+		if err, ok := event.(kafka.Error); ok {
+			p.logs.Error(err.Error(), producerName+".logEvents")
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kafka
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy runs the processing of a message up to MaxAttempts times, waiting Backoff after the first
+// failure and doubling it on each following one.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// Run calls process until it succeeds or runs out of attempts. It returns the attempts made and the last error.
+func (p RetryPolicy) Run(ctx context.Context, process func() error) (int, error) {
+	backoff := p.Backoff
+	attempts := 0
+	for {
+		attempts++
+		err := process()
+		if err == nil || attempts >= p.MaxAttempts {
+			return attempts, err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return attempts, err
+		}
+		backoff *= 2
+	}
+}
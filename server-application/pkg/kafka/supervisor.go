@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"sync"
+	"time"
+)
+
+const (
+	supervisorName = "pkg.kafka.supervisor"
+
+	RunningStatus    = "running"
+	RestartingStatus = "restarting"
+	StoppedStatus    = "stopped"
+	FailedStatus     = "failed"
+)
+
+// Health is the state of a supervised consumer, LastError is the error that caused the latest restart.
+type Health struct {
+	Status      string     `json:"status"`
+	Restarts    int        `json:"restarts"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+func (h Health) IsHealthy() bool {
+	return h.Status == RunningStatus || h.Status == RestartingStatus
+}
+
+type SupervisedConsumer interface {
+	Consumer
+	Health() Health
+}
+
+// supervisor decorates a consumer so Listen keeps consuming across failures: retriable errors restart the
+// consumer with an exponential backoff, fatal ones stop it. The backoff is reset once a message is processed.
+type supervisor struct {
+	Consumer
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxRestarts    int
+	done           chan struct{}
+	closeOnce      sync.Once
+	healthMutex    sync.RWMutex
+	health         Health
+	logs           logger.Logger
+}
+
+func NewSupervisedConsumer(cfg config.Config, consumer Consumer, logger logger.Logger) SupervisedConsumer {
+	return &supervisor{
+		Consumer:       consumer,
+		initialBackoff: cfg.Kafka.Restart.InitialBackoff,
+		maxBackoff:     cfg.Kafka.Restart.MaxBackoff,
+		maxRestarts:    cfg.Kafka.Restart.MaxRestarts,
+		done:           make(chan struct{}),
+		health:         Health{Status: StoppedStatus},
+		logs:           logger,
+	}
+}
+
+// Listen blocks until Close is called or the consumer fails for good, in which case the error is returned.
+func (s *supervisor) Listen(process func([]byte)) error {
+	backoff := s.initialBackoff
+	var processedMutex sync.Mutex
+	processed := false
+	supervised := func(message []byte) {
+		process(message)
+		processedMutex.Lock()
+		processed = true
+		processedMutex.Unlock()
+	}
+
+	for {
+		s.setStatus(RunningStatus)
+		err := s.Consumer.Listen(supervised)
+		if s.closed() || err == nil {
+			s.setStatus(StoppedStatus)
+			return nil
+		}
+
+		restarts := s.recordError(err)
+		if IsFatal(err) {
+			s.setStatus(FailedStatus)
+			s.logs.Error(fmt.Sprintf("consumer stopped on fatal error: %s", err.Error()), supervisorName+".Listen")
+			return err
+		}
+
+		if s.maxRestarts > 0 && restarts > s.maxRestarts {
+			s.setStatus(FailedStatus)
+			err = fmt.Errorf("consumer gave up after %d restarts: %w", s.maxRestarts, err)
+			s.logs.Error(err.Error(), supervisorName+".Listen")
+			return err
+		}
+
+		processedMutex.Lock()
+		if processed {
+			backoff = s.initialBackoff
+			processed = false
+		}
+		processedMutex.Unlock()
+
+		s.setStatus(RestartingStatus)
+		s.logs.Warn(fmt.Sprintf("restarting consumer in %s after error: %s", backoff, err.Error()),
+			supervisorName+".Listen")
+
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			s.setStatus(StoppedStatus)
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+func (s *supervisor) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return s.Consumer.Close(ctx)
+}
+
+func (s *supervisor) Health() Health {
+	s.healthMutex.RLock()
+	defer s.healthMutex.RUnlock()
+	return s.health
+}
+
+func (s *supervisor) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *supervisor) setStatus(status string) {
+	s.healthMutex.Lock()
+	s.health.Status = status
+	s.healthMutex.Unlock()
+}
+
+func (s *supervisor) recordError(err error) int {
+	now := time.Now().UTC()
+	s.healthMutex.Lock()
+	defer s.healthMutex.Unlock()
+	s.health.Restarts++
+	s.health.LastError = err.Error()
+	s.health.LastErrorAt = &now
+	return s.health.Restarts
+}
+
+// IsFatal classifies consumer errors: authentication, authorization and configuration errors, as well as the
+// errors flagged fatal by the client, can't be fixed by restarting. Any other error is considered retriable.
+func IsFatal(err error) bool {
+	var kafkaErr kafka.Error
+	if !errors.As(err, &kafkaErr) {
+		return false
+	}
+
+	if kafkaErr.IsFatal() {
+		return true
+	}
+
+	switch kafkaErr.Code() {
+	case kafka.ErrAuthentication, kafka.ErrSaslAuthenticationFailed, kafka.ErrTopicAuthorizationFailed,
+		kafka.ErrGroupAuthorizationFailed, kafka.ErrInvalidArg:
+		return true
+	default:
+		return false
+	}
+}
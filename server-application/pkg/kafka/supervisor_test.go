@@ -0,0 +1,165 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	confluent "github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/kafka"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsumer fails its first listens with the given errors, then delivers its messages and blocks until closed.
+type fakeConsumer struct {
+	mutex    sync.Mutex
+	failures []error
+	messages [][]byte
+	listens  int
+	done     chan struct{}
+}
+
+func newFakeConsumer(failures []error, messages ...[]byte) *fakeConsumer {
+	return &fakeConsumer{failures: failures, messages: messages, done: make(chan struct{})}
+}
+
+func (f *fakeConsumer) Listen(process func([]byte)) error {
+	f.mutex.Lock()
+	f.listens++
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		f.mutex.Unlock()
+		return err
+	}
+	messages := f.messages
+	f.messages = nil
+	f.mutex.Unlock()
+
+	for _, message := range messages {
+		process(message)
+	}
+	<-f.done
+	return nil
+}
+
+func (f *fakeConsumer) Close(_ context.Context) error {
+	close(f.done)
+	return nil
+}
+
+func (f *fakeConsumer) Listens() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.listens
+}
+
+func newSupervisorConfig() config.Config {
+	configs := config.NewConfig()
+	configs.Kafka.Restart.InitialBackoff = time.Millisecond
+	configs.Kafka.Restart.MaxBackoff = 5 * time.Millisecond
+	configs.Kafka.Restart.MaxRestarts = 0
+	return configs
+}
+
+func Test_Supervisor_Listen(t *testing.T) {
+	logs := logger.NewLogger()
+	topicNotAvailable := confluent.NewError(confluent.ErrUnknownTopicOrPart, "Subscribed topic not available", false)
+
+	t.Run("retriable errors restart the consumer until it recovers", func(t *testing.T) {
+		fake := newFakeConsumer([]error{topicNotAvailable, topicNotAvailable, errors.New("connection reset")},
+			[]byte("message"))
+		consumer := kafka.NewSupervisedConsumer(newSupervisorConfig(), fake, logs)
+		received := make(chan []byte, 1)
+		stopped := make(chan error, 1)
+
+		go func() {
+			stopped <- consumer.Listen(func(message []byte) {
+				received <- message
+			})
+		}()
+
+		select {
+		case message := <-received:
+			assert.Equal(t, "message", string(message))
+		case <-time.After(time.Second):
+			t.Fatal("consumer did not recover")
+		}
+		assert.Equal(t, 4, fake.Listens())
+		health := consumer.Health()
+		assert.Equal(t, kafka.RunningStatus, health.Status)
+		assert.Equal(t, 3, health.Restarts)
+		assert.Equal(t, "connection reset", health.LastError)
+
+		assert.NoError(t, consumer.Close(context.Background()))
+		assert.NoError(t, <-stopped)
+		assert.Equal(t, kafka.StoppedStatus, consumer.Health().Status)
+	})
+
+	t.Run("fatal error stops the consumer", func(t *testing.T) {
+		authentication := confluent.NewError(confluent.ErrSaslAuthenticationFailed, "authentication failed", false)
+		fake := newFakeConsumer([]error{topicNotAvailable, authentication})
+		consumer := kafka.NewSupervisedConsumer(newSupervisorConfig(), fake, logs)
+
+		err := consumer.Listen(func([]byte) {})
+
+		assert.ErrorIs(t, err, authentication)
+		assert.Equal(t, 2, fake.Listens())
+		assert.Equal(t, kafka.FailedStatus, consumer.Health().Status)
+		assert.False(t, consumer.Health().IsHealthy())
+	})
+
+	t.Run("consumer gives up after the maximum restarts", func(t *testing.T) {
+		failures := make([]error, 10)
+		for i := range failures {
+			failures[i] = topicNotAvailable
+		}
+		configs := newSupervisorConfig()
+		configs.Kafka.Restart.MaxRestarts = 3
+		fake := newFakeConsumer(failures)
+		consumer := kafka.NewSupervisedConsumer(configs, fake, logs)
+
+		err := consumer.Listen(func([]byte) {})
+
+		assert.Error(t, err)
+		assert.Equal(t, 4, fake.Listens())
+		assert.Equal(t, kafka.FailedStatus, consumer.Health().Status)
+	})
+
+	t.Run("close interrupts the backoff", func(t *testing.T) {
+		configs := newSupervisorConfig()
+		configs.Kafka.Restart.InitialBackoff = time.Hour
+		configs.Kafka.Restart.MaxBackoff = time.Hour
+		fake := newFakeConsumer([]error{topicNotAvailable})
+		consumer := kafka.NewSupervisedConsumer(configs, fake, logs)
+		stopped := make(chan error, 1)
+
+		go func() {
+			stopped <- consumer.Listen(func([]byte) {})
+		}()
+		assert.Eventually(t, func() bool {
+			return consumer.Health().Status == kafka.RestartingStatus
+		}, time.Second, time.Millisecond)
+
+		assert.NoError(t, consumer.Close(context.Background()))
+
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("close did not stop the supervisor")
+		}
+	})
+}
+
+func Test_IsFatal(t *testing.T) {
+	t.Run("classifies consumer errors", func(t *testing.T) {
+		assert.False(t, kafka.IsFatal(errors.New("connection reset")))
+		assert.False(t, kafka.IsFatal(confluent.NewError(confluent.ErrAllBrokersDown, "all brokers down", false)))
+		assert.True(t, kafka.IsFatal(confluent.NewError(confluent.ErrTransport, "fatal transport", true)))
+		assert.True(t, kafka.IsFatal(confluent.NewError(confluent.ErrTopicAuthorizationFailed, "not allowed", false)))
+	})
+}
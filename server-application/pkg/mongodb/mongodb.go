@@ -24,6 +24,7 @@ type MongoDBier interface {
 	PrepareData(ctx context.Context, collection string, documents ...interface{}) []primitive.ObjectID
 	ClearCollection(ctx context.Context, collection string)
 	PrepareCollectionWithTTL(ctx context.Context, collection string)
+	Close(ctx context.Context) error
 }
 
 type MongoDB struct {
@@ -57,6 +58,10 @@ func (d *MongoDB) Collection(name string) *mongo.Collection {
 	return d.client.Database(d.config.MongoDB.Database).Collection(name)
 }
 
+func (d *MongoDB) Close(ctx context.Context) error {
+	return d.client.Disconnect(ctx)
+}
+
 func (d *MongoDB) CleanCollectionByIds(ctx context.Context, collection string, ids ...primitive.ObjectID) {
 	for i := range ids {
 		d.Collection(collection).DeleteOne(ctx, bson.M{"_id": ids[i]})
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/sebastianreh/chatroom/internal/config"
 	"github.com/sebastianreh/chatroom/pkg/logger"
+	"strings"
 	"time"
 
 	rd "github.com/go-redis/redis/v8"
@@ -18,6 +19,23 @@ const (
 type Redis interface {
 	Set(ctx context.Context, key string, value any, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
+	SetIfAbsent(ctx context.Context, key string, value any, ttl time.Duration) (bool, error)
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	ListAppend(ctx context.Context, key string, value any, maxLen int64, ttl time.Duration) error
+	ListRange(ctx context.Context, key string) ([]string, error)
+	Publish(ctx context.Context, channel string, message []byte) error
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+	StreamAdd(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) error
+	StreamCreateGroup(ctx context.Context, stream, group string) error
+	StreamReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration) ([]StreamMessage, error)
+	StreamAck(ctx context.Context, stream, group string, ids ...string) error
+	Close() error
+}
+
+// StreamMessage is an entry read from a stream.
+type StreamMessage struct {
+	ID     string
+	Values map[string]interface{}
 }
 
 type redis struct {
@@ -25,7 +43,7 @@ type redis struct {
 }
 
 func NewRedis(log logger.Logger, cfg config.Config) (Redis, error) {
-	client := buildClient()
+	client := buildClient(cfg)
 	if client == nil {
 		return nil, errors.New("error, connecting to redis server")
 	}
@@ -43,8 +61,9 @@ func NewRedis(log logger.Logger, cfg config.Config) (Redis, error) {
 	}, nil
 }
 
-func buildClient() *rd.Client {
+func buildClient(cfg config.Config) *rd.Client {
 	var options = &rd.Options{
+		Addr:     cfg.Redis.Host,
 		PoolSize: 1000,
 		OnConnect: func(ctx context.Context, cn *rd.Conn) error {
 			return ctx.Err()
@@ -74,3 +93,138 @@ func (r *redis) Get(ctx context.Context, key string) (string, error) {
 
 	return status.Val(), nil
 }
+
+// SetIfAbsent sets the key only when it doesn't exist, it returns false when it already did.
+func (r *redis) SetIfAbsent(ctx context.Context, key string, value any, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *redis) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return incr.Val(), nil
+}
+
+// ListAppend pushes value at the end of the list and keeps only its last maxLen elements.
+func (r *redis) ListAppend(ctx context.Context, key string, value any, maxLen int64, ttl time.Duration) error {
+	pipe := r.client.TxPipeline()
+	pipe.RPush(ctx, key, value)
+	pipe.LTrim(ctx, key, -maxLen, -1)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redis) ListRange(ctx context.Context, key string) ([]string, error) {
+	status := r.client.LRange(ctx, key, 0, -1)
+	if status.Err() != nil && status.Err() != rd.Nil {
+		return nil, status.Err()
+	}
+
+	return status.Val(), nil
+}
+
+func (r *redis) Publish(ctx context.Context, channel string, message []byte) error {
+	status := r.client.Publish(ctx, channel, message)
+	if status.Err() != nil {
+		return status.Err()
+	}
+
+	return nil
+}
+
+// Subscribe returns once the subscription is confirmed by the server. The returned channel is closed when
+// ctx is done or the subscription is lost.
+func (r *redis) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	pubSub := r.client.Subscribe(ctx, channel)
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return nil, err
+	}
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		defer pubSub.Close()
+		redisMessages := pubSub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-redisMessages:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- []byte(message.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// StreamAdd appends the entry to the stream, which is trimmed to approximately maxLen entries.
+func (r *redis) StreamAdd(ctx context.Context, stream string, values map[string]interface{}, maxLen int64) error {
+	return r.client.XAdd(ctx, &rd.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+// StreamCreateGroup creates the consumer group, and the stream when missing, reading only new entries. An
+// existing group is left untouched.
+func (r *redis) StreamCreateGroup(ctx context.Context, stream, group string) error {
+	err := r.client.XGroupCreateMkStream(ctx, stream, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	return nil
+}
+
+// StreamReadGroup reads up to count entries never delivered to the group, waiting up to block for them. No
+// entries and no error are returned when the wait times out.
+func (r *redis) StreamReadGroup(ctx context.Context, stream, group, consumer string, count int64,
+	block time.Duration) ([]StreamMessage, error) {
+	streams, err := r.client.XReadGroup(ctx, &rd.XReadGroupArgs{
+		Group:    group,
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if err == rd.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, entries := range streams {
+		for _, entry := range entries.Messages {
+			messages = append(messages, StreamMessage{ID: entry.ID, Values: entry.Values})
+		}
+	}
+
+	return messages, nil
+}
+
+func (r *redis) StreamAck(ctx context.Context, stream, group string, ids ...string) error {
+	return r.client.XAck(ctx, stream, group, ids...).Err()
+}
+
+func (r *redis) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"errors"
+	ws "github.com/gorilla/websocket"
+	"sort"
+	"sync"
+)
+
+var errClientClosed = errors.New("socket is closed")
+
+type SocketOption func(*Client)
+
+// WithHeldDelivery registers the socket with live delivery on hold: broadcasts are kept aside until Resume
+// is called, so missed events can be replayed first.
+func WithHeldDelivery() SocketOption {
+	return func(c *Client) {
+		c.holdMutex.Lock()
+		c.holding = true
+		c.holdMutex.Unlock()
+	}
+}
+
+// Client is a registered subscriber of a group. Writes never touch the connection directly, they are queued
+// in send and flushed by the client's own writer goroutine so a slow peer cannot block the rest of the room.
+// Clients created through Subscribe have no socket: their owner drains Messages itself, which is how the
+// SSE and long-poll transports share the hub delivery. Clients created through Connect are multiplexed: they
+// start without groups and Join or Leave them over the same connection.
+type Client struct {
+	conn        *ws.Conn
+	format      codec
+	userID      string
+	multiplexed bool
+	groupsMutex sync.Mutex
+	groups      map[string]bool
+	send        chan []byte
+	done        chan struct{}
+	closeOnce   sync.Once
+	holdMutex   sync.Mutex
+	holding     bool
+	held        [][]byte
+}
+
+func newClient(conn *ws.Conn, userID string, queueSize int, opts ...SocketOption) *Client {
+	client := &Client{
+		conn:   conn,
+		format: jsonFormat,
+		userID: userID,
+		groups: make(map[string]bool),
+		send:   make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	if conn != nil {
+		client.format = codecFor(conn.Subprotocol())
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// ReadMessage reads the next frame of the socket, binary frames are decoded from the negotiated format so
+// callers always get JSON.
+func (c *Client) ReadMessage() (int, []byte, error) {
+	msgType, msg, err := c.conn.ReadMessage()
+	if err != nil || msgType != ws.BinaryMessage {
+		return msgType, msg, err
+	}
+
+	msg, err = c.format.decode(msg)
+	return msgType, msg, err
+}
+
+// Messages returns the outbound queue of a client created through Subscribe.
+func (c *Client) Messages() <-chan []byte {
+	return c.send
+}
+
+// Groups returns the groups the client is subscribed to, a released client keeps the groups it had when it
+// was disconnected.
+func (c *Client) Groups() []string {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	groups := make([]string, 0, len(c.groups))
+	for groupID := range c.groups {
+		groups = append(groups, groupID)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// InGroup reports whether the client is subscribed to the group.
+func (c *Client) InGroup(groupID string) bool {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	return c.groups[groupID]
+}
+
+func (c *Client) join(groupID string) {
+	c.groupsMutex.Lock()
+	c.groups[groupID] = true
+	c.groupsMutex.Unlock()
+}
+
+// leave removes the group from the client, it returns false when the client was not subscribed to it.
+func (c *Client) leave(groupID string) bool {
+	c.groupsMutex.Lock()
+	defer c.groupsMutex.Unlock()
+	if !c.groups[groupID] {
+		return false
+	}
+	delete(c.groups, groupID)
+	return true
+}
+
+// Done is closed once the client is closed or evicted.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// enqueue adds a message to the outbound queue without blocking, it returns false when the queue is full
+// or the client is already closed.
+func (c *Client) enqueue(message []byte) bool {
+	c.holdMutex.Lock()
+	if c.holding {
+		defer c.holdMutex.Unlock()
+		if len(c.held) >= cap(c.send) {
+			return false
+		}
+		c.held = append(c.held, message)
+		return true
+	}
+	c.holdMutex.Unlock()
+
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// push waits for room in the outbound queue, it is only used by the socket's own handler while resuming.
+func (c *Client) push(message []byte) error {
+	select {
+	case c.send <- message:
+		return nil
+	case <-c.done:
+		return errClientClosed
+	}
+}
+
+// release takes the messages held so far, it switches the socket to live delivery once nothing is left.
+func (c *Client) release() [][]byte {
+	c.holdMutex.Lock()
+	defer c.holdMutex.Unlock()
+	held := c.held
+	c.held = nil
+	if len(held) == 0 {
+		c.holding = false
+	}
+	return held
+}
+
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
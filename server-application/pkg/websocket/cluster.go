@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+)
+
+const clusterName = "pkg.websocket.cluster"
+
+// Bus carries room broadcasts between server instances, pkg/redis implements it with pub/sub.
+type Bus interface {
+	Publish(ctx context.Context, channel string, message []byte) error
+	Subscribe(ctx context.Context, channel string) (<-chan []byte, error)
+}
+
+// RelayError is returned by BroadCastMessage when the message was delivered to the local sockets but could not be
+// relayed to the other instances. Retrying it through Relay doesn't deliver it locally twice.
+type RelayError struct {
+	Err error
+}
+
+func (e RelayError) Error() string {
+	return fmt.Sprintf("message delivered locally but not relayed to the cluster: %s", e.Err.Error())
+}
+
+func (e RelayError) Unwrap() error {
+	return e.Err
+}
+
+// clusterMessage is a broadcast to the group, or a message to the sockets of UserID in the group when it is set.
+type clusterMessage struct {
+	Origin  string `json:"origin"`
+	GroupID string `json:"group_id"`
+	UserID  string `json:"user_id,omitempty"`
+	Message []byte `json:"message"`
+}
+
+// cluster decorates the local hub so broadcasts reach the sockets held by every instance. Messages are
+// delivered locally right away and published to the bus, instances skip the messages they published.
+type cluster struct {
+	Websocket
+	bus        Bus
+	channel    string
+	instanceID string
+	logs       logger.Logger
+}
+
+func NewClusterWebsocket(cfg config.Config, logger logger.Logger, local Websocket, bus Bus) (Websocket, error) {
+	instanceID, err := newInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cluster{
+		Websocket:  local,
+		bus:        bus,
+		channel:    cfg.Cluster.Channel,
+		instanceID: instanceID,
+		logs:       logger,
+	}
+
+	messages, err := bus.Subscribe(context.Background(), c.channel)
+	if err != nil {
+		return nil, err
+	}
+	go c.deliver(messages)
+
+	return c, nil
+}
+
+func (c *cluster) BroadCastMessage(message []byte, groupID string) error {
+	if err := c.Websocket.BroadCastMessage(message, groupID); err != nil {
+		return err
+	}
+
+	if err := c.Relay(message, groupID); err != nil {
+		return RelayError{Err: err}
+	}
+
+	return nil
+}
+
+// Relay publishes the message to the other instances only.
+func (c *cluster) Relay(message []byte, groupID string) error {
+	return c.publish(clusterMessage{
+		Origin:  c.instanceID,
+		GroupID: groupID,
+		Message: message,
+	})
+}
+
+// SendMessageToUser sends the message to the sockets of the user in the group held by every instance. It only
+// fails when the message can't be relayed and the user has no socket on this instance.
+func (c *cluster) SendMessageToUser(message []byte, groupID, userID string) error {
+	err := c.Websocket.SendMessageToUser(message, groupID, userID)
+	if err != nil && !errors.Is(err, errNoUserSockets) {
+		return err
+	}
+
+	relayErr := c.publish(clusterMessage{
+		Origin:  c.instanceID,
+		GroupID: groupID,
+		UserID:  userID,
+		Message: message,
+	})
+	if relayErr == nil {
+		return nil
+	}
+
+	if err != nil {
+		return relayErr
+	}
+	return RelayError{Err: relayErr}
+}
+
+func (c *cluster) publish(message clusterMessage) error {
+	messageBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return c.bus.Publish(context.Background(), c.channel, messageBytes)
+}
+
+func (c *cluster) deliver(messages <-chan []byte) {
+	for messageBytes := range messages {
+		var message clusterMessage
+		if err := json.Unmarshal(messageBytes, &message); err != nil {
+			c.logs.Error(fmt.Sprintf("invalid cluster message: %s", err.Error()), clusterName+".deliver")
+			continue
+		}
+
+		if message.Origin == c.instanceID {
+			continue
+		}
+
+		if message.UserID != "" {
+			err := c.Websocket.SendMessageToUser(message.Message, message.GroupID, message.UserID)
+			if err != nil && !errors.Is(err, errNoUserSockets) {
+				c.logs.Error(err.Error(), clusterName+".deliver")
+			}
+			continue
+		}
+
+		if err := c.Websocket.BroadCastMessage(message.Message, message.GroupID); err != nil {
+			c.logs.Error(err.Error(), clusterName+".deliver")
+		}
+	}
+
+	c.logs.Warn("cluster subscription closed, broadcasts from other instances are no longer delivered",
+		clusterName+".deliver")
+}
+
+func newInstanceID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,129 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_ClusterWebsocket_BroadCastMessage(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("broadcast reaches sockets on every instance exactly once", func(t *testing.T) {
+		bus := websocket.NewMemoryBus()
+		hubA, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), bus)
+		assert.NoError(t, err)
+		hubB, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), bus)
+		assert.NoError(t, err)
+		serverA := newHubServer(hubA)
+		defer serverA.Close()
+		serverB := newHubServer(hubB)
+		defer serverB.Close()
+
+		connA := dial(t, serverA, "room1", "user1")
+		defer connA.Close()
+		connB := dial(t, serverB, "room1", "user2")
+		defer connB.Close()
+		otherRoom := dial(t, serverB, "room2", "user3")
+		defer otherRoom.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hubA.BroadCastMessage([]byte("first"), "room1"))
+		assert.NoError(t, hubB.BroadCastMessage([]byte("second"), "room1"))
+
+		for _, conn := range []*ws.Conn{connA, connB} {
+			var received []string
+			for i := 0; i < 2; i++ {
+				_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, message, err := conn.ReadMessage()
+				assert.NoError(t, err)
+				received = append(received, string(message))
+			}
+			assert.ElementsMatch(t, []string{"first", "second"}, received)
+
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, _, err = conn.ReadMessage()
+			assert.Error(t, err, "message delivered more than once")
+		}
+
+		_ = otherRoom.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err = otherRoom.ReadMessage()
+		assert.Error(t, err, "message delivered to another room")
+	})
+
+	t.Run("bus failure after the local delivery is a relay error", func(t *testing.T) {
+		hub, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), failingBus{})
+		assert.NoError(t, err)
+		subscriber := hub.Subscribe("room1", "user1")
+
+		err = hub.BroadCastMessage([]byte("first"), "room1")
+
+		var relayErr websocket.RelayError
+		assert.ErrorAs(t, err, &relayErr)
+		assert.Len(t, subscriber.Messages(), 1)
+		assert.Error(t, hub.Relay([]byte("first"), "room1"))
+		assert.Len(t, subscriber.Messages(), 1)
+	})
+}
+
+func Test_ClusterWebsocket_SendMessageToUser(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("message reaches the sockets of the user on every instance only", func(t *testing.T) {
+		bus := websocket.NewMemoryBus()
+		hubA, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), bus)
+		assert.NoError(t, err)
+		hubB, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), bus)
+		assert.NoError(t, err)
+		target := hubB.Subscribe("room1", "user1")
+		other := hubB.Subscribe("room1", "user2")
+
+		assert.NoError(t, hubA.SendMessageToUser([]byte("bot did not respond"), "room1", "user1"))
+
+		select {
+		case message := <-target.Messages():
+			assert.Equal(t, "bot did not respond", string(message))
+		case <-time.After(2 * time.Second):
+			t.Fatal("message was not relayed to the user")
+		}
+		assert.Empty(t, other.Messages())
+	})
+
+	t.Run("bus failure is an error when the user has no local socket", func(t *testing.T) {
+		hub, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), failingBus{})
+		assert.NoError(t, err)
+
+		assert.Error(t, hub.SendMessageToUser([]byte("bot did not respond"), "room1", "user1"))
+	})
+
+	t.Run("bus failure after the local delivery is a relay error", func(t *testing.T) {
+		hub, err := websocket.NewClusterWebsocket(configs, logs, websocket.NewWebsocket(configs, logs), failingBus{})
+		assert.NoError(t, err)
+		target := hub.Subscribe("room1", "user1")
+
+		err = hub.SendMessageToUser([]byte("bot did not respond"), "room1", "user1")
+
+		var relayErr websocket.RelayError
+		assert.ErrorAs(t, err, &relayErr)
+		assert.Len(t, target.Messages(), 1)
+	})
+}
+
+// failingBus subscribes but can't publish, like a Redis server going away.
+type failingBus struct{}
+
+func (failingBus) Publish(context.Context, string, []byte) error {
+	return errors.New("bus unavailable")
+}
+
+func (failingBus) Subscribe(context.Context, string) (<-chan []byte, error) {
+	return make(chan []byte), nil
+}
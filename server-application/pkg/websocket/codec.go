@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	ws "github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	JSONSubprotocol        = "chatroom.json"
+	MessagePackSubprotocol = "chatroom.msgpack"
+	// LegacySubprotocol is negotiated by the clients predating the envelopes, they receive the bare payloads.
+	LegacySubprotocol = "chatroom.legacy"
+)
+
+// codec translates frames between the JSON used inside the server and the wire format negotiated by a socket
+// through the websocket subprotocol.
+type codec interface {
+	messageType() int
+	encode(frame []byte) ([]byte, error)
+	decode(frame []byte) ([]byte, error)
+}
+
+var (
+	jsonFormat        codec = jsonCodec{}
+	messagePackFormat codec = messagePackCodec{}
+	legacyFormat      codec = legacyCodec{}
+)
+
+func codecFor(subprotocol string) codec {
+	switch subprotocol {
+	case MessagePackSubprotocol:
+		return messagePackFormat
+	case LegacySubprotocol:
+		return legacyFormat
+	}
+	return jsonFormat
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) messageType() int {
+	return ws.TextMessage
+}
+
+func (jsonCodec) encode(frame []byte) ([]byte, error) {
+	return frame, nil
+}
+
+func (jsonCodec) decode(frame []byte) ([]byte, error) {
+	return frame, nil
+}
+
+// legacyCodec unwraps the outbound envelopes, sending their payload in the raw ChatMessage, SessionAction and
+// BotMessage shapes the clients used before the envelopes. Inbound frames are already accepted in those shapes.
+type legacyCodec struct{}
+
+func (legacyCodec) messageType() int {
+	return ws.TextMessage
+}
+
+func (legacyCodec) encode(frame []byte) ([]byte, error) {
+	var envelope struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(frame, &envelope); err != nil {
+		return nil, err
+	}
+
+	if len(envelope.Payload) == 0 {
+		return frame, nil
+	}
+	return envelope.Payload, nil
+}
+
+func (legacyCodec) decode(frame []byte) ([]byte, error) {
+	return frame, nil
+}
+
+type messagePackCodec struct{}
+
+func (messagePackCodec) messageType() int {
+	return ws.BinaryMessage
+}
+
+func (messagePackCodec) encode(frame []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(normalizeNumbers(value))
+}
+
+func (messagePackCodec) decode(frame []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(frame, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// normalizeNumbers turns the json numbers into integers whenever possible, so sequence numbers and counters
+// are packed as msgpack integers instead of floats.
+func normalizeNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalizeNumbers(item)
+		}
+	case json.Number:
+		if integer, err := typed.Int64(); err == nil {
+			return integer
+		}
+		float, _ := typed.Float64()
+		return float
+	}
+	return value
+}
@@ -0,0 +1,181 @@
+package websocket_test
+
+import (
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const benchmarkFrame = `{"type":"chat_message","version":1,"id":"652f1c0e8b3e4a1d2c3b4a59","seq":42,` +
+	`"room_id":"652f1bf58b3e4a1d2c3b4a58","payload":{"content":"hello everyone in the room","user_id":"id123",` +
+	`"username":"User1","created_at":"2023-10-18T10:00:00Z"},"timestamp":"2023-10-18T10:00:00Z"}`
+
+func dialWithSubprotocol(tb testing.TB, server *httptest.Server, roomID, userID, subprotocol string) *ws.Conn {
+	url := fmt.Sprintf("ws%s?room_id=%s&user_id=%s", strings.TrimPrefix(server.URL, "http"), roomID, userID)
+	dialer := ws.Dialer{Subprotocols: []string{subprotocol}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return conn
+}
+
+func Test_Websocket_Subprotocol(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("messagepack socket receives binary frames", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		binary := dialWithSubprotocol(t, server, "room1", "user1", websocket.MessagePackSubprotocol)
+		defer binary.Close()
+		text := dialWithSubprotocol(t, server, "room1", "user2", websocket.JSONSubprotocol)
+		defer text.Close()
+		assert.Equal(t, websocket.MessagePackSubprotocol, binary.Subprotocol())
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.BroadCastMessage([]byte(benchmarkFrame), "room1"))
+
+		msgType, message, err := binary.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, ws.BinaryMessage, msgType)
+		var frame map[string]interface{}
+		assert.NoError(t, msgpack.Unmarshal(message, &frame))
+		assert.Equal(t, "chat_message", frame["type"])
+		assert.EqualValues(t, 42, frame["seq"])
+		assert.Equal(t, "hello everyone in the room", frame["payload"].(map[string]interface{})["content"])
+
+		msgType, message, err = text.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, ws.TextMessage, msgType)
+		assert.Equal(t, benchmarkFrame, string(message))
+	})
+
+	t.Run("binary frames sent by the client are read as json", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		received := make(chan []byte, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			socket, err := hub.GetSocket(w, r, "room1", "user1")
+			if err != nil {
+				return
+			}
+			_, message, _ := socket.ReadMessage()
+			received <- message
+			hub.Release(socket)
+		}))
+		defer server.Close()
+
+		conn := dialWithSubprotocol(t, server, "room1", "user1", websocket.MessagePackSubprotocol)
+		defer conn.Close()
+		frame, err := msgpack.Marshal(map[string]interface{}{"type": "chat_message", "version": 1})
+		assert.NoError(t, err)
+		assert.NoError(t, conn.WriteMessage(ws.BinaryMessage, frame))
+
+		select {
+		case message := <-received:
+			assert.JSONEq(t, `{"type":"chat_message","version":1}`, string(message))
+		case <-time.After(time.Second):
+			t.Fatal("binary frame was not read")
+		}
+	})
+
+	t.Run("legacy socket receives the bare payload", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		conn := dialWithSubprotocol(t, server, "room1", "user1", websocket.LegacySubprotocol)
+		defer conn.Close()
+		assert.Equal(t, websocket.LegacySubprotocol, conn.Subprotocol())
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.BroadCastMessage([]byte(benchmarkFrame), "room1"))
+
+		msgType, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, ws.TextMessage, msgType)
+		assert.JSONEq(t, `{"content":"hello everyone in the room","user_id":"id123","username":"User1",`+
+			`"created_at":"2023-10-18T10:00:00Z"}`, string(message))
+	})
+
+	t.Run("sockets without subprotocol keep json", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.BroadCastMessage([]byte(benchmarkFrame), "room1"))
+
+		msgType, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, ws.TextMessage, msgType)
+		assert.Equal(t, benchmarkFrame, string(message))
+	})
+}
+
+func benchmarkBroadCastMessage(b *testing.B, subprotocol string) {
+	const sockets = 10
+	configs := config.NewConfig()
+	configs.Websocket.SendQueueSize = 4096
+	hub := websocket.NewWebsocket(configs, logger.NewLogger())
+	server := newHubServer(hub)
+	defer server.Close()
+
+	conns := make([]*ws.Conn, sockets)
+	for i := range conns {
+		conns[i] = dialWithSubprotocol(b, server, "room1", fmt.Sprintf("user%d", i), subprotocol)
+		defer conns[i].Close()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan int64, sockets)
+	for _, conn := range conns {
+		go func(conn *ws.Conn) {
+			var received int64
+			for i := 0; i < b.N; i++ {
+				_, message, err := conn.ReadMessage()
+				if err != nil {
+					break
+				}
+				received += int64(len(message))
+			}
+			done <- received
+		}(conn)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := hub.BroadCastMessage([]byte(benchmarkFrame), "room1"); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var received int64
+	for range conns {
+		received += <-done
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(received)/float64(b.N*sockets), "wire-bytes/msg")
+}
+
+func Benchmark_Websocket_BroadCastMessage_JSON(b *testing.B) {
+	benchmarkBroadCastMessage(b, websocket.JSONSubprotocol)
+}
+
+func Benchmark_Websocket_BroadCastMessage_MessagePack(b *testing.B) {
+	benchmarkBroadCastMessage(b, websocket.MessagePackSubprotocol)
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+)
+
+type memorySubscriber struct {
+	messages chan []byte
+	done     <-chan struct{}
+}
+
+// memoryBus is an in-process Bus, it lets several hubs share broadcasts without a Redis server.
+type memoryBus struct {
+	mutex       sync.RWMutex
+	subscribers map[string][]*memorySubscriber
+}
+
+func NewMemoryBus() Bus {
+	return &memoryBus{
+		subscribers: make(map[string][]*memorySubscriber),
+	}
+}
+
+func (b *memoryBus) Publish(ctx context.Context, channel string, message []byte) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for _, subscriber := range b.subscribers[channel] {
+		select {
+		case subscriber.messages <- message:
+		case <-subscriber.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (b *memoryBus) Subscribe(ctx context.Context, channel string) (<-chan []byte, error) {
+	subscriber := &memorySubscriber{
+		messages: make(chan []byte, 64),
+		done:     ctx.Done(),
+	}
+
+	b.mutex.Lock()
+	b.subscribers[channel] = append(b.subscribers[channel], subscriber)
+	b.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		subscribers := b.subscribers[channel]
+		for i := range subscribers {
+			if subscribers[i] == subscriber {
+				b.subscribers[channel] = append(subscribers[:i], subscribers[i+1:]...)
+				break
+			}
+		}
+		close(subscriber.messages)
+	}()
+
+	return subscriber.messages, nil
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import "sync"
+
+// registry indexes the clients by group and user. A user may hold several clients in the same group, one per
+// device or transport, and every access goes through the registry lock.
+type registry struct {
+	mutex   sync.RWMutex
+	clients map[string]map[string]map[*Client]bool
+}
+
+func newRegistry() *registry {
+	return &registry{
+		clients: make(map[string]map[string]map[*Client]bool),
+	}
+}
+
+func (r *registry) add(client *Client, groupID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	client.join(groupID)
+	users, ok := r.clients[groupID]
+	if !ok {
+		users = make(map[string]map[*Client]bool)
+		r.clients[groupID] = users
+	}
+	if _, ok = users[client.userID]; !ok {
+		users[client.userID] = make(map[*Client]bool)
+	}
+	users[client.userID][client] = true
+}
+
+// remove takes the client out of the group, it returns false when the client was not subscribed to it.
+func (r *registry) remove(client *Client, groupID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !client.leave(groupID) {
+		return false
+	}
+	r.unregister(client, groupID)
+	return true
+}
+
+// removeUser takes every client of the user out of the group and returns them.
+func (r *registry) removeUser(groupID, userID string) []*Client {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	clients := make([]*Client, 0, len(r.clients[groupID][userID]))
+	for client := range r.clients[groupID][userID] {
+		client.leave(groupID)
+		clients = append(clients, client)
+	}
+	delete(r.clients[groupID], userID)
+	r.prune(groupID)
+	return clients
+}
+
+// removeClient takes the client out of all its groups while keeping them on the client, and returns the
+// groups the user no longer has any client in.
+func (r *registry) removeClient(client *Client) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	left := make([]string, 0)
+	for _, groupID := range client.Groups() {
+		r.unregister(client, groupID)
+		if len(r.clients[groupID][client.userID]) == 0 {
+			left = append(left, groupID)
+		}
+	}
+	return left
+}
+
+// group returns a snapshot of the clients of the group.
+func (r *registry) group(groupID string) []*Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	clients := make([]*Client, 0, len(r.clients[groupID]))
+	for _, userClients := range r.clients[groupID] {
+		for client := range userClients {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// user returns a snapshot of the clients of the user in the group.
+func (r *registry) user(groupID, userID string) []*Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	clients := make([]*Client, 0, len(r.clients[groupID][userID]))
+	for client := range r.clients[groupID][userID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// all returns a snapshot of every registered client.
+func (r *registry) all() []*Client {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	seen := make(map[*Client]bool)
+	clients := make([]*Client, 0)
+	for _, users := range r.clients {
+		for _, userClients := range users {
+			for client := range userClients {
+				if !seen[client] {
+					seen[client] = true
+					clients = append(clients, client)
+				}
+			}
+		}
+	}
+	return clients
+}
+
+func (r *registry) unregister(client *Client, groupID string) {
+	userClients, ok := r.clients[groupID][client.userID]
+	if !ok {
+		return
+	}
+	delete(userClients, client)
+	if len(userClients) == 0 {
+		delete(r.clients[groupID], client.userID)
+	}
+	r.prune(groupID)
+}
+
+func (r *registry) prune(groupID string) {
+	if len(r.clients[groupID]) == 0 {
+		delete(r.clients, groupID)
+	}
+}
@@ -0,0 +1,174 @@
+package websocket_test
+
+import (
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Websocket_MultipleDevices(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("every device of the user receives the broadcasts", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		phone := dial(t, server, "room1", "user1")
+		defer phone.Close()
+		laptop := dial(t, server, "room1", "user1")
+		defer laptop.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.BroadCastMessage([]byte("message"), "room1"))
+
+		for _, conn := range []*ws.Conn{phone, laptop} {
+			_, message, err := conn.ReadMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, "message", string(message))
+		}
+	})
+
+	t.Run("user only leaves the group with its last device", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		phone := hub.Subscribe("room1", "user1")
+		laptop := hub.Subscribe("room1", "user1")
+
+		assert.Empty(t, hub.Release(phone))
+		assert.NoError(t, hub.BroadCastMessage([]byte("message"), "room1"))
+		assert.Equal(t, "message", string(<-laptop.Messages()))
+		assert.Equal(t, []string{"room1"}, hub.Release(laptop))
+	})
+
+	t.Run("closing the user socket closes every device", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		phone := hub.Subscribe("room1", "user1")
+		laptop := hub.Subscribe("room1", "user1")
+		other := hub.Subscribe("room1", "user2")
+
+		assert.NoError(t, hub.CloseSocket("room1", "user1"))
+
+		for _, client := range []*websocket.Client{phone, laptop} {
+			select {
+			case <-client.Done():
+			default:
+				t.Fatal("device of the closed user is still open")
+			}
+			assert.Empty(t, hub.Release(client))
+		}
+		assert.NoError(t, hub.BroadCastMessage([]byte("message"), "room1"))
+		assert.Equal(t, "message", string(<-other.Messages()))
+	})
+}
+
+// Test_Websocket_Concurrency is meant to run with the race detector, it exercises the registry from many
+// goroutines at once.
+func Test_Websocket_Concurrency(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	const workers = 20
+
+	t.Run("concurrent subscribe, broadcast, close and release", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(3)
+			roomID := fmt.Sprintf("room%d", i%3)
+			userID := fmt.Sprintf("user%d", i%5)
+
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					client := hub.Subscribe(roomID, userID)
+					hub.Release(client)
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					_ = hub.BroadCastMessage([]byte("message"), roomID)
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					_ = hub.CloseSocket(roomID, userID)
+				}
+			}()
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("concurrent socket connections and broadcasts", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(2)
+			roomID := fmt.Sprintf("room%d", i%2)
+			userID := fmt.Sprintf("user%d", i%4)
+
+			go func() {
+				defer wg.Done()
+				conn := dial(t, server, roomID, userID)
+				_ = hub.BroadCastMessage([]byte("message"), roomID)
+				_ = conn.Close()
+			}()
+
+			go func() {
+				defer wg.Done()
+				_ = hub.BroadCastMessage([]byte("message"), roomID)
+				_ = hub.CloseSocket(roomID, userID)
+			}()
+		}
+
+		wg.Wait()
+	})
+
+	t.Run("sockets join and leave groups while broadcasting", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		clients := make([]*websocket.Client, workers)
+		for i := range clients {
+			clients[i] = hub.Subscribe("lobby", fmt.Sprintf("user%d", i))
+		}
+		var wg sync.WaitGroup
+
+		for i, client := range clients {
+			wg.Add(2)
+			roomID := fmt.Sprintf("room%d", i%3)
+
+			go func(client *websocket.Client) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					hub.Join(client, roomID)
+					_ = hub.Leave(client, roomID)
+				}
+			}(client)
+
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					_ = hub.BroadCastMessage([]byte("message"), roomID)
+				}
+			}()
+		}
+
+		wg.Wait()
+		for _, client := range clients {
+			hub.Release(client)
+		}
+	})
+}
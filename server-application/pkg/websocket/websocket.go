@@ -1,100 +1,385 @@
 package websocket
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 )
 
+const websocketName = "pkg.websocket"
+
 type Websocket interface {
-	GetSocket(responseWriter http.ResponseWriter, request *http.Request, groupID, userID string) (*ws.Conn, error)
+	GetSocket(responseWriter http.ResponseWriter, request *http.Request, groupID, userID string, opts ...SocketOption) (*Client, error)
+	Subscribe(groupID, userID string, opts ...SocketOption) *Client
+	Connect(responseWriter http.ResponseWriter, request *http.Request, userID string) (*Client, error)
+	Join(socket *Client, groupID string, opts ...SocketOption)
+	Leave(socket *Client, groupID string) error
 	CloseSocket(groupID, userID string) error
 	BroadCastMessage(message []byte, groupID string) error
-	SendMessageToSocket(message []byte, socket *ws.Conn) error
+	Relay(message []byte, groupID string) error
+	SendMessageToSocket(message []byte, socket *Client) error
+	SendMessageToUser(message []byte, groupID, userID string) error
+	Release(socket *Client) []string
+	Resume(socket *Client, replay [][]byte) error
+	Shutdown(ctx context.Context) error
 }
 
+var (
+	errShuttingDown  = errors.New("server is shutting down")
+	errNoUserSockets = errors.New("no sockets found for the user")
+)
+
 type websocket struct {
-	upgrader    ws.Upgrader
-	connections map[string]map[string]*ws.Conn
-	connMutex   sync.Mutex
+	upgrader             ws.Upgrader
+	registry             *registry
+	compressionLevel     int
+	compressionThreshold int
+	queueSize            int
+	writeTimeout         time.Duration
+	pingInterval         time.Duration
+	pongTimeout          time.Duration
+	maxMessageSize       int64
+	// lifecycle guards closed, so no socket is started once Shutdown began waiting for the writers.
+	lifecycle sync.RWMutex
+	closed    bool
+	shutdown  chan struct{}
+	pumps     sync.WaitGroup
+	logs      logger.Logger
 }
 
-func NewWebsocket() Websocket {
+func NewWebsocket(cfg config.Config, logger logger.Logger) Websocket {
+	upgrader := ws.Upgrader{
+		CheckOrigin:       GetCheckFunc(),
+		Subprotocols:      []string{MessagePackSubprotocol, JSONSubprotocol, LegacySubprotocol},
+		ReadBufferSize:    cfg.Websocket.ReadBufferSize,
+		WriteBufferSize:   cfg.Websocket.WriteBufferSize,
+		EnableCompression: cfg.Websocket.Compression.Enabled,
+	}
+
+	if cfg.Websocket.WriteBufferPool {
+		upgrader.WriteBufferPool = &sync.Pool{}
+	}
+
 	return &websocket{
-		upgrader: ws.Upgrader{
-			CheckOrigin: GetCheckFunc(),
-		},
-		connections: make(map[string]map[string]*ws.Conn),
-		connMutex:   sync.Mutex{},
+		upgrader:             upgrader,
+		compressionLevel:     cfg.Websocket.Compression.Level,
+		compressionThreshold: cfg.Websocket.Compression.Threshold,
+		registry:             newRegistry(),
+		queueSize:            cfg.Websocket.SendQueueSize,
+		writeTimeout:         cfg.Websocket.WriteTimeout,
+		pingInterval:         cfg.Websocket.PingInterval,
+		pongTimeout:          cfg.Websocket.PongTimeout,
+		maxMessageSize:       cfg.Websocket.MaxMessageSize,
+		shutdown:             make(chan struct{}),
+		logs:                 logger,
 	}
 }
 
-func (w *websocket) GetSocket(responseWriter http.ResponseWriter, request *http.Request, groupID, userID string) (*ws.Conn, error) {
-	socket, ok := w.connections[userID][groupID]
-	if ok {
-		return socket, nil
+// GetSocket upgrades a socket for the user in the group. Every call opens a new socket: a user connected from
+// several devices gets one socket per device, all of them receiving the group broadcasts.
+func (w *websocket) GetSocket(responseWriter http.ResponseWriter, request *http.Request, groupID, userID string, opts ...SocketOption) (*Client, error) {
+	w.lifecycle.RLock()
+	defer w.lifecycle.RUnlock()
+	if w.closed {
+		return nil, errShuttingDown
 	}
 
-	socket, err := w.upgrader.Upgrade(responseWriter, request, nil)
+	conn, err := w.upgrader.Upgrade(responseWriter, request, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	w.connMutex.Lock()
-	_, ok = w.connections[groupID]
-	if !ok {
-		usersMap := make(map[string]*ws.Conn)
-		usersMap[userID] = socket
-		w.connections[groupID] = usersMap
-	} else {
-		w.connections[groupID][userID] = socket
+	w.setReadLimits(conn)
+	socket := newClient(conn, userID, w.queueSize, opts...)
+	w.startPump(socket)
+	w.registry.add(socket, groupID)
+
+	return socket, nil
+}
+
+// Subscribe registers a client without socket, the caller delivers its Messages and must Release it when done.
+// Once the hub is shut down the client is returned already closed.
+func (w *websocket) Subscribe(groupID, userID string, opts ...SocketOption) *Client {
+	w.lifecycle.RLock()
+	defer w.lifecycle.RUnlock()
+	client := newClient(nil, userID, w.queueSize, opts...)
+	if w.closed {
+		client.close()
+		return client
+	}
+
+	w.registry.add(client, groupID)
+	return client
+}
+
+// Connect upgrades a multiplexed socket for the user. It is not registered in any group until Join is called,
+// so a single connection can follow several groups.
+func (w *websocket) Connect(responseWriter http.ResponseWriter, request *http.Request, userID string) (*Client, error) {
+	w.lifecycle.RLock()
+	defer w.lifecycle.RUnlock()
+	if w.closed {
+		return nil, errShuttingDown
 	}
-	w.connMutex.Unlock()
+
+	conn, err := w.upgrader.Upgrade(responseWriter, request, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w.setReadLimits(conn)
+	socket := newClient(conn, userID, w.queueSize)
+	socket.multiplexed = true
+	w.startPump(socket)
 
 	return socket, nil
 }
 
+// Join adds a multiplexed socket to a group, WithHeldDelivery holds its whole delivery until Resume is called.
+func (w *websocket) Join(socket *Client, groupID string, opts ...SocketOption) {
+	for _, opt := range opts {
+		opt(socket)
+	}
+	w.registry.add(socket, groupID)
+}
+
+// Leave removes a socket from a group without closing it.
+func (w *websocket) Leave(socket *Client, groupID string) error {
+	if !w.registry.remove(socket, groupID) {
+		return errors.New(fmt.Sprintf("socket is not subscribed to groupID %s", groupID))
+	}
+	return nil
+}
+
+// CloseSocket removes every socket of the user from the group. Multiplexed sockets only stop following the
+// group, the other ones are closed.
 func (w *websocket) CloseSocket(groupID, userID string) error {
-	w.connMutex.Lock()
-	defer w.connMutex.Unlock()
-	socket, ok := w.connections[groupID][userID]
-	if !ok {
+	sockets := w.registry.removeUser(groupID, userID)
+	if len(sockets) == 0 {
 		return errors.New(fmt.Sprintf("no sockets found for groupID %s", groupID))
 	}
-	err := socket.Close()
+
+	for _, socket := range sockets {
+		if !socket.multiplexed {
+			socket.close()
+		}
+	}
+
+	return nil
+}
+
+// BroadCastMessage queues the message on every socket of the group, encoded once per wire format in use. It
+// never waits on a peer: sockets whose queue is full are considered slow consumers and are disconnected
+// without affecting the others.
+func (w *websocket) BroadCastMessage(message []byte, groupID string) error {
+	encoded := map[codec][]byte{jsonFormat: message}
+	for _, socket := range w.registry.group(groupID) {
+		frame, ok := encoded[socket.format]
+		if !ok {
+			var err error
+			if frame, err = socket.format.encode(message); err != nil {
+				w.logs.Error(fmt.Sprintf("message for groupID %s could not be encoded: %s", groupID, err.Error()),
+					websocketName+".BroadCastMessage")
+				continue
+			}
+			encoded[socket.format] = frame
+		}
+
+		if !socket.enqueue(frame) {
+			w.logs.Warn(fmt.Sprintf("disconnecting slow consumer %s on groupID %s", socket.userID, groupID),
+				websocketName+".BroadCastMessage")
+			w.evict(socket)
+		}
+	}
+
+	return nil
+}
+
+// Relay is a no-op, a single instance has no other instances to relay the message to.
+func (w *websocket) Relay(_ []byte, _ string) error {
+	return nil
+}
+
+func (w *websocket) SendMessageToSocket(message []byte, socket *Client) error {
+	frame, err := socket.format.encode(message)
 	if err != nil {
 		return err
 	}
-	delete(w.connections[groupID], userID)
 
+	if !socket.enqueue(frame) {
+		w.evict(socket)
+		return errors.New(fmt.Sprintf("socket for user %s is closed or too slow", socket.userID))
+	}
 	return nil
 }
 
-func (w *websocket) BroadCastMessage(message []byte, groupID string) error {
-	w.connMutex.Lock()
-	defer w.connMutex.Unlock()
+// SendMessageToUser sends the message to every socket of the user in the group held by this instance.
+func (w *websocket) SendMessageToUser(message []byte, groupID, userID string) error {
+	sockets := w.registry.user(groupID, userID)
+	if len(sockets) == 0 {
+		return fmt.Errorf("%w: user %s in groupID %s", errNoUserSockets, userID, groupID)
+	}
+
+	for _, socket := range sockets {
+		if err := w.SendMessageToSocket(message, socket); err != nil {
+			w.logs.Warn(err.Error(), websocketName+".SendMessageToUser")
+		}
+	}
+
+	return nil
+}
+
+// Release must be called once the reading side of a socket is done. It unregisters and closes the socket and
+// returns the groups the user left with it: the groups the socket still followed, as it died on its own rather
+// than through CloseSocket, and where the user has no other socket. Callers run the exit handling for them.
+func (w *websocket) Release(socket *Client) []string {
+	left := w.evict(socket)
+	select {
+	case <-w.shutdown:
+		return nil
+	default:
+		return left
+	}
+}
 
-	socketsList, ok := w.connections[groupID]
-	if !ok {
+// Shutdown closes every socket with a going away close frame, so clients reconnect to another instance, and
+// waits for the writers to flush it. Clients released after Shutdown don't report any group as left: users are
+// not exited from their rooms because the server stops.
+func (w *websocket) Shutdown(ctx context.Context) error {
+	w.lifecycle.Lock()
+	if w.closed {
+		w.lifecycle.Unlock()
 		return nil
 	}
+	w.closed = true
+	close(w.shutdown)
+	w.lifecycle.Unlock()
 
-	for _, socket := range socketsList {
-		if err := socket.WriteMessage(ws.TextMessage, message); err != nil {
+	for _, client := range w.registry.all() {
+		client.close()
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		w.pumps.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume sends the replayed frames to a socket registered WithHeldDelivery, followed by the broadcasts held
+// meanwhile that were not part of the replay, and then switches the socket to live delivery.
+func (w *websocket) Resume(socket *Client, replay [][]byte) error {
+	replayed := make(map[string]bool, len(replay))
+	for _, message := range replay {
+		frame, err := socket.format.encode(message)
+		if err != nil {
+			return err
+		}
+
+		replayed[string(frame)] = true
+		if err := socket.push(frame); err != nil {
 			return err
 		}
 	}
 
+	for held := socket.release(); len(held) > 0; held = socket.release() {
+		for _, frame := range held {
+			if replayed[string(frame)] {
+				continue
+			}
+			if err := socket.push(frame); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
-func (w *websocket) SendMessageToSocket(message []byte, socket *ws.Conn) error {
-	if err := socket.WriteMessage(ws.TextMessage, message); err != nil {
-		return err
+// setReadLimits bounds inbound frames and keeps the read deadline alive only while the peer answers pings,
+// so half-open connections time out on their next read. It also sets the compression level used when the
+// peer negotiated permessage-deflate.
+func (w *websocket) setReadLimits(conn *ws.Conn) {
+	if err := conn.SetCompressionLevel(w.compressionLevel); err != nil {
+		w.logs.Warn(err.Error(), websocketName+".setReadLimits")
 	}
-	return nil
+	conn.SetReadLimit(w.maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(w.pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(w.pongTimeout))
+	})
+}
+
+// startPump starts the socket writer, callers hold the lifecycle lock so Shutdown waits for it.
+func (w *websocket) startPump(socket *Client) {
+	w.pumps.Add(1)
+	go func() {
+		defer w.pumps.Done()
+		w.writePump(socket)
+	}()
+}
+
+func (w *websocket) writePump(socket *Client) {
+	ticker := time.NewTicker(w.pingInterval)
+	defer func() {
+		ticker.Stop()
+		closeMessage := ws.FormatCloseMessage(ws.CloseNormalClosure, "")
+		select {
+		case <-w.shutdown:
+			closeMessage = ws.FormatCloseMessage(ws.CloseGoingAway, errShuttingDown.Error())
+		default:
+		}
+		_ = socket.conn.WriteControl(ws.CloseMessage, closeMessage, time.Now().Add(w.writeTimeout))
+		_ = socket.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-socket.send:
+			_ = socket.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+			socket.conn.EnableWriteCompression(len(message) >= w.compressionThreshold)
+			if err := socket.conn.WriteMessage(socket.format.messageType(), message); err != nil {
+				w.onWriteError(socket, err)
+				return
+			}
+		case <-ticker.C:
+			if err := socket.conn.WriteControl(ws.PingMessage, nil, time.Now().Add(w.writeTimeout)); err != nil {
+				w.onWriteError(socket, err)
+				return
+			}
+		case <-socket.done:
+			return
+		case <-w.shutdown:
+			return
+		}
+	}
+}
+
+func (w *websocket) onWriteError(socket *Client, err error) {
+	w.logs.Warn(fmt.Sprintf("evicting socket %s on groupIDs [%s]: %s", socket.userID,
+		strings.Join(socket.Groups(), ", "), err.Error()),
+		websocketName+".writePump")
+	w.evict(socket)
+}
+
+// evict removes the socket from the registry and closes it, it returns the groups the user left.
+func (w *websocket) evict(socket *Client) []string {
+	left := w.registry.removeClient(socket)
+	socket.close()
+	return left
 }
 
 // Here we should implement validation with JWT
@@ -0,0 +1,451 @@
+package websocket_test
+
+import (
+	"context"
+	"fmt"
+	ws "github.com/gorilla/websocket"
+	"github.com/sebastianreh/chatroom/internal/config"
+	"github.com/sebastianreh/chatroom/pkg/logger"
+	"github.com/sebastianreh/chatroom/pkg/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHubServer(hub websocket.Websocket) *httptest.Server {
+	return newHubServerWithRelease(hub, make(chan bool, 10))
+}
+
+func newHubServerWithRelease(hub websocket.Websocket, released chan bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		socket, err := hub.GetSocket(w, r, r.URL.Query().Get("room_id"), r.URL.Query().Get("user_id"))
+		if err != nil {
+			return
+		}
+
+		for {
+			if msgType, _, _ := socket.ReadMessage(); msgType == -1 {
+				released <- len(hub.Release(socket)) > 0
+				return
+			}
+		}
+	}))
+}
+
+func dial(t *testing.T, server *httptest.Server, roomID, userID string) *ws.Conn {
+	url := fmt.Sprintf("ws%s?room_id=%s&user_id=%s", strings.TrimPrefix(server.URL, "http"), roomID, userID)
+	conn, _, err := ws.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	return conn
+}
+
+func Test_Websocket_BroadCastMessage(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("dead socket does not break delivery for the room", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		dead := dial(t, server, "room1", "user1")
+		alive := dial(t, server, "room1", "user2")
+		defer alive.Close()
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, dead.Close())
+
+		for i := 0; i < 20; i++ {
+			assert.NoError(t, hub.BroadCastMessage([]byte(fmt.Sprintf("message %d", i)), "room1"))
+		}
+
+		for i := 0; i < 20; i++ {
+			_ = alive.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, message, err := alive.ReadMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("message %d", i), string(message))
+		}
+	})
+
+	t.Run("closed socket is removed from the group", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.CloseSocket("room1", "user1"))
+		assert.Error(t, hub.CloseSocket("room1", "user1"))
+	})
+}
+
+func Test_Websocket_SendMessageToUser(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("message reaches the sockets of the user only", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		target := dial(t, server, "room1", "user1")
+		defer target.Close()
+		other := dial(t, server, "room1", "user2")
+		defer other.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		assert.NoError(t, hub.SendMessageToUser([]byte("bot did not respond"), "room1", "user1"))
+		assert.Error(t, hub.SendMessageToUser([]byte("bot did not respond"), "room2", "user1"))
+
+		_ = target.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := target.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, "bot did not respond", string(message))
+		_ = other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err = other.ReadMessage()
+		assert.Error(t, err)
+	})
+}
+
+func Test_Websocket_Heartbeat(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	configs.Websocket.PingInterval = 20 * time.Millisecond
+	configs.Websocket.PongTimeout = 100 * time.Millisecond
+	configs.Websocket.MaxMessageSize = 16
+
+	t.Run("peer answering pings stays connected", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		released := make(chan bool, 1)
+		server := newHubServerWithRelease(hub, released)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		select {
+		case <-released:
+			t.Fatal("connection answering pings was reaped")
+		case <-time.After(300 * time.Millisecond):
+		}
+	})
+
+	t.Run("idle connection is reaped and reported as lost", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		released := make(chan bool, 1)
+		server := newHubServerWithRelease(hub, released)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+
+		select {
+		case lost := <-released:
+			assert.True(t, lost)
+		case <-time.After(time.Second):
+			t.Fatal("idle connection was not reaped")
+		}
+		assert.Error(t, hub.CloseSocket("room1", "user1"))
+	})
+
+	t.Run("closed socket is not reported as lost", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		released := make(chan bool, 1)
+		server := newHubServerWithRelease(hub, released)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		time.Sleep(50 * time.Millisecond)
+		assert.NoError(t, hub.CloseSocket("room1", "user1"))
+
+		select {
+		case lost := <-released:
+			assert.False(t, lost)
+		case <-time.After(time.Second):
+			t.Fatal("closed socket was not released")
+		}
+	})
+
+	t.Run("oversized message closes the connection", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		released := make(chan bool, 1)
+		server := newHubServerWithRelease(hub, released)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		assert.NoError(t, conn.WriteMessage(ws.TextMessage, []byte(strings.Repeat("a", 64))))
+
+		select {
+		case lost := <-released:
+			assert.True(t, lost)
+		case <-time.After(time.Second):
+			t.Fatal("oversized message did not close the connection")
+		}
+	})
+}
+
+func Test_Websocket_Resume(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("replay is delivered before held broadcasts without duplicates", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		registered := make(chan *websocket.Client, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			socket, err := hub.GetSocket(w, r, "room1", "user1", websocket.WithHeldDelivery())
+			if err != nil {
+				return
+			}
+			registered <- socket
+			for {
+				if msgType, _, _ := socket.ReadMessage(); msgType == -1 {
+					hub.Release(socket)
+					return
+				}
+			}
+		}))
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		socket := <-registered
+
+		assert.NoError(t, hub.BroadCastMessage([]byte("event 2"), "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("event 3"), "room1"))
+		assert.NoError(t, hub.Resume(socket, [][]byte{[]byte("event 1"), []byte("event 2")}))
+		assert.NoError(t, hub.BroadCastMessage([]byte("event 4"), "room1"))
+
+		for _, expected := range []string{"event 1", "event 2", "event 3", "event 4"} {
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, message, err := conn.ReadMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(message))
+		}
+	})
+}
+
+func Test_Websocket_Connect(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	newConnectServer := func(hub websocket.Websocket, connected chan *websocket.Client) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			socket, err := hub.Connect(w, r, r.URL.Query().Get("user_id"))
+			if err != nil {
+				return
+			}
+			connected <- socket
+			for {
+				if msgType, _, _ := socket.ReadMessage(); msgType == -1 {
+					hub.Release(socket)
+					return
+				}
+			}
+		}))
+	}
+
+	readMessage := func(t *testing.T, conn *ws.Conn) string {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		return string(message)
+	}
+
+	t.Run("one connection receives the broadcasts of every joined group", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		connected := make(chan *websocket.Client, 1)
+		server := newConnectServer(hub, connected)
+		defer server.Close()
+
+		conn := dial(t, server, "", "user1")
+		defer conn.Close()
+		socket := <-connected
+		hub.Join(socket, "room1")
+		hub.Join(socket, "room2")
+
+		assert.NoError(t, hub.BroadCastMessage([]byte("room1 event"), "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("room2 event"), "room2"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("room3 event"), "room3"))
+
+		assert.Equal(t, "room1 event", readMessage(t, conn))
+		assert.Equal(t, "room2 event", readMessage(t, conn))
+		assert.Equal(t, []string{"room1", "room2"}, socket.Groups())
+	})
+
+	t.Run("left group is no longer delivered", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		connected := make(chan *websocket.Client, 1)
+		server := newConnectServer(hub, connected)
+		defer server.Close()
+
+		conn := dial(t, server, "", "user1")
+		defer conn.Close()
+		socket := <-connected
+		hub.Join(socket, "room1")
+		hub.Join(socket, "room2")
+
+		assert.NoError(t, hub.Leave(socket, "room1"))
+		assert.Error(t, hub.Leave(socket, "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("room1 event"), "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("room2 event"), "room2"))
+
+		assert.Equal(t, "room2 event", readMessage(t, conn))
+		assert.False(t, socket.InGroup("room1"))
+	})
+
+	t.Run("closing a group keeps the connection open for the others", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		connected := make(chan *websocket.Client, 1)
+		server := newConnectServer(hub, connected)
+		defer server.Close()
+
+		conn := dial(t, server, "", "user1")
+		defer conn.Close()
+		socket := <-connected
+		hub.Join(socket, "room1")
+		hub.Join(socket, "room2")
+
+		assert.NoError(t, hub.CloseSocket("room1", "user1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte("room2 event"), "room2"))
+
+		assert.Equal(t, "room2 event", readMessage(t, conn))
+		assert.Equal(t, []string{"room2"}, socket.Groups())
+	})
+
+	t.Run("released connection keeps its groups and leaves the registry", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		connected := make(chan *websocket.Client, 1)
+		server := newConnectServer(hub, connected)
+		defer server.Close()
+
+		conn := dial(t, server, "", "user1")
+		socket := <-connected
+		hub.Join(socket, "room1")
+		hub.Join(socket, "room2")
+		assert.NoError(t, conn.Close())
+
+		select {
+		case <-socket.Done():
+		case <-time.After(time.Second):
+			t.Fatal("closed connection was not released")
+		}
+		assert.Equal(t, []string{"room1", "room2"}, socket.Groups())
+		assert.Error(t, hub.CloseSocket("room1", "user1"))
+		assert.Error(t, hub.CloseSocket("room2", "user1"))
+	})
+}
+
+func Test_Websocket_Compression(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+	configs.Websocket.Compression.Threshold = 64
+
+	dialCompressed := func(t *testing.T, server *httptest.Server) (*ws.Conn, *http.Response) {
+		url := fmt.Sprintf("ws%s?room_id=room1&user_id=user1", strings.TrimPrefix(server.URL, "http"))
+		dialer := ws.Dialer{EnableCompression: true}
+		conn, response, err := dialer.Dial(url, nil)
+		assert.NoError(t, err)
+		return conn, response
+	}
+
+	t.Run("permessage-deflate is negotiated and messages arrive intact", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		conn, response := dialCompressed(t, server)
+		defer conn.Close()
+		assert.Contains(t, response.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		time.Sleep(50 * time.Millisecond)
+
+		small := "short message"
+		large := strings.Repeat("a compressible message ", 100)
+		assert.NoError(t, hub.BroadCastMessage([]byte(small), "room1"))
+		assert.NoError(t, hub.BroadCastMessage([]byte(large), "room1"))
+
+		for _, expected := range []string{small, large} {
+			_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			_, message, err := conn.ReadMessage()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(message))
+		}
+	})
+
+	t.Run("compression is not negotiated when disabled", func(t *testing.T) {
+		disabled := configs
+		disabled.Websocket.Compression.Enabled = false
+		hub := websocket.NewWebsocket(disabled, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+
+		conn, response := dialCompressed(t, server)
+		defer conn.Close()
+		assert.NotContains(t, response.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+	})
+}
+
+func Test_Websocket_Shutdown(t *testing.T) {
+	logs := logger.NewLogger()
+	configs := config.NewConfig()
+
+	t.Run("sockets are closed as going away without leaving their groups", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		released := make(chan bool, 1)
+		server := newHubServerWithRelease(hub, released)
+		defer server.Close()
+
+		conn := dial(t, server, "room1", "user1")
+		defer conn.Close()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, hub.Shutdown(ctx))
+
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, ws.IsCloseError(err, ws.CloseGoingAway))
+		select {
+		case lost := <-released:
+			assert.False(t, lost)
+		case <-time.After(time.Second):
+			t.Fatal("socket was not released")
+		}
+	})
+
+	t.Run("new clients are refused once shut down", func(t *testing.T) {
+		hub := websocket.NewWebsocket(configs, logs)
+		server := newHubServer(hub)
+		defer server.Close()
+		subscriber := hub.Subscribe("room1", "user1")
+
+		assert.NoError(t, hub.Shutdown(context.Background()))
+
+		select {
+		case <-subscriber.Done():
+		default:
+			t.Fatal("subscriber was not closed")
+		}
+		select {
+		case <-hub.Subscribe("room1", "user2").Done():
+		default:
+			t.Fatal("subscriber created after shutdown is open")
+		}
+		url := fmt.Sprintf("ws%s?room_id=room1&user_id=user3", strings.TrimPrefix(server.URL, "http"))
+		_, _, err := ws.DefaultDialer.Dial(url, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+)
+
+type BotRepositoryMock struct {
+	mock.Mock
+}
+
+func NewBotRepositoryMock() *BotRepositoryMock {
+	return new(BotRepositoryMock)
+}
+
+func (m *BotRepositoryMock) Create(ctx context.Context, bot entities.Bot, hashedAPIKey string) (string, error) {
+	args := m.Called(ctx, bot, hashedAPIKey)
+	return args.String(0), args.Error(1)
+}
+
+func (m *BotRepositoryMock) Get(ctx context.Context, search entities.BotSearch) ([]entities.Bot, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).([]entities.Bot), args.Error(1)
+}
+
+func (m *BotRepositoryMock) Update(ctx context.Context, botID string, bot entities.Bot) error {
+	args := m.Called(ctx, botID, bot)
+	return args.Error(0)
+}
@@ -0,0 +1,70 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+)
+
+type BotServiceMock struct {
+	mock.Mock
+}
+
+func NewBotServiceMock() *BotServiceMock {
+	return new(BotServiceMock)
+}
+
+func (m *BotServiceMock) Create(ctx context.Context, bot entities.Bot) (entities.BotCreateResponse, error) {
+	args := m.Called(ctx, bot)
+	return args.Get(0).(entities.BotCreateResponse), args.Error(1)
+}
+
+func (m *BotServiceMock) Get(ctx context.Context, search entities.BotSearch) (entities.BotsGetResponse, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).(entities.BotsGetResponse), args.Error(1)
+}
+
+func (m *BotServiceMock) Update(ctx context.Context, botID string, bot entities.Bot) error {
+	args := m.Called(ctx, botID, bot)
+	return args.Error(0)
+}
+
+func (m *BotServiceMock) Delete(ctx context.Context, botID string) error {
+	args := m.Called(ctx, botID)
+	return args.Error(0)
+}
+
+func (m *BotServiceMock) RotateKey(ctx context.Context, botID string) (entities.BotKeyResponse, error) {
+	args := m.Called(ctx, botID)
+	return args.Get(0).(entities.BotKeyResponse), args.Error(1)
+}
+
+func (m *BotServiceMock) Authenticate(ctx context.Context, botName, apiKey, roomID string) (entities.Bot, error) {
+	args := m.Called(ctx, botName, apiKey, roomID)
+	return args.Get(0).(entities.Bot), args.Error(1)
+}
+
+func (m *BotServiceMock) Rooms(ctx context.Context, botName, apiKey string) (entities.BotRoomsResponse, error) {
+	args := m.Called(ctx, botName, apiKey)
+	return args.Get(0).(entities.BotRoomsResponse), args.Error(1)
+}
+
+func (m *BotServiceMock) RegisterCommands(ctx context.Context, botName, apiKey string, commands []entities.CommandDefinition) error {
+	args := m.Called(ctx, botName, apiKey, commands)
+	return args.Error(0)
+}
+
+func (m *BotServiceMock) RoomCommands(ctx context.Context, roomID string) ([]entities.RoomCommand, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).([]entities.RoomCommand), args.Error(1)
+}
+
+func (m *BotServiceMock) SendCommand(ctx context.Context, request entities.CommandRequest) error {
+	args := m.Called(ctx, request)
+	return args.Error(0)
+}
+
+func (m *BotServiceMock) SetRoomBot(ctx context.Context, request entities.RoomBotRequest, enabled bool) error {
+	args := m.Called(ctx, request, enabled)
+	return args.Error(0)
+}
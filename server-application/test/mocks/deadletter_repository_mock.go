@@ -0,0 +1,31 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type DeadLetterRepositoryMock struct {
+	mock.Mock
+}
+
+func NewDeadLetterRepositoryMock() *DeadLetterRepositoryMock {
+	return new(DeadLetterRepositoryMock)
+}
+
+func (m *DeadLetterRepositoryMock) Create(ctx context.Context, deadLetter entities.DeadLetter) (string, error) {
+	args := m.Called(ctx, deadLetter)
+	return args.String(0), args.Error(1)
+}
+
+func (m *DeadLetterRepositoryMock) Get(ctx context.Context, search entities.DeadLetterSearch) ([]entities.DeadLetter, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).([]entities.DeadLetter), args.Error(1)
+}
+
+func (m *DeadLetterRepositoryMock) MarkReplayed(ctx context.Context, deadLetterID string, replayedAt time.Time) error {
+	args := m.Called(ctx, deadLetterID, replayedAt)
+	return args.Error(0)
+}
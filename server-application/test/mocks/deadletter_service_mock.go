@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+)
+
+type DeadLetterServiceMock struct {
+	mock.Mock
+}
+
+func NewDeadLetterServiceMock() *DeadLetterServiceMock {
+	return new(DeadLetterServiceMock)
+}
+
+func (m *DeadLetterServiceMock) Save(ctx context.Context, deadLetter entities.DeadLetter) error {
+	args := m.Called(ctx, deadLetter)
+	return args.Error(0)
+}
+
+func (m *DeadLetterServiceMock) Get(ctx context.Context, search entities.DeadLetterSearch) (entities.DeadLettersGetResponse, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).(entities.DeadLettersGetResponse), args.Error(1)
+}
+
+func (m *DeadLetterServiceMock) Replay(ctx context.Context, deadLetterID string) error {
+	args := m.Called(ctx, deadLetterID)
+	return args.Error(0)
+}
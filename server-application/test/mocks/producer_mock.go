@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+type ProducerMock struct {
+	mock.Mock
+}
+
+func NewProducerMock() *ProducerMock {
+	return new(ProducerMock)
+}
+
+func (m *ProducerMock) Publish(ctx context.Context, topic string, value []byte, headers map[string]string) error {
+	args := m.Called(ctx, topic, value, headers)
+	return args.Error(0)
+}
+
+func (m *ProducerMock) Close(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
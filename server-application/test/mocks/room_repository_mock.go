@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+)
+
+type RoomRepositoryMock struct {
+	mock.Mock
+}
+
+func NewRoomRepositoryMock() *RoomRepositoryMock {
+	return new(RoomRepositoryMock)
+}
+
+func (m *RoomRepositoryMock) Create(ctx context.Context, room entities.Room) (string, error) {
+	args := m.Called(ctx, room)
+	return args.String(0), args.Error(1)
+}
+
+func (m *RoomRepositoryMock) Get(ctx context.Context, search entities.RoomSearch) ([]entities.Room, error) {
+	args := m.Called(ctx, search)
+	return args.Get(0).([]entities.Room), args.Error(1)
+}
+
+func (m *RoomRepositoryMock) Update(ctx context.Context, roomID string, room entities.Room) error {
+	args := m.Called(ctx, roomID, room)
+	return args.Error(0)
+}
@@ -0,0 +1,66 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+	"time"
+)
+
+type SessionRepositoryMock struct {
+	mock.Mock
+}
+
+func NewSessionRepositoryMock() *SessionRepositoryMock {
+	return new(SessionRepositoryMock)
+}
+
+func (m *SessionRepositoryMock) Set(ctx context.Context, session entities.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *SessionRepositoryMock) Get(ctx context.Context, roomID string) (entities.Session, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).(entities.Session), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) NextSeq(ctx context.Context, roomID string) (int64, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) CurrentSeq(ctx context.Context, roomID string) (int64, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) AppendEvent(ctx context.Context, roomID string, frame []byte) error {
+	args := m.Called(ctx, roomID, frame)
+	return args.Error(0)
+}
+
+func (m *SessionRepositoryMock) GetEvents(ctx context.Context, roomID string) ([][]byte, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).([][]byte), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) ResolveCommand(ctx context.Context, correlationID, resolution string, ttl time.Duration) (bool, error) {
+	args := m.Called(ctx, correlationID, resolution, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) CommandResolution(ctx context.Context, correlationID string) (string, error) {
+	args := m.Called(ctx, correlationID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *SessionRepositoryMock) SaveDeadLetteredReply(ctx context.Context, correlationID string, ttl time.Duration) error {
+	args := m.Called(ctx, correlationID, ttl)
+	return args.Error(0)
+}
+
+func (m *SessionRepositoryMock) IsDeadLetteredReply(ctx context.Context, correlationID string) (bool, error) {
+	args := m.Called(ctx, correlationID)
+	return args.Bool(0), args.Error(1)
+}
@@ -0,0 +1,63 @@
+package mocks
+
+import (
+	"context"
+	"github.com/sebastianreh/chatroom/internal/entities"
+	"github.com/stretchr/testify/mock"
+)
+
+type SessionServiceMock struct {
+	mock.Mock
+}
+
+func NewSessionServiceMock() *SessionServiceMock {
+	return new(SessionServiceMock)
+}
+
+func (m *SessionServiceMock) Join(ctx context.Context, sessionJoin entities.SessionChatRequest) (entities.JoinResponse, error) {
+	args := m.Called(ctx, sessionJoin)
+	return args.Get(0).(entities.JoinResponse), args.Error(1)
+}
+
+func (m *SessionServiceMock) Exit(ctx context.Context, sessionExit entities.SessionChatRequest) error {
+	args := m.Called(ctx, sessionExit)
+	return args.Error(0)
+}
+
+func (m *SessionServiceMock) SaveMessage(ctx context.Context, message entities.ChatMessage, roomID string) error {
+	args := m.Called(ctx, message, roomID)
+	return args.Error(0)
+}
+
+func (m *SessionServiceMock) GetMessages(ctx context.Context, roomID string) ([]entities.ChatMessage, error) {
+	args := m.Called(ctx, roomID)
+	return args.Get(0).([]entities.ChatMessage), args.Error(1)
+}
+
+func (m *SessionServiceMock) PublishEvent(ctx context.Context, envelope entities.Envelope) (entities.Envelope, error) {
+	args := m.Called(ctx, envelope)
+	if assign, ok := args.Get(0).(func(entities.Envelope) entities.Envelope); ok {
+		return assign(envelope), args.Error(1)
+	}
+	return args.Get(0).(entities.Envelope), args.Error(1)
+}
+
+func (m *SessionServiceMock) GetEventsSince(ctx context.Context, roomID string, lastSeq int64) (entities.EventReplay, error) {
+	args := m.Called(ctx, roomID, lastSeq)
+	return args.Get(0).(entities.EventReplay), args.Error(1)
+}
+
+func (m *SessionServiceMock) ResolveCommand(ctx context.Context, correlationID, resolution string) (bool, error) {
+	args := m.Called(ctx, correlationID, resolution)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *SessionServiceMock) AcceptReply(ctx context.Context, correlationID string) (bool, error) {
+	args := m.Called(ctx, correlationID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *SessionServiceMock) DeadLetterReply(ctx context.Context, correlationID string) error {
+	args := m.Called(ctx, correlationID)
+	return args.Error(0)
+}